@@ -0,0 +1,110 @@
+package hub
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// ClientRule maps clients, by User-Agent, onto an output format.
+type ClientRule struct {
+	Match  string `mapstructure:"match"`  // case-insensitive regexp on the User-Agent
+	Format string `mapstructure:"format"` // any `?format=` value
+	// MinVersion / MaxVersion limit the rule to client versions, read from
+	// the first dotted number after the match ("SFA/1.11.4", "clash-verge/v2.0.3").
+	MinVersion string `mapstructure:"min_version"`
+	MaxVersion string `mapstructure:"max_version"`
+	// Query holds defaults for query parameters the request did not set
+	// (tun, mixed_port, ...), the variant of the format this client gets.
+	Query map[string]string `mapstructure:"query"`
+}
+
+// defaultClientRules apply when `clients` is not configured.
+var defaultClientRules = []ClientRule{
+	{Match: `\bsf[aim]\b|sing-box`, Format: formatSingBox},
+	{Match: `clash|mihomo|stash`, Format: formatClash},
+	{Match: `surge`, Format: formatSurge},
+	{Match: `loon`, Format: formatLoon},
+	{Match: `shadowrocket|v2rayn|v2rayng`, Format: formatURI},
+}
+
+type clientRule struct {
+	ClientRule
+	pattern *regexp.Regexp
+	format  string
+}
+
+// getClientRules reads and compiles the `clients` key.
+func getClientRules() ([]clientRule, error) {
+	cfgs := defaultClientRules
+	if viper.IsSet("clients") {
+		cfgs = nil
+		if err := viper.UnmarshalKey("clients", &cfgs); err != nil {
+			return nil, fmt.Errorf("hub.getClientRules: unable to decode 'clients' into struct: %v", err)
+		}
+	}
+
+	rules := make([]clientRule, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		re, err := regexp.Compile("(?i)" + cfg.Match)
+		if err != nil {
+			return nil, fmt.Errorf("hub.getClientRules: match %q: %v", cfg.Match, err)
+		}
+		f, ok := formatAliases[strings.ToLower(cfg.Format)]
+		if !ok {
+			return nil, fmt.Errorf("hub.getClientRules: match %q: unknown format %q", cfg.Match, cfg.Format)
+		}
+		rules = append(rules, clientRule{ClientRule: cfg, pattern: re, format: f})
+	}
+	return rules, nil
+}
+
+var versionPattern = regexp.MustCompile(`\d+(?:\.\d+)+`)
+
+// detectClient returns the first rule matching the User-Agent whose version
+// range, if any, holds the client version.
+func detectClient(rules []clientRule, ua string) (clientRule, bool) {
+	for _, r := range rules {
+		loc := r.pattern.FindStringIndex(ua)
+		if loc == nil {
+			continue
+		}
+		if r.MinVersion == "" && r.MaxVersion == "" {
+			return r, true
+		}
+		version := versionPattern.FindString(ua[loc[1]:])
+		if version == "" {
+			continue
+		}
+		if r.MinVersion != "" && compareVersions(version, r.MinVersion) < 0 ||
+			r.MaxVersion != "" && compareVersions(version, r.MaxVersion) > 0 {
+			continue
+		}
+		return r, true
+	}
+	return clientRule{}, false
+}
+
+// compareVersions compares dotted versions numerically; missing parts are 0.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(strings.TrimPrefix(a, "v"), "."), strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < max(len(as), len(bs)); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,137 @@
+package hub
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.11.4", "1.11.4", 0},
+		{"1.11", "1.11.0", 0},
+		{"v2.0.3", "2.0.3", 0},
+		{"1.9.9", "1.10", -1},
+		{"1.12.0", "1.11.9", 1},
+		{"2", "10", -1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestDetectClient(t *testing.T) {
+	viper.Set("clients", []map[string]any{
+		{"match": "SFA", "format": "json", "max_version": "1.10.99", "query": map[string]string{"tun": "false"}},
+		{"match": `\bsf[aim]\b`, "format": "singbox"},
+		{"match": "clash-verge", "format": "mihomo", "min_version": "2.0"},
+		{"match": "shadowrocket", "format": "base64"},
+	})
+	t.Cleanup(func() { viper.Set("clients", nil) })
+	rules, err := getClientRules()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ua     string
+		format string // empty = no rule matches
+		match  string
+	}{
+		{"SFA/1.10.7 (Android 14)", formatSingBox, "SFA"},
+		{"SFA/1.11.4 (Android 14)", formatSingBox, `\bsf[aim]\b`},
+		{"sfi/1.12.0", formatSingBox, `\bsf[aim]\b`},
+		{"clash-verge/v2.0.3", formatClash, "clash-verge"},
+		{"clash-verge/v1.7.7", "", ""},
+		{"clash-verge", "", ""}, // no version to check the range against
+		{"Shadowrocket/2070 CFNetwork/1410", formatURI, "shadowrocket"},
+		{"curl/8.5.0", "", ""},
+	}
+	for _, tt := range tests {
+		r, ok := detectClient(rules, tt.ua)
+		if !ok {
+			if tt.format != "" {
+				t.Errorf("%q: no rule, want %s", tt.ua, tt.format)
+			}
+			continue
+		}
+		if r.format != tt.format || r.Match != tt.match {
+			t.Errorf("%q: rule %q (%s), want %q (%s)", tt.ua, r.Match, r.format, tt.match, tt.format)
+		}
+	}
+}
+
+func TestGetClientRulesErrors(t *testing.T) {
+	t.Cleanup(func() { viper.Set("clients", nil) })
+	for _, clients := range [][]map[string]any{
+		{{"match": "(", "format": "clash"}},
+		{{"match": "x", "format": "quantumult"}},
+	} {
+		viper.Set("clients", clients)
+		if _, err := getClientRules(); err == nil {
+			t.Errorf("%v accepted", clients)
+		}
+	}
+}
+
+func TestProfileFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		target, ua string
+		format     string
+		query      string // the request query afterwards
+		unknown    bool
+	}{
+		{target: "/?format=Clash", format: formatClash, query: "format=Clash"},
+		{target: "/?format=base64", ua: "clash-verge/v2.0.3", format: formatURI, query: "format=base64"},
+		{target: "/", ua: "clash-verge/v2.0.3", format: formatClash},
+		{target: "/", ua: "curl/8.5.0", format: formatSingBox},
+		{target: "/?format=quantumult", ua: "clash-verge/v2.0.3", unknown: true},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, tt.target, nil)
+		c.Request.Header.Set("User-Agent", tt.ua)
+		f, err := profileFormat(c)
+		if tt.unknown {
+			if !errors.Is(err, errUnknownFormat) || !strings.Contains(err.Error(), "clash, clash-meta, json") {
+				t.Errorf("%s: error = %v", tt.target, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.target, err)
+			continue
+		}
+		if f != tt.format || c.Request.URL.RawQuery != tt.query {
+			t.Errorf("%s (%s): format %s, query %q; want %s, %q", tt.target, tt.ua, f, c.Request.URL.RawQuery, tt.format, tt.query)
+		}
+	}
+}
+
+func TestProfileFormatQueryDefaults(t *testing.T) {
+	viper.Set("clients", []map[string]any{{"match": "SFA", "format": "singbox", "query": map[string]string{"tun": "false", "mixed_port": "7890"}}})
+	t.Cleanup(func() { viper.Set("clients", nil) })
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/?tun=true", nil)
+	c.Request.Header.Set("User-Agent", "SFA/1.11.4")
+	if _, err := profileFormat(c); err != nil {
+		t.Fatal(err)
+	}
+	// the request's own tun wins over the client default
+	if got := c.Request.URL.RawQuery; got != "mixed_port=7890&tun=true" {
+		t.Errorf("query = %q", got)
+	}
+}
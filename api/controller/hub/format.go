@@ -0,0 +1,123 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/dingdayu/go-project-template/internal/format"
+	"github.com/gin-gonic/gin"
+	"github.com/sagernet/sing-box/option"
+	singjson "github.com/sagernet/sing/common/json"
+)
+
+// Subscription output formats.
+const (
+	formatSingBox = "singbox"
+	formatClash   = "clash"
+	formatURI     = "uri"
+	formatSurge   = "surge"
+	formatLoon    = "loon"
+)
+
+// formatAliases maps the accepted `?format=` values onto the output formats.
+var formatAliases = map[string]string{
+	"clash":      formatClash,
+	"mihomo":     formatClash,
+	"clash-meta": formatClash,
+	"meta":       formatClash,
+	"singbox":    formatSingBox,
+	"sing-box":   formatSingBox,
+	"json":       formatSingBox,
+	"uri":        formatURI,
+	"base64":     formatURI,
+	"surge":      formatSurge,
+	"loon":       formatLoon,
+}
+
+// errUnknownFormat is returned for a `?format=` value that is not in formatAliases.
+var errUnknownFormat = errors.New("unknown format")
+
+// profileFormat picks the output format: `?format=` wins, otherwise the first
+// client rule matching the User-Agent, whose query defaults are added to the
+// request. Unrecognised clients get sing-box.
+func profileFormat(c *gin.Context) (string, error) {
+	if q := c.Query("format"); q != "" {
+		f, ok := formatAliases[strings.ToLower(q)]
+		if !ok {
+			return "", fmt.Errorf("%w %q, supported: %s", errUnknownFormat, q, strings.Join(slices.Sorted(maps.Keys(formatAliases)), ", "))
+		}
+		return f, nil
+	}
+	rules, err := getClientRules()
+	if err != nil {
+		return "", err
+	}
+	r, ok := detectClient(rules, c.GetHeader("User-Agent"))
+	if !ok {
+		return formatSingBox, nil
+	}
+	if len(r.Query) > 0 {
+		q := c.Request.URL.Query()
+		for k, v := range r.Query {
+			if !q.Has(k) {
+				q.Set(k, v)
+			}
+		}
+		c.Request.URL.RawQuery = q.Encode()
+	}
+	return r.format, nil
+}
+
+// encodeProfile renders the checked sing-box profile in the requested format,
+// adding any response headers the format reports to headers.
+func encodeProfile(ctx context.Context, f string, opts option.Options, headers map[string]string) ([]byte, string, error) {
+	switch f {
+	case formatURI:
+		links, skipped, err := format.URIs(ctx, opts)
+		skippedHeader(headers, skipped)
+		if err != nil {
+			return nil, "", err
+		}
+		return format.EncodeURIs(links), "text/plain; charset=utf-8", nil
+	case formatSurge, formatLoon:
+		render := format.Surge
+		if f == formatLoon {
+			render = format.Loon
+		}
+		conf, err := render(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		skippedHeader(headers, conf.Skipped)
+		return conf.Marshal(), "text/plain; charset=utf-8", nil
+	case formatClash:
+		p, err := format.Clash(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		skippedHeader(headers, p.Skipped)
+		b, err := p.Marshal()
+		return b, "text/yaml; charset=utf-8", err
+	default:
+		b, err := singjson.MarshalContext(ctx, opts)
+		return b, "application/json; charset=utf-8", err
+	}
+}
+
+// skippedHeader reports the nodes a format could not carry in X-Skipped-Nodes.
+func skippedHeader(headers map[string]string, skipped []string) {
+	if len(skipped) == 0 {
+		return
+	}
+	// node names are rarely ASCII, so each is percent-encoded
+	names := make([]string, len(skipped))
+	for i, name := range skipped {
+		names[i] = url.PathEscape(name)
+	}
+	headers["X-Skipped-Nodes"] = strings.Join(names, ",")
+}
@@ -0,0 +1,166 @@
+package hub
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/dingdayu/go-project-template/internal/token"
+	"github.com/dingdayu/go-project-template/model/entity"
+	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
+	"github.com/spf13/viper"
+)
+
+// ImportConfig controls the one-click import links and their QR codes.
+type ImportConfig struct {
+	Name    string `mapstructure:"name"`     // profile name shown by the client; `?name=` overrides it
+	QRScale int    `mapstructure:"qr_scale"` // pixels per QR module
+}
+
+func getImportConfig() (ImportConfig, error) {
+	cfg := ImportConfig{
+		Name:    "subscription",
+		QRScale: 8,
+	}
+	if err := viper.UnmarshalKey("import", &cfg); err != nil {
+		return cfg, fmt.Errorf("hub.getImportConfig: unable to decode 'import' into struct: %v", err)
+	}
+	return cfg, nil
+}
+
+// ImportLink is the import link of one client.
+type ImportLink struct {
+	Client    string `json:"client"`
+	URL       string `json:"url"`       // client import link
+	Subscribe string `json:"subscribe"` // subscription url the link points at
+	QRPNG     string `json:"qr_png"`
+	QRSVG     string `json:"qr_svg"`
+}
+
+// importClients builds each client's import link from the subscription url,
+// in the order they are listed.
+var importClients = []struct {
+	name string
+	link func(sub, name string) (link, subscribe string)
+}{
+	{"singbox", func(sub, name string) (string, string) {
+		return "sing-box://import-remote-profile?url=" + url.QueryEscape(sub) + "#" + url.PathEscape(name), sub
+	}},
+	{"clash", func(sub, name string) (string, string) {
+		sub += "?format=clash"
+		return "clash://install-config?url=" + url.QueryEscape(sub) + "&name=" + url.QueryEscape(name), sub
+	}},
+}
+
+// Import returns the client import links of a token and where their QR codes are.
+func Import(c *gin.Context) {
+	tk, err := token.GetToken(c.Param("token"))
+	if err != nil {
+		c.String(http.StatusUnauthorized, "invalid token: %v", err)
+		return
+	}
+	cfg, err := getImportConfig()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "failed to read import config: %v", err)
+		return
+	}
+
+	name := importName(c, cfg)
+	base := PublicBaseURL(c) + "/subscribe/" + url.PathEscape(tk.Token)
+	// the QR codes carry the same name as the links
+	var query string
+	if c.Query("name") != "" {
+		query = "?name=" + url.QueryEscape(name)
+	}
+
+	links := make([]ImportLink, 0, len(importClients))
+	for _, client := range importClients {
+		link, sub := client.link(base, name)
+		links = append(links, ImportLink{
+			Client:    client.name,
+			URL:       link,
+			Subscribe: sub,
+			QRPNG:     base + "/qr/" + client.name + ".png" + query,
+			QRSVG:     base + "/qr/" + client.name + ".svg" + query,
+		})
+	}
+	c.JSON(http.StatusOK, entity.NewSucResponse(links))
+}
+
+// QRCode draws the import link of a client as /subscribe/:token/qr/<client>.png or .svg.
+func QRCode(c *gin.Context) {
+	tk, err := token.GetToken(c.Param("token"))
+	if err != nil {
+		c.String(http.StatusUnauthorized, "invalid token: %v", err)
+		return
+	}
+	cfg, err := getImportConfig()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "failed to read import config: %v", err)
+		return
+	}
+
+	file := c.Param("file")
+	ext := path.Ext(file)
+	clientName := strings.TrimSuffix(file, ext)
+	var link string
+	for _, client := range importClients {
+		if client.name == clientName {
+			link, _ = client.link(PublicBaseURL(c)+"/subscribe/"+url.PathEscape(tk.Token), importName(c, cfg))
+		}
+	}
+	if link == "" {
+		c.String(http.StatusNotFound, "unknown client %q", clientName)
+		return
+	}
+
+	code, err := qrcode.New(link, qrcode.Medium)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "failed to encode qr code: %v", err)
+		return
+	}
+	scale := max(cfg.QRScale, 1)
+	switch ext {
+	case ".png":
+		// a negative size is pixels per module
+		b, err := code.PNG(-scale)
+		if err != nil {
+			c.String(http.StatusInternalServerError, "failed to draw qr code: %v", err)
+			return
+		}
+		c.Data(http.StatusOK, "image/png", b)
+	case ".svg":
+		c.Data(http.StatusOK, "image/svg+xml", qrSVG(code.Bitmap(), scale))
+	default:
+		c.String(http.StatusNotFound, "unsupported image type %q", ext)
+	}
+}
+
+// qrSVG draws the QR bitmap (quiet zone included) as one path, scale pixels per module.
+func qrSVG(bitmap [][]bool, scale int) []byte {
+	side := len(bitmap)
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		side*scale, side*scale, side, side)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, side, side)
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&b, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	b.WriteString(`"/></svg>`)
+	return b.Bytes()
+}
+
+func importName(c *gin.Context, cfg ImportConfig) string {
+	if v := c.Query("name"); v != "" {
+		return v
+	}
+	return cfg.Name
+}
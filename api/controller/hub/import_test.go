@@ -0,0 +1,129 @@
+package hub
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+func importRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	viper.Set("tokens", []map[string]any{{"token": "t1"}})
+	viper.Set("app.public_url", "https://sub.example.com/")
+	t.Cleanup(func() {
+		viper.Set("tokens", nil)
+		viper.Set("app.public_url", "")
+	})
+	r := gin.New()
+	r.GET("/subscribe/:token/import", Import)
+	r.GET("/subscribe/:token/qr/:file", QRCode)
+	return r
+}
+
+func TestImport(t *testing.T) {
+	r := importRouter(t)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/subscribe/t1/import?name=My%20Sub", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data []ImportLink `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := []ImportLink{
+		{
+			Client:    "singbox",
+			URL:       "sing-box://import-remote-profile?url=https%3A%2F%2Fsub.example.com%2Fsubscribe%2Ft1#My%20Sub",
+			Subscribe: "https://sub.example.com/subscribe/t1",
+			QRPNG:     "https://sub.example.com/subscribe/t1/qr/singbox.png?name=My+Sub",
+			QRSVG:     "https://sub.example.com/subscribe/t1/qr/singbox.svg?name=My+Sub",
+		},
+		{
+			Client:    "clash",
+			URL:       "clash://install-config?url=https%3A%2F%2Fsub.example.com%2Fsubscribe%2Ft1%3Fformat%3Dclash&name=My+Sub",
+			Subscribe: "https://sub.example.com/subscribe/t1?format=clash",
+			QRPNG:     "https://sub.example.com/subscribe/t1/qr/clash.png?name=My+Sub",
+			QRSVG:     "https://sub.example.com/subscribe/t1/qr/clash.svg?name=My+Sub",
+		},
+	}
+	if len(resp.Data) != len(want) {
+		t.Fatalf("got %+v", resp.Data)
+	}
+	for i := range want {
+		if resp.Data[i] != want[i] {
+			t.Errorf("link %d = %+v, want %+v", i, resp.Data[i], want[i])
+		}
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/subscribe/nope/import", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("unknown token: status %d", w.Code)
+	}
+}
+
+func TestQRCode(t *testing.T) {
+	r := importRouter(t)
+	tests := []struct {
+		path        string
+		status      int
+		contentType string
+	}{
+		{"/subscribe/t1/qr/singbox.png", http.StatusOK, "image/png"},
+		{"/subscribe/t1/qr/clash.svg", http.StatusOK, "image/svg+xml"},
+		{"/subscribe/t1/qr/clash.gif", http.StatusNotFound, ""},
+		{"/subscribe/t1/qr/foo.png", http.StatusNotFound, ""},
+		{"/subscribe/nope/qr/clash.png", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.path, w.Code, tt.status)
+			continue
+		}
+		if tt.contentType == "" {
+			continue
+		}
+		if ct := w.Header().Get("Content-Type"); ct != tt.contentType {
+			t.Errorf("%s: content type %q", tt.path, ct)
+		}
+		switch tt.contentType {
+		case "image/png":
+			img, err := png.Decode(bytes.NewReader(w.Body.Bytes()))
+			if err != nil {
+				t.Errorf("%s: %v", tt.path, err)
+			} else if b := img.Bounds(); b.Dx() != b.Dy() || b.Dx()%8 != 0 {
+				t.Errorf("%s: %dx%d is not a square of 8px modules", tt.path, b.Dx(), b.Dy())
+			}
+		case "image/svg+xml":
+			if !strings.HasPrefix(w.Body.String(), "<svg") || !strings.Contains(w.Body.String(), "h1v1h-1z") {
+				t.Errorf("%s: %.80s", tt.path, w.Body)
+			}
+		}
+	}
+}
+
+func TestQRSVG(t *testing.T) {
+	svg := string(qrSVG([][]bool{{true, false}, {false, true}}, 3))
+	for _, want := range []string{`width="6"`, `viewBox="0 0 2 2"`, "M0 0h1v1h-1z", "M1 1h1v1h-1z"} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("svg lacks %q: %s", want, svg)
+		}
+	}
+	if strings.Contains(svg, "M1 0") {
+		t.Errorf("light module drawn: %s", svg)
+	}
+}
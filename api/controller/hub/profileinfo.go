@@ -0,0 +1,54 @@
+package hub
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/dingdayu/go-project-template/internal/upstream"
+	"github.com/spf13/viper"
+)
+
+// ProfileInfoConfig controls the headers that tell clients about the
+// subscription: traffic and expiry, refresh interval and profile name.
+type ProfileInfoConfig struct {
+	Userinfo       bool   `mapstructure:"userinfo"`        // aggregated Subscription-Userinfo of the upstreams
+	UpdateInterval int    `mapstructure:"update_interval"` // hours, profile-update-interval; 0 omits it
+	Filename       string `mapstructure:"filename"`        // content-disposition name without extension; empty omits it
+}
+
+func getProfileInfoConfig() (ProfileInfoConfig, error) {
+	cfg := ProfileInfoConfig{
+		Userinfo:       true,
+		UpdateInterval: 24,
+		Filename:       "subscription",
+	}
+	if err := viper.UnmarshalKey("profile_info", &cfg); err != nil {
+		return cfg, fmt.Errorf("hub.getProfileInfoConfig: unable to decode 'profile_info' into struct: %v", err)
+	}
+	return cfg, nil
+}
+
+// formatExtensions names the downloaded profile per format.
+var formatExtensions = map[string]string{
+	formatSingBox: ".json",
+	formatClash:   ".yaml",
+	formatURI:     ".txt",
+	formatSurge:   ".conf",
+	formatLoon:    ".conf",
+}
+
+// profileInfoHeaders adds the Subscription-Userinfo, profile-update-interval
+// and content-disposition headers to headers.
+func profileInfoHeaders(headers map[string]string, cfg ProfileInfoConfig, f string, info *upstream.Userinfo) {
+	if cfg.Userinfo && info != nil {
+		headers[upstream.UserinfoHeader] = info.String()
+	}
+	if cfg.UpdateInterval > 0 {
+		headers["Profile-Update-Interval"] = strconv.Itoa(cfg.UpdateInterval)
+	}
+	if cfg.Filename != "" {
+		name := cfg.Filename + formatExtensions[f]
+		headers["Content-Disposition"] = fmt.Sprintf("attachment; filename=%q; filename*=UTF-8''%s", name, url.PathEscape(name))
+	}
+}
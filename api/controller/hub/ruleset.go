@@ -0,0 +1,62 @@
+package hub
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/dingdayu/go-project-template/internal/ruleset"
+	"github.com/dingdayu/go-project-template/internal/token"
+	"github.com/gin-gonic/gin"
+)
+
+// RuleSet serves a mirrored or managed `.srs` rule set, answering 304 when the
+// client's copy is current and redirecting to the upstream while it is not
+// mirrored yet. Managed rule sets need a subscription token in `?token=`.
+func RuleSet(c *gin.Context) {
+	tag := strings.TrimSuffix(c.Param("file"), ".srs")
+
+	cacheControl := "public, max-age=3600"
+	e, ok := ruleset.Get(tag)
+	if !ok {
+		managed, found, err := ruleset.Managed(c.Request.Context(), tag)
+		if err != nil {
+			c.String(http.StatusInternalServerError, "failed to compile rule set: %v", err)
+			return
+		}
+		if !found {
+			if source, ok := ruleset.Source(tag); ok {
+				c.Redirect(http.StatusFound, source)
+				return
+			}
+			c.String(http.StatusNotFound, "rule set not found: %s", tag)
+			return
+		}
+		if _, err := token.GetToken(c.Query("token")); err != nil {
+			c.String(http.StatusUnauthorized, "invalid token: %v", err)
+			return
+		}
+		e = managed
+		cacheControl = "private, max-age=3600"
+	}
+
+	c.Header("ETag", e.ETag)
+	c.Header("Last-Modified", e.UpdatedAt.UTC().Format(http.TimeFormat))
+	c.Header("Cache-Control", cacheControl)
+	if etagMatch(c.GetHeader("If-None-Match"), e.ETag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/octet-stream", e.Content)
+}
+
+// etagMatch reports whether an If-None-Match header value matches etag.
+func etagMatch(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+func TestRuleSetManagedNeedsToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	viper.Set("tokens", []map[string]any{{"token": "t1"}})
+	viper.Set("rule_set.managed", []map[string]any{{"tag": "intranet", "mode": "remote", "domain_suffix": []string{"corp.example"}}})
+	t.Cleanup(func() {
+		viper.Set("tokens", nil)
+		viper.Set("rule_set.managed", nil)
+	})
+	r := gin.New()
+	r.GET("/rules/:file", RuleSet)
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/rules/intranet.srs", http.StatusUnauthorized},
+		{"/rules/intranet.srs?token=nope", http.StatusUnauthorized},
+		{"/rules/intranet.srs?token=t1", http.StatusOK},
+		{"/rules/missing.srs?token=t1", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.path, w.Code, tt.status, w.Body)
+			continue
+		}
+		if w.Code == http.StatusOK && w.Header().Get("Cache-Control") != "private, max-age=3600" {
+			t.Errorf("%s: Cache-Control %q", tt.path, w.Header().Get("Cache-Control"))
+		}
+	}
+}
+
+func TestRuleSetNotModified(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	viper.Set("tokens", []map[string]any{{"token": "t1"}})
+	viper.Set("rule_set.managed", []map[string]any{{"tag": "intranet", "mode": "remote", "domain_suffix": []string{"corp.example"}}})
+	t.Cleanup(func() {
+		viper.Set("tokens", nil)
+		viper.Set("rule_set.managed", nil)
+	})
+	r := gin.New()
+	r.GET("/rules/:file", RuleSet)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/rules/intranet.srs?token=t1", nil))
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" || w.Body.Len() == 0 {
+		t.Fatalf("status %d, ETag %q", w.Code, etag)
+	}
+
+	for _, header := range []string{etag, "W/" + etag, `"stale", ` + etag} {
+		req := httptest.NewRequest(http.MethodGet, "/rules/intranet.srs?token=t1", nil)
+		req.Header.Set("If-None-Match", header)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Errorf("If-None-Match %s: status %d", header, w.Code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/rules/intranet.srs?token=t1", nil)
+	req.Header.Set("If-None-Match", `"stale"`)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("stale ETag: status %d", w.Code)
+	}
+}
@@ -0,0 +1,383 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
+
+	"github.com/dingdayu/go-project-template/internal/proxy"
+	"github.com/dingdayu/go-project-template/internal/ruleset"
+	"github.com/dingdayu/go-project-template/internal/singbox"
+	"github.com/dingdayu/go-project-template/internal/token"
+	"github.com/dingdayu/go-project-template/internal/upstream"
+	"github.com/gin-gonic/gin"
+	"github.com/sagernet/sing-box/option"
+	"github.com/spf13/viper"
+	"resty.dev/v3"
+)
+
+// SubConfig controls the subconverter compatible /sub endpoint.
+type SubConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// TemplatesDir holds the sing-box profiles `config=` may name, used as the
+	// base profile like a pass_through upstream.
+	TemplatesDir string `mapstructure:"templates_dir"`
+	Timeout      int    `mapstructure:"timeout"`  // seconds, for fetching all urls
+	MaxURLs      int    `mapstructure:"max_urls"` // urls per request
+	// AllowedNetworks are the loopback, link-local and private addresses
+	// (CIDRs or IPs) urls may still point at; all others are refused.
+	AllowedNetworks []string `mapstructure:"allowed_networks"`
+}
+
+func getSubConfig() (SubConfig, error) {
+	cfg := SubConfig{
+		TemplatesDir: "./data/templates",
+		Timeout:      30,
+		MaxURLs:      10,
+	}
+	if err := viper.UnmarshalKey("sub", &cfg); err != nil {
+		return cfg, fmt.Errorf("hub.getSubConfig: unable to decode 'sub' into struct: %v", err)
+	}
+	return cfg, nil
+}
+
+// subTargets maps subconverter's target names onto our formats.
+var subTargets = map[string]string{
+	"clash":     formatClash,
+	"clashr":    formatClash,
+	"clashmeta": formatClash,
+	"mihomo":    formatClash,
+	"singbox":   formatSingBox,
+	"sing-box":  formatSingBox,
+	"mixed":     formatURI,
+	"v2ray":     formatURI,
+	"uri":       formatURI,
+	"surge":     formatSurge,
+	"loon":      formatLoon,
+}
+
+// Sub implements subconverter's query interface:
+// /sub?token=t&target=clash&url=a|b&include=re&exclude=re&rename=old@new`...&emoji=true&config=name
+// It needs a valid token and fetches only public addresses, except for the
+// allowed networks.
+func Sub(c *gin.Context) {
+	cfg, err := getSubConfig()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "failed to read sub config: %v", err)
+		return
+	}
+	if !cfg.Enabled {
+		c.String(http.StatusNotFound, "sub is disabled")
+		return
+	}
+	if _, err := token.GetToken(c.Query("token")); err != nil {
+		c.String(http.StatusUnauthorized, "invalid token: %v", err)
+		return
+	}
+	allowed, err := parseNetworks(cfg.AllowedNetworks)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "invalid sub.allowed_networks: %v", err)
+		return
+	}
+
+	f, ok := subTargets[strings.ToLower(c.Query("target"))]
+	if !ok {
+		c.String(http.StatusBadRequest, "unsupported target %q", c.Query("target"))
+		return
+	}
+
+	var urls []string
+	for _, u := range strings.Split(c.Query("url"), "|") {
+		if u = strings.TrimSpace(u); u == "" {
+			continue
+		}
+		// only remote subscriptions, never local files
+		if p, err := url.Parse(u); err != nil || (p.Scheme != "http" && p.Scheme != "https") {
+			c.String(http.StatusBadRequest, "invalid url %q", u)
+			return
+		}
+		urls = append(urls, u)
+	}
+	if len(urls) == 0 {
+		c.String(http.StatusBadRequest, "missing url")
+		return
+	}
+	if len(urls) > cfg.MaxURLs {
+		c.String(http.StatusBadRequest, "too many urls: %d > %d", len(urls), cfg.MaxURLs)
+		return
+	}
+
+	var include, exclude *regexp.Regexp
+	for name, re := range map[string]**regexp.Regexp{"include": &include, "exclude": &exclude} {
+		if v := c.Query(name); v != "" {
+			if *re, err = regexp.Compile(v); err != nil {
+				c.String(http.StatusBadRequest, "invalid %s: %v", name, err)
+				return
+			}
+		}
+	}
+	renames, err := parseRename(c.Query("rename"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "invalid rename: %v", err)
+		return
+	}
+	addEmoji, removeEmoji, err := parseEmoji(c)
+	if err != nil {
+		c.String(http.StatusBadRequest, "invalid emoji: %v", err)
+		return
+	}
+
+	var base []byte
+	if name := c.Query("config"); name != "" {
+		if base, err = readTemplate(cfg.TemplatesDir, name); err != nil {
+			c.String(http.StatusBadRequest, "invalid config: %v", err)
+			return
+		}
+	}
+
+	queryInbounds, err := singbox.InboundOverrideFromQuery(c.Request.URL.Query())
+	if err != nil {
+		c.String(http.StatusBadRequest, "invalid inbound parameters: %v", err)
+		return
+	}
+	if len(base) > 0 && len(queryInbounds) > 0 {
+		c.String(http.StatusBadRequest, "inbound parameters are not supported with config")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(cfg.Timeout)*time.Second)
+	defer cancel()
+	client := guardedClient(allowed)
+	defer client.Close()
+	var ots []upstream.ProxyOutbound
+	var info *upstream.Userinfo
+	for _, u := range urls {
+		fetched := proxy.FetchUpstreamsWith(ctx, client, proxy.Upstream{URL: u})
+		ots = append(ots, fetched.Outbounds...)
+		if fetched.Userinfo != nil {
+			if info == nil {
+				info = &upstream.Userinfo{}
+			}
+			*info = info.Add(*fetched.Userinfo)
+		}
+	}
+
+	// filter on the upstream names, then rename, as subconverter does
+	seen := make(map[string]int)
+	var nodes []upstream.ProxyOutbound
+	for _, ot := range ots {
+		name := ot.Name()
+		if include != nil && !include.MatchString(name) || exclude != nil && exclude.MatchString(name) {
+			continue
+		}
+		for _, r := range renames {
+			name = r.pattern.ReplaceAllString(name, r.replace)
+		}
+		if removeEmoji {
+			name = stripEmoji(name)
+		}
+		if addEmoji {
+			if flag := singbox.RegionFlag(singbox.DetectRegion(name)); flag != "" {
+				name = flag + " " + name
+			}
+		}
+		// outbound tags must be unique across the merged subscriptions
+		if seen[name]++; seen[name] > 1 {
+			name += " " + strconv.Itoa(seen[name])
+		}
+		nodes = append(nodes, upstream.Rename(ot, name))
+	}
+	if len(nodes) == 0 {
+		c.String(http.StatusInternalServerError, "no outbound available")
+		return
+	}
+
+	baseURL := PublicBaseURL(c)
+	if f != formatSingBox {
+		baseURL = ""
+	}
+	opts, ok := checkedProfile(c, nodes, func(ots []upstream.ProxyOutbound) (option.Options, error) {
+		if len(base) > 0 {
+			return singbox.PassThroughProfile(base, ots)
+		}
+		managed, err := ruleset.ManagedRuleSets(c.Request.Context())
+		if err != nil {
+			return option.Options{}, err
+		}
+		// without a profile token the managed rule sets stay inline
+		return singbox.OutboundToProfile(ots, singbox.ProfileOptions{
+			BaseURL:  baseURL,
+			Inbounds: []map[string]any{queryInbounds},
+			Managed:  managed,
+		})
+	})
+	if !ok {
+		return
+	}
+
+	headers := make(map[string]string)
+	infoCfg, err := getProfileInfoConfig()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "failed to read profile info config: %v", err)
+		return
+	}
+	profileInfoHeaders(headers, infoCfg, f, info)
+	payload, contentType, err := encodeProfile(c.Request.Context(), f, opts, headers)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "failed to encode profile: %v", err)
+		return
+	}
+	for k, v := range headers {
+		c.Header(k, v)
+	}
+	c.Data(http.StatusOK, contentType, payload)
+}
+
+type rename struct {
+	pattern *regexp.Regexp
+	replace string
+}
+
+// parseRename reads subconverter's "pattern@replacement" pairs, separated by backticks.
+func parseRename(s string) ([]rename, error) {
+	var out []rename
+	for _, pair := range strings.Split(s, "`") {
+		if pair == "" {
+			continue
+		}
+		pattern, replace, ok := strings.Cut(pair, "@")
+		if !ok {
+			return nil, fmt.Errorf("%q: want pattern@replacement", pair)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rename{pattern: re, replace: replace})
+	}
+	return out, nil
+}
+
+// parseEmoji reads `emoji` (replace the leading emoji by the region flag, or
+// keep it as is) and the finer add_emoji / remove_emoji switches, which
+// override it.
+func parseEmoji(c *gin.Context) (add, remove bool, err error) {
+	for _, p := range []struct {
+		name    string
+		targets []*bool
+	}{
+		{"emoji", []*bool{&add, &remove}},
+		{"add_emoji", []*bool{&add}},
+		{"remove_emoji", []*bool{&remove}},
+	} {
+		v := c.Query(p.name)
+		if v == "" {
+			continue
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return false, false, fmt.Errorf("%s: %w", p.name, err)
+		}
+		for _, target := range p.targets {
+			*target = b
+		}
+	}
+	return add, remove, nil
+}
+
+// stripEmoji removes the emoji (flags, symbols) a node name starts with.
+func stripEmoji(name string) string {
+	return strings.TrimLeftFunc(name, func(r rune) bool {
+		return r >= 0x1F000 || unicode.Is(unicode.So, r) || r == 0xFE0F || r == 0x200D || unicode.IsSpace(r)
+	})
+}
+
+// readTemplate loads the sing-box profile `name` (optionally without .json) from dir.
+func readTemplate(dir, name string) ([]byte, error) {
+	if name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("%q is not a template name", name)
+	}
+	for _, file := range []string{name, name + ".json"} {
+		b, err := os.ReadFile(filepath.Join(dir, file))
+		if err == nil {
+			return b, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("template %q not found", name)
+}
+
+// parseNetworks reads CIDRs and single IPs.
+func parseNetworks(networks []string) ([]netip.Prefix, error) {
+	out := make([]netip.Prefix, 0, len(networks))
+	for _, n := range networks {
+		if p, err := netip.ParsePrefix(n); err == nil {
+			out = append(out, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(n)
+		if err != nil {
+			return nil, fmt.Errorf("%q is neither a CIDR nor an IP", n)
+		}
+		out = append(out, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return out, nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), private in practice.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// publicAddr reports whether addr may be fetched: not loopback, link-local,
+// private or unspecified, unless one of the allowed networks holds it.
+func publicAddr(addr netip.Addr, allowed []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, p := range allowed {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return !(addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsMulticast() || sharedAddressSpace.Contains(addr))
+}
+
+// guardedClient returns an http client that refuses to connect to non-public
+// addresses. The check runs on the resolved address of every connection, so
+// redirects and DNS answers cannot get around it; proxies from the
+// environment are not used for the same reason.
+func guardedClient(allowed []netip.Prefix) *resty.Client {
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !publicAddr(ap.Addr(), allowed) {
+				return fmt.Errorf("address %s is not allowed", ap.Addr())
+			}
+			return nil
+		},
+	}
+	return resty.New().SetTransport(&http.Transport{
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	})
+}
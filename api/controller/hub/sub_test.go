@@ -0,0 +1,101 @@
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPublicAddr(t *testing.T) {
+	allowed, err := parseNetworks([]string{"10.1.0.0/16", "127.0.0.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"1.1.1.1", true},
+		{"2606:4700::1111", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"0.0.0.0", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"192.168.1.1", false},
+		{"172.16.0.1", false},
+		{"fd00::1", false},
+		{"100.100.100.200", false},
+		{"10.2.0.1", false},
+		{"10.1.2.3", true},
+		{"127.0.0.2", true},
+	}
+	for _, tt := range tests {
+		if got := publicAddr(netip.MustParseAddr(tt.addr), allowed); got != tt.want {
+			t.Errorf("publicAddr(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestParseNetworks(t *testing.T) {
+	if _, err := parseNetworks([]string{"example.com"}); err == nil {
+		t.Error("hostname accepted")
+	}
+	got, err := parseNetworks([]string{"10.1.2.3/16", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0].String() != "10.1.0.0/16" || got[1].String() != "::1/128" {
+		t.Errorf("parseNetworks = %v", got)
+	}
+}
+
+func TestParseRename(t *testing.T) {
+	renames, err := parseRename("HK@Hong Kong`\\s+@ ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := "HK   01"
+	for _, r := range renames {
+		name = r.pattern.ReplaceAllString(name, r.replace)
+	}
+	if name != "Hong Kong 01" {
+		t.Errorf("renamed to %q", name)
+	}
+	if _, err := parseRename("no-separator"); err == nil {
+		t.Error("pair without @ accepted")
+	}
+}
+
+func TestParseEmoji(t *testing.T) {
+	tests := []struct {
+		query       string
+		add, remove bool
+		err         bool
+	}{
+		{"", false, false, false},
+		{"emoji=true", true, true, false},
+		{"emoji=false", false, false, false},
+		{"remove_emoji=1", false, true, false},
+		{"add_emoji=1", true, false, false},
+		{"emoji=1&remove_emoji=0", true, false, false},
+		{"emoji=0&add_emoji=1", true, false, false},
+		{"emoji=maybe", false, false, true},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/sub?"+tt.query, nil)
+		add, remove, err := parseEmoji(c)
+		if (err != nil) != tt.err {
+			t.Errorf("%q: err %v", tt.query, err)
+			continue
+		}
+		if add != tt.add || remove != tt.remove {
+			t.Errorf("%q: add %v remove %v, want %v %v", tt.query, add, remove, tt.add, tt.remove)
+		}
+	}
+}
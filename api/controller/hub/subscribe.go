@@ -1,43 +1,246 @@
 package hub
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/dingdayu/go-project-template/internal/proxy"
+	"github.com/dingdayu/go-project-template/internal/render"
+	"github.com/dingdayu/go-project-template/internal/ruleset"
 	"github.com/dingdayu/go-project-template/internal/singbox"
 	"github.com/dingdayu/go-project-template/internal/token"
 	"github.com/dingdayu/go-project-template/internal/upstream"
 	"github.com/gin-gonic/gin"
-	singjson "github.com/sagernet/sing/common/json"
+	"github.com/sagernet/sing-box/option"
 )
 
 func Subscribe(c *gin.Context) {
 	tks := c.Param("token")
 
-	_, err := token.GetToken(tks)
+	tk, err := token.GetToken(tks)
 	if err != nil {
 		c.String(http.StatusUnauthorized, "invalid token: %v", err)
 		return
 	}
 
-	ots := proxy.GetOutbounds[upstream.ProxyOutbound]()
+	// the answer depends on the client unless ?format= is given
+	c.Header("Vary", "User-Agent")
+	f, err := profileFormat(c)
+	if errors.Is(err, errUnknownFormat) {
+		c.String(http.StatusBadRequest, "%v", err)
+		return
+	}
+	if err != nil {
+		c.String(http.StatusInternalServerError, "failed to detect client: %v", err)
+		return
+	}
+
+	queryInbounds, err := singbox.InboundOverrideFromQuery(c.Request.URL.Query(), tk.Inbounds)
+	if err != nil {
+		c.String(http.StatusBadRequest, "invalid inbound parameters: %v", err)
+		return
+	}
+	// the pass-through profile keeps the upstream's own inbounds
+	base := proxy.GetPassThrough(tk.Upstreams)
+	if len(base) > 0 && (len(tk.Inbounds) > 0 || len(queryInbounds) > 0) {
+		c.String(http.StatusBadRequest, "inbound overrides are not supported with a pass-through upstream")
+		return
+	}
+
+	// the format, query and base url select the variant (inbounds, mirror urls) of the token's profile
+	key := render.Key(proxy.Version(), tk.Token, f, c.Request.URL.Query().Encode(), PublicBaseURL(c))
+	if e, ok := render.Get(key); ok {
+		writeEntry(c, e)
+		return
+	}
+
+	ots := tokenOutbounds(tk)
 
 	if len(ots) == 0 {
 		c.String(http.StatusInternalServerError, "no outbound available")
 		return
 	}
 
-	opts, err := singbox.OutboundToProfile(ots)
+	routings := proxy.GetRoutings()
+	if len(base) > 0 {
+		// pass-through: the upstream profile already carries routing, so none is merged in
+		routings = nil
+	}
+
+	opts, ok := checkedProfile(c, ots, func(ots []upstream.ProxyOutbound) (option.Options, error) {
+		return renderProfile(c, tk, f, base, ots, routings, queryInbounds)
+	})
+	if !ok {
+		return
+	}
+
+	// report upstream rules that could not be carried over
+	headers := make(map[string]string)
+	unsupported := 0
+	for _, r := range routings {
+		unsupported += len(r.Unsupported)
+	}
+	if unsupported > 0 {
+		headers["X-Unsupported-Rules"] = strconv.Itoa(unsupported)
+	}
+
+	infoCfg, err := getProfileInfoConfig()
 	if err != nil {
-		c.String(http.StatusInternalServerError, "failed to convert outbounds to profile: %v", err)
+		c.String(http.StatusInternalServerError, "failed to read profile info config: %v", err)
 		return
 	}
+	profileInfoHeaders(headers, infoCfg, f, proxy.GetUserinfo(tk.Upstreams))
 
-	payload, err := singjson.MarshalContext(c.Request.Context(), opts)
+	payload, contentType, err := encodeProfile(c.Request.Context(), f, opts, headers)
 	if err != nil {
-		c.String(http.StatusInternalServerError, "failed to marshal profile: %v", err)
+		c.String(http.StatusInternalServerError, "failed to encode profile: %v", err)
 		return
 	}
 
-	c.Data(http.StatusOK, "application/json; charset=utf-8", payload)
+	writeEntry(c, render.Put(key, payload, contentType, headers))
+}
+
+// checkedProfile renders the profile of ots and runs the sing-box check on
+// it, dropping rejected nodes when configured. On failure it writes the error
+// response and returns false.
+func checkedProfile(c *gin.Context, ots []upstream.ProxyOutbound, render func([]upstream.ProxyOutbound) (option.Options, error)) (option.Options, bool) {
+	checkCfg, err := singbox.GetCheckConfig()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "failed to read check config: %v", err)
+		return option.Options{}, false
+	}
+
+	for {
+		opts, err := render(ots)
+		if err != nil {
+			c.String(http.StatusInternalServerError, "failed to render profile: %v", err)
+			return opts, false
+		}
+		if !checkCfg.Enabled {
+			return opts, true
+		}
+		err = singbox.CheckProfile(c.Request.Context(), opts)
+		if err == nil {
+			return opts, true
+		}
+		var pe *singbox.ProfileError
+		if !errors.As(err, &pe) {
+			c.String(http.StatusInternalServerError, "failed to check profile: %v", err)
+			return opts, false
+		}
+		// drop the rejected node and render again; anything else is our own bug
+		if checkCfg.DropInvalid && pe.Section == "outbound" {
+			if rest, ok := dropOutbound(ots, pe.Tag); ok && len(rest) > 0 {
+				log.Printf("hub: dropping invalid node %q: %s", pe.Tag, pe.Message)
+				ots = rest
+				continue
+			}
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "generated profile is invalid", "detail": pe})
+		return opts, false
+	}
+}
+
+// writeEntry writes a rendered profile, answering 304 when the client's copy is current.
+func writeEntry(c *gin.Context, e *render.Entry) {
+	for k, v := range e.Headers {
+		c.Header(k, v)
+	}
+	c.Header("ETag", e.ETag)
+	c.Header("Cache-Control", "no-cache")
+	if etagMatch(c.GetHeader("If-None-Match"), e.ETag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, e.ContentType, e.Body)
+}
+
+// renderProfile builds the token's profile from ots, through the pass-through
+// base when the token may use one, and applies the token's overrides.
+func renderProfile(c *gin.Context, tk token.Token, f string, base []byte, ots []upstream.ProxyOutbound, routings []upstream.Routing, queryInbounds map[string]any) (option.Options, error) {
+	var opts option.Options
+	var err error
+	// other clients cannot load .srs files, so keep managed rule sets inline for them
+	baseURL := PublicBaseURL(c)
+	if f != formatSingBox {
+		baseURL = ""
+	}
+	if len(base) > 0 {
+		opts, err = singbox.PassThroughProfile(base, ots)
+	} else {
+		var managed []singbox.ManagedRuleSet
+		if managed, err = ruleset.ManagedRuleSets(c.Request.Context()); err != nil {
+			return opts, err
+		}
+		opts, err = singbox.OutboundToProfile(ots, singbox.ProfileOptions{
+			Token:    tk.Token,
+			BaseURL:  baseURL,
+			Inbounds: []map[string]any{tk.Inbounds, queryInbounds},
+			Routings: routings,
+			Groups:   proxy.GetProxyGroups(),
+			Usage:    tokenUsage(tk),
+			Managed:  managed,
+		})
+	}
+	if err != nil {
+		return opts, err
+	}
+	return singbox.ApplyOverrides(c.Request.Context(), opts, tk.Overrides)
+}
+
+// dropOutbound returns ots without the node whose outbound tag is tag.
+func dropOutbound(ots []upstream.ProxyOutbound, tag string) ([]upstream.ProxyOutbound, bool) {
+	for i, ot := range ots {
+		if to, err := ot.ToOutbound(); err == nil && to.Tag == tag {
+			return slices.Delete(slices.Clone(ots), i, i+1), true
+		}
+	}
+	return ots, false
+}
+
+// tokenUsage returns the traffic and expiry of the providers behind the token's upstreams.
+func tokenUsage(tk token.Token) []singbox.Usage {
+	var usages []singbox.Usage
+	for _, st := range proxy.GetUpstreamStatus() {
+		if st.Userinfo == nil {
+			continue
+		}
+		if len(tk.Upstreams) > 0 && !slices.Contains(tk.Upstreams, st.URL) && (st.Name == "" || !slices.Contains(tk.Upstreams, st.Name)) {
+			continue
+		}
+		usages = append(usages, singbox.Usage{Name: st.Name, Userinfo: *st.Userinfo})
+	}
+	return usages
+}
+
+// tokenOutbounds returns the nodes the token may use: from its allowed
+// upstreams, with a name matching its keywords and none of its exclude
+// keywords, and of an allowed protocol. Empty lists do not restrict.
+func tokenOutbounds(tk token.Token) []upstream.ProxyOutbound {
+	ots := proxy.GetOutbounds[upstream.ProxyOutbound]()
+	if len(tk.Upstreams) > 0 {
+		ots = proxy.GetOutboundsFrom(tk.Upstreams)
+	}
+
+	var out []upstream.ProxyOutbound
+	for _, ot := range ots {
+		if len(tk.Keywords) > 0 && !proxy.AnyContained(ot.Name(), tk.Keywords) {
+			continue
+		}
+		if len(tk.ExcludeKeywords) > 0 && proxy.AnyContained(ot.Name(), tk.ExcludeKeywords) {
+			continue
+		}
+		if len(tk.Protocols) > 0 {
+			to, err := ot.ToOutbound()
+			if err != nil || !slices.ContainsFunc(tk.Protocols, func(p string) bool { return strings.EqualFold(p, to.Type) }) {
+				continue
+			}
+		}
+		out = append(out, ot)
+	}
+	return out
 }
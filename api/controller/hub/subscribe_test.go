@@ -0,0 +1,190 @@
+package hub
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/dingdayu/go-project-template/internal/proxy"
+	"github.com/dingdayu/go-project-template/internal/render"
+	"github.com/dingdayu/go-project-template/internal/singbox"
+	"github.com/dingdayu/go-project-template/internal/token"
+	"github.com/dingdayu/go-project-template/internal/upstream"
+	"github.com/gin-gonic/gin"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"github.com/spf13/viper"
+)
+
+func TestWriteEntry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e := &render.Entry{Body: []byte("{}"), ContentType: "application/json", ETag: `"abc"`, Headers: map[string]string{"X-Skipped-Nodes": "1"}}
+	r := gin.New()
+	r.GET("/", func(c *gin.Context) { writeEntry(c, e) })
+
+	tests := []struct {
+		ifNoneMatch string
+		status      int
+	}{
+		{"", http.StatusOK},
+		{`"other"`, http.StatusOK},
+		{`"abc"`, http.StatusNotModified},
+		{`W/"abc"`, http.StatusNotModified},
+		{`"other", "abc"`, http.StatusNotModified},
+		{"*", http.StatusNotModified},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", tt.ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("If-None-Match %q: status %d, want %d", tt.ifNoneMatch, w.Code, tt.status)
+		}
+		if w.Header().Get("ETag") != `"abc"` || w.Header().Get("X-Skipped-Nodes") != "1" {
+			t.Errorf("If-None-Match %q: headers %v", tt.ifNoneMatch, w.Header())
+		}
+		if body := w.Body.String(); (tt.status == http.StatusOK) != (body == "{}") {
+			t.Errorf("If-None-Match %q: body %q", tt.ifNoneMatch, body)
+		}
+	}
+}
+
+func TestTokenOutbounds(t *testing.T) {
+	profiles := map[string]string{
+		"/a": `
+proxies:
+  - {name: US 01, type: ss, server: 192.0.2.1, port: 1, cipher: aes-128-gcm, password: x}
+  - {name: HK 02 NF, type: trojan, server: 192.0.2.2, port: 443, password: x}
+  - {name: HK 03, type: ss, server: 192.0.2.3, port: 1, cipher: aes-128-gcm, password: x}
+`,
+		"/b": `
+proxies:
+  - {name: JP 04, type: ss, server: 192.0.2.4, port: 1, cipher: aes-128-gcm, password: x}
+`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(profiles[r.URL.Path]))
+	}))
+	t.Cleanup(srv.Close)
+
+	viper.Set("upstreams", []map[string]any{
+		{"name": "main", "url": srv.URL + "/a"},
+		{"url": srv.URL + "/b"},
+	})
+	t.Cleanup(func() {
+		viper.Set("upstreams", nil)
+		if err := proxy.Reload(); err != nil {
+			t.Error(err)
+		}
+	})
+	if err := proxy.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	// both upstreams are fetched in the background
+	for deadline := time.Now().Add(5 * time.Second); len(proxy.GetOutbounds[upstream.ProxyOutbound]()) < 4; {
+		if time.Now().After(deadline) {
+			t.Fatal("upstreams not fetched")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	tests := []struct {
+		name string
+		tk   token.Token
+		want []string
+	}{
+		{"all", token.Token{}, []string{"US 01", "HK 02 NF", "HK 03", "JP 04"}},
+		{"keywords", token.Token{Keywords: []string{"hk", "JP"}}, []string{"HK 02 NF", "HK 03", "JP 04"}},
+		{"exclude keywords", token.Token{Keywords: []string{"HK"}, ExcludeKeywords: []string{"nf"}}, []string{"HK 03"}},
+		{"upstream by name", token.Token{Upstreams: []string{"main"}}, []string{"US 01", "HK 02 NF", "HK 03"}},
+		{"upstream by url", token.Token{Upstreams: []string{srv.URL + "/b"}}, []string{"JP 04"}},
+		{"protocols", token.Token{Protocols: []string{"Trojan"}}, []string{"HK 02 NF"}},
+		{"nothing left", token.Token{Upstreams: []string{"main"}, Keywords: []string{"JP"}}, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, ot := range tokenOutbounds(tt.tk) {
+			got = append(got, ot.Name())
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// ssNode is a shadowsocks node; an unknown method makes sing-box reject it.
+type ssNode struct{ tag, method string }
+
+func (n ssNode) Name() string { return n.tag }
+
+func (n ssNode) ToOutbound() (option.Outbound, error) {
+	return option.Outbound{Type: C.TypeShadowsocks, Tag: n.tag, Options: &option.ShadowsocksOutboundOptions{
+		ServerOptions: option.ServerOptions{Server: "192.0.2.1", ServerPort: 8388},
+		Method:        n.method,
+		Password:      "secret",
+	}}, nil
+}
+
+func TestCheckedProfile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Cleanup(func() { viper.Set("check", nil) })
+
+	nodes := []upstream.ProxyOutbound{ssNode{"good", "aes-128-gcm"}, ssNode{"bad", "no-such-method"}}
+	renderNodes := func(ots []upstream.ProxyOutbound) (option.Options, error) {
+		var opts option.Options
+		var tags []string
+		for _, ot := range ots {
+			to, err := ot.ToOutbound()
+			if err != nil {
+				return opts, err
+			}
+			opts.Outbounds = append(opts.Outbounds, to)
+			tags = append(tags, to.Tag)
+		}
+		opts.Outbounds = append(opts.Outbounds, option.Outbound{Type: C.TypeSelector, Tag: "proxy", Options: &option.SelectorOutboundOptions{Outbounds: tags}})
+		return opts, nil
+	}
+
+	tests := []struct {
+		check  map[string]any
+		ok     bool
+		status int
+		tags   []string
+	}{
+		{map[string]any{"enabled": false}, true, http.StatusOK, []string{"good", "bad", "proxy"}},
+		{map[string]any{"enabled": true}, false, http.StatusInternalServerError, nil},
+		{map[string]any{"enabled": true, "drop_invalid": true}, true, http.StatusOK, []string{"good", "proxy"}},
+	}
+	for _, tt := range tests {
+		viper.Set("check", tt.check)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+
+		opts, ok := checkedProfile(c, nodes, renderNodes)
+		if ok != tt.ok || w.Code != tt.status {
+			t.Errorf("%v: ok %v status %d: %s", tt.check, ok, w.Code, w.Body)
+			continue
+		}
+		if !ok {
+			var got struct{ Detail singbox.ProfileError }
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || got.Detail.Tag != "bad" {
+				t.Errorf("%v: error body %s", tt.check, w.Body)
+			}
+			continue
+		}
+		var tags []string
+		for _, ob := range opts.Outbounds {
+			tags = append(tags, ob.Tag)
+		}
+		if !slices.Equal(tags, tt.tags) {
+			t.Errorf("%v: outbounds %v, want %v", tt.check, tags, tt.tags)
+		}
+	}
+}
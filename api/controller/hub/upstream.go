@@ -0,0 +1,15 @@
+package hub
+
+import (
+	"net/http"
+
+	"github.com/dingdayu/go-project-template/internal/proxy"
+	"github.com/dingdayu/go-project-template/model/entity"
+	"github.com/gin-gonic/gin"
+)
+
+// Upstreams returns the status of the upstreams: node count, last fetch and
+// the traffic and expiry their providers report.
+func Upstreams(c *gin.Context) {
+	c.JSON(http.StatusOK, entity.NewSucResponse(proxy.GetUpstreamStatus()))
+}
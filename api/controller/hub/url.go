@@ -0,0 +1,30 @@
+package hub
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// PublicBaseURL returns the adapter's externally reachable base URL: the
+// configured `app.public_url`, or one derived from the request and its
+// X-Forwarded-* headers.
+func PublicBaseURL(c *gin.Context) string {
+	if u := viper.GetString("app.public_url"); u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = strings.TrimSpace(strings.Split(proto, ",")[0])
+	}
+	host := c.Request.Host
+	if fwd := c.GetHeader("X-Forwarded-Host"); fwd != "" {
+		host = strings.TrimSpace(strings.Split(fwd, ",")[0])
+	}
+	return scheme + "://" + host
+}
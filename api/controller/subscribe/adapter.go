@@ -3,6 +3,7 @@ package subscribe
 import (
 	"net/http"
 
+	"github.com/dingdayu/go-project-template/api/controller/hub"
 	"github.com/dingdayu/go-project-template/internal/singbox"
 	"github.com/dingdayu/go-project-template/internal/upstream"
 	"github.com/gin-gonic/gin"
@@ -20,6 +21,12 @@ func Adapter(c *gin.Context) {
 		return
 	}
 
+	queryInbounds, err := singbox.InboundOverrideFromQuery(c.Request.URL.Query())
+	if err != nil {
+		c.String(http.StatusBadRequest, "invalid inbound parameters: %v", err)
+		return
+	}
+
 	up := upstream.ClashVergeSubscriber{}
 	ots, err := up.Outboards(c.Request.Context(), rc, url)
 	if err != nil {
@@ -27,7 +34,10 @@ func Adapter(c *gin.Context) {
 		return
 	}
 
-	opts, err := singbox.OutboundToProfile(ots)
+	opts, err := singbox.OutboundToProfile(ots, singbox.ProfileOptions{
+		BaseURL:  hub.PublicBaseURL(c),
+		Inbounds: []map[string]any{queryInbounds},
+	})
 	if err != nil {
 		c.String(http.StatusInternalServerError, "failed to convert outbounds to profile: %v", err)
 		return
@@ -32,7 +32,8 @@ func Handler() *gin.Engine {
 	// enable recover middleware
 	handle.Use(middleware.RecoveryWithZap(logger.WithNamespace("recovery"), true))
 	// enable gzip middleware
-	handle.Use(gzip.Gzip(gzip.DefaultCompression))
+	// .srs rule sets are already compressed
+	handle.Use(gzip.Gzip(gzip.DefaultCompression, gzip.WithExcludedExtensions([]string{".srs"})))
 
 	handle.GET("/", func(c *gin.Context) {
 		file, _ := assets.IndexFS.ReadFile("index.html")
@@ -89,12 +90,18 @@ func Handler() *gin.Engine {
 
 	handle.GET("/subscribe", subscribe.Adapter)
 	handle.GET("/subscribe/:token", hub.Subscribe)
+	handle.GET("/subscribe/:token/import", hub.Import)
+	handle.GET("/subscribe/:token/qr/:file", hub.QRCode)
+	handle.GET("/sub", hub.Sub)
+	handle.GET("/rules/:file", hub.RuleSet)
 
 	api := handle.Group("/api")
 	// api.POST("/auth/login", auth.Login)
 
 	api.Use(middleware.Authorization())
 
+	api.GET("/upstreams", hub.Upstreams)
+
 	// CopilotKit 转发
 	// api.POST("copilotkit", copilotkit.Forwarder)
 
@@ -5,7 +5,10 @@ package cmd
 
 import (
 	"github.com/dingdayu/go-project-template/api"
+	"github.com/dingdayu/go-project-template/internal/alert"
 	"github.com/dingdayu/go-project-template/internal/proxy"
+	"github.com/dingdayu/go-project-template/internal/render"
+	"github.com/dingdayu/go-project-template/internal/ruleset"
 	"github.com/dingdayu/go-project-template/model/dao"
 	"github.com/dingdayu/go-project-template/pkg/config"
 	"github.com/fsnotify/fsnotify"
@@ -31,9 +34,14 @@ var httpCmd = &cobra.Command{
 			dao.Setup()
 		}
 		proxy.Setup()
-		// Register config change handler to reload proxy upstreams and tickers
+		_ = ruleset.Setup()
+		_ = alert.Setup()
+		// Register config change handler to reload proxy upstreams, rule set mirror and tickers
 		config.RegisterChangeEvent(func(e fsnotify.Event) {
 			_ = proxy.Reload()
+			_ = ruleset.Reload()
+			_ = alert.Reload()
+			render.Invalidate()
 		})
 	},
 	Run: func(cmd *cobra.Command, args []string) {
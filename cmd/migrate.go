@@ -31,7 +31,7 @@ var migrateCmd = &cobra.Command{
 		// AutoMigrate will not delete unused columns to protect your data.
 		// 参考：https://gorm.io/docs/migration.html#Auto-Migration
 
-		err := dao.GetContextDB(cmd.Context()).AutoMigrate(dao.User{})
+		err := dao.GetContextDB(cmd.Context()).AutoMigrate(dao.User{}, dao.ManagedRuleSet{})
 		if err != nil {
 			fmt.Printf("❌ Database migration failed: %v\n", err)
 			return
@@ -5,6 +5,7 @@ go 1.25
 require (
 	github.com/common-nighthawk/go-figure v0.0.0-20210622060536-734e95fb86be
 	github.com/dingdayu/async/v4 v4.1.0
+	github.com/evanphx/json-patch/v5 v5.9.11
 	github.com/fsnotify/fsnotify v1.9.0
 	github.com/gin-contrib/cors v1.7.6
 	github.com/gin-contrib/gzip v1.2.3
@@ -17,6 +18,7 @@ require (
 	github.com/sagernet/sing v0.7.12
 	github.com/sagernet/sing-box v1.12.10
 	github.com/samber/slog-multi v1.5.0
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	github.com/spf13/cobra v1.10.1
 	github.com/spf13/viper v1.21.0
 	github.com/ulule/limiter/v3 v3.11.2
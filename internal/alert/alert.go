@@ -0,0 +1,325 @@
+// Package alert watches the upstream status (traffic, expiry, fetch failures,
+// node count) and reports rule violations to webhooks.
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/dingdayu/go-project-template/internal/proxy"
+	"github.com/dingdayu/go-project-template/internal/upstream"
+	"github.com/spf13/viper"
+	"resty.dev/v3"
+)
+
+var client = resty.New()
+
+// Rule types.
+const (
+	TypeTraffic   = "traffic"    // remaining traffic below remaining_gb or remaining_percent
+	TypeExpiry    = "expiry"     // subscription expires within days
+	TypeFailing   = "failing"    // failures consecutive fetches without nodes
+	TypeNodesDrop = "nodes_drop" // node count dropped by drop_percent since the previous fetch
+)
+
+// RuleConfig is an entry of `alerts.rules`.
+type RuleConfig struct {
+	Name string `mapstructure:"name"`
+	Type string `mapstructure:"type"`
+	// Upstreams limits the rule to these upstream names or urls; empty = all.
+	Upstreams        []string `mapstructure:"upstreams"`
+	RemainingGB      float64  `mapstructure:"remaining_gb"`
+	RemainingPercent float64  `mapstructure:"remaining_percent"`
+	Days             int      `mapstructure:"days"`
+	Failures         int      `mapstructure:"failures"`
+	DropPercent      float64  `mapstructure:"drop_percent"`
+	// Message is a text/template over Event; each type has a default.
+	Message string `mapstructure:"message"`
+}
+
+// WebhookConfig is an entry of `alerts.webhooks`.
+type WebhookConfig struct {
+	URL     string            `mapstructure:"url"`
+	Headers map[string]string `mapstructure:"headers"`
+	// Body is a text/template over Event producing the request body, for
+	// webhooks expecting their own shape; empty posts the Event as JSON.
+	Body string `mapstructure:"body"`
+}
+
+// Config is the `alerts` key.
+type Config struct {
+	Enabled  bool            `mapstructure:"enabled"`
+	Interval int             `mapstructure:"interval"` // seconds between checks
+	Timeout  int             `mapstructure:"timeout"`  // seconds per webhook request
+	Repeat   time.Duration   `mapstructure:"repeat"`   // resend a still firing alert after this long; 0 = once until it clears
+	Rules    []RuleConfig    `mapstructure:"rules"`
+	Webhooks []WebhookConfig `mapstructure:"webhooks"`
+}
+
+// GetConfig reads the `alerts` key on top of the built-in defaults.
+func GetConfig() (Config, error) {
+	cfg := Config{
+		Interval: 60,
+		Timeout:  10,
+	}
+	if err := viper.UnmarshalKey("alerts", &cfg); err != nil {
+		return cfg, fmt.Errorf("alert.GetConfig: unable to decode 'alerts' into struct: %v", err)
+	}
+	return cfg, nil
+}
+
+// Event is one firing rule for one upstream, the webhook payload and the
+// data of the message and body templates.
+type Event struct {
+	Rule     string `json:"rule"`
+	Type     string `json:"type"`
+	Upstream string `json:"upstream"`
+	Message  string `json:"message"`
+	// current values; the subscription url is left out as it often holds a secret
+	Nodes       int                `json:"nodes"`
+	PrevNodes   int                `json:"prev_nodes"`
+	Failures    int                `json:"failures"`
+	Userinfo    *upstream.Userinfo `json:"userinfo,omitempty"`
+	RemainingGB float64            `json:"remaining_gb"`
+	DaysLeft    int                `json:"days_left"`
+	FiredAt     time.Time          `json:"fired_at"`
+}
+
+var defaultMessages = map[string]string{
+	TypeTraffic:   `{{.Upstream}}: {{printf "%.1f" .RemainingGB}} GB traffic left`,
+	TypeExpiry:    `{{.Upstream}}: subscription expires in {{.DaysLeft}} days`,
+	TypeFailing:   `{{.Upstream}}: {{.Failures}} consecutive fetches failed`,
+	TypeNodesDrop: `{{.Upstream}}: node count dropped from {{.PrevNodes}} to {{.Nodes}}`,
+}
+
+var (
+	masterMu     sync.Mutex
+	masterCancel context.CancelFunc
+)
+
+// fired maps rule + upstream url to when the alert was last sent. It
+// lives in memory, so a restart reports still firing alerts once more.
+var (
+	firedMu sync.Mutex
+	fired   = make(map[string]time.Time)
+)
+
+// Setup starts the check loop.
+func Setup() error {
+	return Reload()
+}
+
+// Reload re-reads the alert config and restarts the check loop.
+func Reload() error {
+	cfg, err := GetConfig()
+	if err != nil {
+		log.Printf("alert.Reload: %v", err)
+		return err
+	}
+	for _, r := range cfg.Rules {
+		if _, ok := defaultMessages[r.Type]; !ok {
+			err := fmt.Errorf("alert.Reload: rule %q: unknown type %q", r.Name, r.Type)
+			log.Print(err)
+			return err
+		}
+	}
+
+	masterMu.Lock()
+	defer masterMu.Unlock()
+	if masterCancel != nil {
+		masterCancel()
+		masterCancel = nil
+	}
+	if !cfg.Enabled || len(cfg.Rules) == 0 || len(cfg.Webhooks) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	masterCancel = cancel
+	go checkLoop(ctx, cfg)
+	return nil
+}
+
+func checkLoop(ctx context.Context, cfg Config) {
+	interval := time.Duration(cfg.Interval) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			check(ctx, cfg, proxy.GetUpstreamStatus(), time.Now())
+		case <-ctx.Done():
+			log.Printf("alert: check loop stopped")
+			return
+		}
+	}
+}
+
+// check evaluates every rule against every upstream and sends the alerts that
+// are new, or due again under Repeat. Alerts that cleared are forgotten.
+// Webhooks are posted without holding firedMu.
+func check(ctx context.Context, cfg Config, statuses []proxy.UpstreamStatus, now time.Time) {
+	type pending struct {
+		key  string
+		rule string
+		ev   Event
+	}
+	var due []pending
+
+	firedMu.Lock()
+	for _, r := range cfg.Rules {
+		for _, st := range statuses {
+			if len(r.Upstreams) > 0 && !slices.Contains(r.Upstreams, st.URL) && !slices.Contains(r.Upstreams, st.Name) {
+				continue
+			}
+			key := r.Name + "\x00" + r.Type + "\x00" + st.URL
+			ev, ok := evaluate(r, st, now)
+			if !ok {
+				delete(fired, key)
+				continue
+			}
+			if last, seen := fired[key]; seen && (cfg.Repeat <= 0 || now.Sub(last) < cfg.Repeat) {
+				continue
+			}
+			msg, err := render(r.Message, defaultMessages[r.Type], ev)
+			if err != nil {
+				log.Printf("alert: rule %q: %v", r.Name, err)
+				continue
+			}
+			ev.Message = msg
+			due = append(due, pending{key, r.Name, ev})
+		}
+	}
+	firedMu.Unlock()
+
+	for _, p := range due {
+		sent := false
+		for _, wh := range cfg.Webhooks {
+			if err := send(ctx, wh, p.ev, time.Duration(cfg.Timeout)*time.Second); err != nil {
+				log.Printf("alert: rule %q: webhook %s: %v", p.rule, wh.URL, err)
+				continue
+			}
+			sent = true
+		}
+		// retry on the next check when no webhook took it
+		if sent {
+			firedMu.Lock()
+			fired[p.key] = now
+			firedMu.Unlock()
+		}
+	}
+}
+
+// evaluate reports whether rule r fires for st.
+func evaluate(r RuleConfig, st proxy.UpstreamStatus, now time.Time) (Event, bool) {
+	ev := Event{
+		Rule:      r.Name,
+		Type:      r.Type,
+		Upstream:  st.DisplayName(),
+		Nodes:     st.Nodes,
+		PrevNodes: st.PrevNodes,
+		Failures:  st.Failures,
+		Userinfo:  st.Userinfo,
+		FiredAt:   now,
+	}
+	if info := st.Userinfo; info != nil {
+		ev.RemainingGB = float64(info.Total-info.Upload-info.Download) / (1 << 30)
+		if info.Expire > 0 {
+			ev.DaysLeft = int(time.Unix(info.Expire, 0).Sub(now).Hours() / 24)
+		}
+	}
+
+	switch r.Type {
+	case TypeTraffic:
+		info := st.Userinfo
+		if info == nil || info.Total <= 0 {
+			return ev, false
+		}
+		percent := ev.RemainingGB * (1 << 30) / float64(info.Total) * 100
+		return ev, (r.RemainingGB > 0 && ev.RemainingGB < r.RemainingGB) || (r.RemainingPercent > 0 && percent < r.RemainingPercent)
+	case TypeExpiry:
+		if st.Userinfo == nil || st.Userinfo.Expire <= 0 {
+			return ev, false
+		}
+		return ev, time.Unix(st.Userinfo.Expire, 0).Before(now.AddDate(0, 0, r.Days))
+	case TypeFailing:
+		return ev, r.Failures > 0 && st.Failures >= r.Failures
+	case TypeNodesDrop:
+		// a failed fetch is the failing rule's business
+		if st.Failures > 0 || st.PrevNodes == 0 || r.DropPercent <= 0 {
+			return ev, false
+		}
+		return ev, float64(st.PrevNodes-st.Nodes)/float64(st.PrevNodes)*100 >= r.DropPercent
+	}
+	return ev, false
+}
+
+var funcs = template.FuncMap{
+	// json quotes a value for use inside a JSON body template
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+func render(text, fallback string, ev Event) (string, error) {
+	if text == "" {
+		text = fallback
+	}
+	t, err := template.New("").Funcs(funcs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, ev); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func send(ctx context.Context, wh WebhookConfig, ev Event, timeout time.Duration) error {
+	var body []byte
+	if wh.Body != "" {
+		s, err := render(wh.Body, "", ev)
+		if err != nil {
+			return err
+		}
+		body = []byte(s)
+	} else {
+		b, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		body = b
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	req := client.R().SetContext(ctx).SetHeader("Content-Type", "application/json").SetBody(body)
+	for k, v := range wh.Headers {
+		req.SetHeader(k, v)
+	}
+	resp, err := req.Post(wh.URL)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() < http.StatusOK || resp.StatusCode() >= http.StatusMultipleChoices {
+		return fmt.Errorf("unexpected status %s", resp.Status())
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dingdayu/go-project-template/internal/proxy"
+	"github.com/dingdayu/go-project-template/internal/upstream"
+)
+
+const gb = 1 << 30
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	info := func(used, total int64, expireDays int) *upstream.Userinfo {
+		u := &upstream.Userinfo{Download: used, Total: total}
+		if expireDays != 0 {
+			u.Expire = now.AddDate(0, 0, expireDays).Unix()
+		}
+		return u
+	}
+	tests := []struct {
+		name string
+		rule RuleConfig
+		st   proxy.UpstreamStatus
+		want bool
+	}{
+		{"traffic below gb", RuleConfig{Type: TypeTraffic, RemainingGB: 10}, proxy.UpstreamStatus{Userinfo: info(95*gb, 100*gb, 0)}, true},
+		{"traffic above gb", RuleConfig{Type: TypeTraffic, RemainingGB: 10}, proxy.UpstreamStatus{Userinfo: info(50*gb, 100*gb, 0)}, false},
+		{"traffic below percent", RuleConfig{Type: TypeTraffic, RemainingPercent: 20}, proxy.UpstreamStatus{Userinfo: info(90*gb, 100*gb, 0)}, true},
+		{"traffic unlimited", RuleConfig{Type: TypeTraffic, RemainingGB: 10}, proxy.UpstreamStatus{Userinfo: info(90*gb, 0, 0)}, false},
+		{"traffic unknown", RuleConfig{Type: TypeTraffic, RemainingGB: 10}, proxy.UpstreamStatus{}, false},
+		{"expiry within days", RuleConfig{Type: TypeExpiry, Days: 7}, proxy.UpstreamStatus{Userinfo: info(0, 0, 3)}, true},
+		{"expiry later", RuleConfig{Type: TypeExpiry, Days: 7}, proxy.UpstreamStatus{Userinfo: info(0, 0, 30)}, false},
+		{"expiry never", RuleConfig{Type: TypeExpiry, Days: 7}, proxy.UpstreamStatus{Userinfo: info(0, 0, 0)}, false},
+		{"failing", RuleConfig{Type: TypeFailing, Failures: 3}, proxy.UpstreamStatus{Failures: 3}, true},
+		{"failing not yet", RuleConfig{Type: TypeFailing, Failures: 3}, proxy.UpstreamStatus{Failures: 2}, false},
+		{"failing unset", RuleConfig{Type: TypeFailing}, proxy.UpstreamStatus{Failures: 5}, false},
+		{"nodes drop", RuleConfig{Type: TypeNodesDrop, DropPercent: 50}, proxy.UpstreamStatus{PrevNodes: 10, Nodes: 4}, true},
+		{"nodes small drop", RuleConfig{Type: TypeNodesDrop, DropPercent: 50}, proxy.UpstreamStatus{PrevNodes: 10, Nodes: 8}, false},
+		{"nodes drop on failure", RuleConfig{Type: TypeNodesDrop, DropPercent: 50}, proxy.UpstreamStatus{PrevNodes: 10, Failures: 1}, false},
+		{"nodes first fetch", RuleConfig{Type: TypeNodesDrop, DropPercent: 50}, proxy.UpstreamStatus{Nodes: 10}, false},
+		{"unknown type", RuleConfig{Type: "other"}, proxy.UpstreamStatus{Failures: 9}, false},
+	}
+	for _, tt := range tests {
+		if _, got := evaluate(tt.rule, tt.st, now); got != tt.want {
+			t.Errorf("%s: fired = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	ev, _ := evaluate(RuleConfig{Name: "low", Type: TypeTraffic, RemainingGB: 10}, proxy.UpstreamStatus{Name: "main", Userinfo: info(95*gb, 100*gb, 10)}, now)
+	if ev.Upstream != "main" || ev.RemainingGB != 5 || ev.DaysLeft != 10 {
+		t.Errorf("event = %+v", ev)
+	}
+}
+
+func TestRender(t *testing.T) {
+	ev := Event{Upstream: "main", RemainingGB: 1.25, Message: `say "hi"`}
+	got, err := render("", defaultMessages[TypeTraffic], ev)
+	if err != nil || got != "main: 1.2 GB traffic left" {
+		t.Errorf("default message = %q, %v", got, err)
+	}
+	got, err = render(`{"text":{{json .Message}}}`, "", ev)
+	if err != nil || got != `{"text":"say \"hi\""}` {
+		t.Errorf("json body = %q, %v", got, err)
+	}
+	if _, err := render("{{.Missing", "", ev); err == nil {
+		t.Error("broken template accepted")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	var events []Event
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the fired map stays usable while webhooks are posted
+		if !firedMu.TryLock() {
+			t.Error("firedMu held while sending")
+		} else {
+			firedMu.Unlock()
+		}
+		var ev Event
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Error(err)
+		}
+		events = append(events, ev)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	t.Cleanup(func() { clear(fired) })
+
+	cfg := Config{
+		Repeat:   time.Hour,
+		Rules:    []RuleConfig{{Name: "down", Type: TypeFailing, Failures: 2}},
+		Webhooks: []WebhookConfig{{URL: srv.URL}},
+	}
+	failing := []proxy.UpstreamStatus{{Name: "a", URL: "https://a.example/sub", Failures: 2}, {Name: "b", URL: "https://b.example/sub"}}
+	healthy := []proxy.UpstreamStatus{{Name: "a", URL: "https://a.example/sub"}}
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	steps := []struct {
+		name     string
+		statuses []proxy.UpstreamStatus
+		at       time.Duration
+		status   int
+		sent     int // events received so far
+	}{
+		{"fires", failing, 0, http.StatusOK, 1},
+		{"not again before repeat", failing, 30 * time.Minute, http.StatusOK, 1},
+		{"repeats", failing, 61 * time.Minute, http.StatusOK, 2},
+		{"clears", healthy, 70 * time.Minute, http.StatusOK, 2},
+		{"fires again, webhook fails", failing, 80 * time.Minute, http.StatusInternalServerError, 3},
+		{"retried after a failed send", failing, 81 * time.Minute, http.StatusOK, 4},
+	}
+	for _, s := range steps {
+		status = s.status
+		check(ctx, cfg, s.statuses, now.Add(s.at))
+		if len(events) != s.sent {
+			t.Fatalf("%s: %d events sent, want %d", s.name, len(events), s.sent)
+		}
+	}
+	if ev := events[0]; ev.Rule != "down" || ev.Upstream != "a" || ev.Message != "a: 2 consecutive fetches failed" {
+		t.Errorf("event = %+v", ev)
+	}
+}
@@ -0,0 +1,665 @@
+package format
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"go.yaml.in/yaml/v2"
+)
+
+// ClashProfile is a Clash Meta (mihomo) configuration. Fields are declared in
+// the order clients and users expect to read them.
+type ClashProfile struct {
+	MixedPort          int                          `yaml:"mixed-port,omitempty"`
+	SocksPort          int                          `yaml:"socks-port,omitempty"`
+	AllowLan           bool                         `yaml:"allow-lan"`
+	Mode               string                       `yaml:"mode"`
+	LogLevel           string                       `yaml:"log-level"`
+	ExternalController string                       `yaml:"external-controller,omitempty"`
+	Secret             string                       `yaml:"secret,omitempty"`
+	Tun                *ClashTun                    `yaml:"tun,omitempty"`
+	DNS                *ClashDNS                    `yaml:"dns,omitempty"`
+	Proxies            []yaml.MapSlice              `yaml:"proxies"`
+	ProxyGroups        []ClashGroup                 `yaml:"proxy-groups"`
+	RuleProviders      map[string]ClashRuleProvider `yaml:"rule-providers,omitempty"`
+	Rules              []string                     `yaml:"rules"`
+	// Skipped lists the nodes Clash cannot use.
+	Skipped []string `yaml:"-"`
+}
+
+type ClashTun struct {
+	Enable              bool     `yaml:"enable"`
+	Stack               string   `yaml:"stack"`
+	AutoRoute           bool     `yaml:"auto-route"`
+	AutoDetectInterface bool     `yaml:"auto-detect-interface"`
+	StrictRoute         bool     `yaml:"strict-route,omitempty"`
+	MTU                 int      `yaml:"mtu,omitempty"`
+	DNSHijack           []string `yaml:"dns-hijack,omitempty"`
+}
+
+type ClashDNS struct {
+	Enable            bool          `yaml:"enable"`
+	IPv6              bool          `yaml:"ipv6"`
+	EnhancedMode      string        `yaml:"enhanced-mode"`
+	FakeIPRange       string        `yaml:"fake-ip-range,omitempty"`
+	DefaultNameserver []string      `yaml:"default-nameserver,omitempty"`
+	Nameserver        []string      `yaml:"nameserver"`
+	NameserverPolicy  yaml.MapSlice `yaml:"nameserver-policy,omitempty"`
+	ProxyServerNS     []string      `yaml:"proxy-server-nameserver,omitempty"`
+}
+
+type ClashGroup struct {
+	Name      string   `yaml:"name"`
+	Type      string   `yaml:"type"`
+	Proxies   []string `yaml:"proxies"`
+	URL       string   `yaml:"url,omitempty"`
+	Interval  int      `yaml:"interval,omitempty"`
+	Tolerance int      `yaml:"tolerance,omitempty"`
+}
+
+type ClashRuleProvider struct {
+	Type     string   `yaml:"type"`
+	Behavior string   `yaml:"behavior"`
+	Format   string   `yaml:"format,omitempty"`
+	URL      string   `yaml:"url,omitempty"`
+	Interval int      `yaml:"interval,omitempty"`
+	Payload  []string `yaml:"payload,omitempty"`
+}
+
+// Clash converts a generated sing-box profile into a Clash Meta profile: nodes
+// become proxies, selector / urltest outbounds proxy-groups, and route rules
+// Clash rules. Rule sets named after SagerNet geosite / geoip sets use Clash's
+// native GEOSITE / GEOIP matching, inline ones become inline rule-providers.
+// Anything without a Clash equivalent (sniff and DNS actions, logical rules,
+// unsupported node types) is left out; skipped nodes are listed in Skipped.
+func Clash(ctx context.Context, opts option.Options) (*ClashProfile, error) {
+	p := &ClashProfile{
+		Mode:     "rule",
+		LogLevel: "info",
+	}
+	if opts.Log != nil && opts.Log.Level != "" {
+		p.LogLevel = opts.Log.Level
+	}
+
+	names := make(map[string]string) // sing-box tag -> Clash name
+	names[directOutboundTag] = "DIRECT"
+	for i := range opts.Outbounds {
+		ot := &opts.Outbounds[i]
+		switch ot.Type {
+		case C.TypeDirect, C.TypeBlock, C.TypeDNS:
+			continue
+		case C.TypeSelector, C.TypeURLTest:
+			names[ot.Tag] = ot.Tag
+			continue
+		}
+		o, err := toObj(ctx, ot)
+		if err != nil {
+			return nil, err
+		}
+		proxy, err := clashProxy(ot.Type, ot.Tag, o)
+		if err != nil {
+			log.Printf("format: clash: skip %q: %v", ot.Tag, err)
+			p.Skipped = append(p.Skipped, ot.Tag)
+			continue
+		}
+		p.Proxies = append(p.Proxies, proxy)
+		names[ot.Tag] = ot.Tag
+	}
+
+	members, err := groupMembers(ctx, opts.Outbounds, names)
+	if err != nil {
+		return nil, err
+	}
+	for i := range opts.Outbounds {
+		ot := &opts.Outbounds[i]
+		ms, ok := members[ot.Tag]
+		if !ok {
+			continue
+		}
+		g := ClashGroup{Name: ot.Tag, Type: "select", Proxies: ms}
+		if ot.Type == C.TypeURLTest {
+			o, err := toObj(ctx, ot)
+			if err != nil {
+				return nil, err
+			}
+			g.Type = "url-test"
+			g.URL = o.str("url")
+			g.Tolerance = o.num("tolerance")
+			g.Interval = durationSeconds(o.str("interval"))
+		}
+		p.ProxyGroups = append(p.ProxyGroups, g)
+	}
+	// the top-level selector first, it is what Clash dashboards show on top
+	for i, g := range p.ProxyGroups {
+		if g.Name == proxyOutboundTag && i > 0 {
+			p.ProxyGroups = append([]ClashGroup{g}, append(p.ProxyGroups[:i:i], p.ProxyGroups[i+1:]...)...)
+			break
+		}
+	}
+
+	if opts.Route != nil {
+		if err := clashRoute(ctx, p, opts.Route, names); err != nil {
+			return nil, err
+		}
+	}
+	clashInbounds(ctx, p, opts.Inbounds)
+	if opts.DNS != nil {
+		p.DNS = clashDNS(ctx, opts.DNS)
+	}
+	if opts.Experimental != nil && opts.Experimental.ClashAPI != nil {
+		p.ExternalController = opts.Experimental.ClashAPI.ExternalController
+		p.Secret = opts.Experimental.ClashAPI.Secret
+	}
+	return p, nil
+}
+
+// Marshal encodes the profile as YAML.
+func (p *ClashProfile) Marshal() ([]byte, error) {
+	return yaml.Marshal(p)
+}
+
+func durationSeconds(s string) int {
+	if s == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0
+	}
+	return int(d.Seconds())
+}
+
+// clashProxy maps one node outbound onto a Clash proxy entry.
+func clashProxy(typ, name string, o obj) (yaml.MapSlice, error) {
+	px := yaml.MapSlice{
+		{Key: "name", Value: name},
+	}
+	add := func(k string, v any) { px = append(px, yaml.MapItem{Key: k, Value: v}) }
+	addIf := func(k string, v any) {
+		switch x := v.(type) {
+		case string:
+			if x == "" {
+				return
+			}
+		case int:
+			if x == 0 {
+				return
+			}
+		case bool:
+			if !x {
+				return
+			}
+		case []string:
+			if len(x) == 0 {
+				return
+			}
+		}
+		add(k, v)
+	}
+	server := func() {
+		add("server", o.str("server"))
+		add("port", o.num("server_port"))
+	}
+	tls := o.child("tls")
+	tlsOpts := func(sniKey string) {
+		if tls == nil || !tls.boolean("enabled") {
+			return
+		}
+		addIf(sniKey, tls.str("server_name"))
+		addIf("skip-cert-verify", tls.boolean("insecure"))
+		addIf("alpn", tls.strs("alpn"))
+		if utls := tls.child("utls"); utls != nil && utls.boolean("enabled") {
+			addIf("client-fingerprint", utls.str("fingerprint"))
+		}
+		if reality := tls.child("reality"); reality != nil && reality.boolean("enabled") {
+			add("reality-opts", yaml.MapSlice{
+				{Key: "public-key", Value: reality.str("public_key")},
+				{Key: "short-id", Value: reality.str("short_id")},
+			})
+		}
+	}
+	transport := func() error {
+		t := o.child("transport")
+		if t == nil {
+			return nil
+		}
+		switch t.str("type") {
+		case C.V2RayTransportTypeWebsocket:
+			add("network", "ws")
+			ws := yaml.MapSlice{{Key: "path", Value: t.str("path")}}
+			if h := t.child("headers"); len(h) > 0 {
+				headers := yaml.MapSlice{}
+				for k := range h {
+					headers = append(headers, yaml.MapItem{Key: k, Value: strings.Join(obj(h).strs(k), ",")})
+				}
+				ws = append(ws, yaml.MapItem{Key: "headers", Value: headers})
+			}
+			add("ws-opts", ws)
+		case C.V2RayTransportTypeGRPC:
+			add("network", "grpc")
+			add("grpc-opts", yaml.MapSlice{{Key: "grpc-service-name", Value: t.str("service_name")}})
+		case C.V2RayTransportTypeHTTP:
+			add("network", "h2")
+			add("h2-opts", yaml.MapSlice{{Key: "host", Value: t.strs("host")}, {Key: "path", Value: t.str("path")}})
+		default:
+			return fmt.Errorf("transport %q", t.str("type"))
+		}
+		return nil
+	}
+
+	switch typ {
+	case C.TypeShadowsocks:
+		add("type", "ss")
+		server()
+		add("cipher", o.str("method"))
+		add("password", o.str("password"))
+		add("udp", o.str("network") != "tcp")
+		switch o.str("plugin") {
+		case "":
+		case "obfs-local":
+			po := pluginOpts(o.str("plugin_opts"))
+			add("plugin", "obfs")
+			add("plugin-opts", yaml.MapSlice{{Key: "mode", Value: po["obfs"]}, {Key: "host", Value: po["obfs-host"]}})
+		case "v2ray-plugin":
+			po := pluginOpts(o.str("plugin_opts"))
+			opts := yaml.MapSlice{{Key: "mode", Value: "websocket"}}
+			if po["obfs-host"] != "" || po["host"] != "" {
+				opts = append(opts, yaml.MapItem{Key: "host", Value: po["obfs-host"] + po["host"]})
+			}
+			if path := po["obfs-path"] + po["path"]; path != "" {
+				opts = append(opts, yaml.MapItem{Key: "path", Value: path})
+			}
+			if _, ok := po["tls"]; ok {
+				opts = append(opts, yaml.MapItem{Key: "tls", Value: true})
+			}
+			add("plugin", "v2ray-plugin")
+			add("plugin-opts", opts)
+		default:
+			return nil, fmt.Errorf("plugin %q", o.str("plugin"))
+		}
+	case C.TypeTrojan:
+		add("type", "trojan")
+		server()
+		add("password", o.str("password"))
+		add("udp", true)
+		tlsOpts("sni")
+		if err := transport(); err != nil {
+			return nil, err
+		}
+	case C.TypeVMess:
+		add("type", "vmess")
+		server()
+		add("uuid", o.str("uuid"))
+		add("alterId", o.num("alter_id"))
+		cipher := o.str("security")
+		if cipher == "" {
+			cipher = "auto"
+		}
+		add("cipher", cipher)
+		add("udp", true)
+		if tls != nil && tls.boolean("enabled") {
+			add("tls", true)
+		}
+		tlsOpts("servername")
+		if err := transport(); err != nil {
+			return nil, err
+		}
+	case C.TypeVLESS:
+		add("type", "vless")
+		server()
+		add("uuid", o.str("uuid"))
+		addIf("flow", o.str("flow"))
+		add("udp", true)
+		if tls != nil && tls.boolean("enabled") {
+			add("tls", true)
+		}
+		tlsOpts("servername")
+		if err := transport(); err != nil {
+			return nil, err
+		}
+	case C.TypeHysteria2:
+		add("type", "hysteria2")
+		server()
+		add("password", o.str("password"))
+		if obfs := o.child("obfs"); obfs != nil && obfs.str("type") != "" {
+			add("obfs", obfs.str("type"))
+			add("obfs-password", obfs.str("password"))
+		}
+		addIf("up", o.num("up_mbps"))
+		addIf("down", o.num("down_mbps"))
+		tlsOpts("sni")
+	case C.TypeTUIC:
+		add("type", "tuic")
+		server()
+		add("uuid", o.str("uuid"))
+		add("password", o.str("password"))
+		addIf("congestion-controller", o.str("congestion_control"))
+		tlsOpts("sni")
+	case C.TypeSOCKS:
+		add("type", "socks5")
+		server()
+		addIf("username", o.str("username"))
+		addIf("password", o.str("password"))
+	case C.TypeHTTP:
+		add("type", "http")
+		server()
+		addIf("username", o.str("username"))
+		addIf("password", o.str("password"))
+		if tls != nil && tls.boolean("enabled") {
+			add("tls", true)
+		}
+		tlsOpts("sni")
+	default:
+		return nil, fmt.Errorf("type %q has no Clash equivalent", typ)
+	}
+	return px, nil
+}
+
+// clashRoute converts route rules and rule sets. Rules routing to an outbound
+// Clash does not have fall back to the top-level proxy group.
+func clashRoute(ctx context.Context, p *ClashProfile, route *option.RouteOptions, names map[string]string) error {
+	// rule set tag -> Clash condition prefix ("GEOSITE,cn" / "RULE-SET,name")
+	sets := make(map[string]string)
+	for _, rs := range route.RuleSet {
+		if kind, name := geoRuleSetName(rs); kind != "" {
+			sets[rs.Tag] = strings.ToUpper(kind) + "," + name
+			continue
+		}
+		if rs.Type == C.RuleSetTypeInline || rs.Type == "" {
+			payload, behavior, ok := clashPayload(ctx, rs.InlineOptions)
+			if !ok {
+				log.Printf("format: clash: rule set %q has no Clash equivalent", rs.Tag)
+				continue
+			}
+			if p.RuleProviders == nil {
+				p.RuleProviders = make(map[string]ClashRuleProvider)
+			}
+			p.RuleProviders[rs.Tag] = ClashRuleProvider{Type: "inline", Behavior: behavior, Payload: payload}
+			sets[rs.Tag] = "RULE-SET," + rs.Tag
+			continue
+		}
+		log.Printf("format: clash: remote rule set %q has no Clash equivalent", rs.Tag)
+	}
+
+	target := func(tag string) string {
+		if n, ok := names[tag]; ok {
+			return n
+		}
+		return proxyOutboundTag
+	}
+
+	for i := range route.Rules {
+		r := &route.Rules[i]
+		if r.Type == C.RuleTypeLogical {
+			continue
+		}
+		var policy string
+		switch r.DefaultOptions.Action {
+		case C.RuleActionTypeReject:
+			policy = "REJECT"
+		case C.RuleActionTypeRoute, "":
+			policy = target(r.DefaultOptions.RouteOptions.Outbound)
+		default:
+			continue // sniff, hijack-dns, resolve: Clash does these on its own
+		}
+		o, err := toObj(ctx, &r.DefaultOptions.RawDefaultRule)
+		if err != nil {
+			return err
+		}
+		conds, ok := clashConditions(o, sets)
+		if !ok {
+			continue
+		}
+		for _, c := range conds {
+			p.Rules = append(p.Rules, c+","+policy+clashNoResolve(c))
+		}
+	}
+
+	final := proxyOutboundTag
+	if route.Final != "" {
+		final = target(route.Final)
+	}
+	p.Rules = append(p.Rules, "MATCH,"+final)
+	return nil
+}
+
+// clashConditions turns the OR'ed destination and process fields of one rule
+// into Clash rule conditions. ok is false when the rule uses fields Clash
+// cannot express, or more than one condition group (sing-box ANDs groups).
+func clashConditions(o obj, sets map[string]string) ([]string, bool) {
+	var dest, other []string
+	for _, d := range o.strs("domain") {
+		dest = append(dest, "DOMAIN,"+d)
+	}
+	for _, d := range o.strs("domain_suffix") {
+		dest = append(dest, "DOMAIN-SUFFIX,"+strings.TrimPrefix(d, "."))
+	}
+	for _, d := range o.strs("domain_keyword") {
+		dest = append(dest, "DOMAIN-KEYWORD,"+d)
+	}
+	for _, d := range o.strs("domain_regex") {
+		dest = append(dest, "DOMAIN-REGEX,"+d)
+	}
+	for _, c := range o.strs("ip_cidr") {
+		if strings.Contains(c, ":") {
+			dest = append(dest, "IP-CIDR6,"+c)
+		} else {
+			dest = append(dest, "IP-CIDR,"+c)
+		}
+	}
+	if o.boolean("ip_is_private") {
+		dest = append(dest, "GEOIP,LAN")
+	}
+	for _, tag := range o.strs("rule_set") {
+		c, ok := sets[tag]
+		if !ok {
+			return nil, false
+		}
+		dest = append(dest, c)
+	}
+
+	groups := 0
+	if len(dest) > 0 {
+		groups++
+	}
+	for key, prefix := range map[string]string{"process_name": "PROCESS-NAME", "package_name": "PROCESS-NAME", "port": "DST-PORT", "source_port": "SRC-PORT"} {
+		vals := o.strs(key)
+		for _, n := range o.nums(key) {
+			vals = append(vals, strconv.Itoa(n))
+		}
+		if len(vals) == 0 {
+			continue
+		}
+		groups++
+		for _, v := range vals {
+			other = append(other, prefix+","+v)
+		}
+	}
+	for _, c := range o.strs("source_ip_cidr") {
+		other = append(other, "SRC-IP-CIDR,"+c)
+		groups++
+	}
+
+	known := map[string]bool{"domain": true, "domain_suffix": true, "domain_keyword": true, "domain_regex": true,
+		"ip_cidr": true, "ip_is_private": true, "rule_set": true, "process_name": true, "package_name": true,
+		"port": true, "source_port": true, "source_ip_cidr": true}
+	for key := range o {
+		if !known[key] {
+			return nil, false // inbound, clash_mode, protocol, ...
+		}
+	}
+	if groups != 1 {
+		return nil, false
+	}
+	return append(dest, other...), true
+}
+
+// clashNoResolve keeps IP conditions from forcing a DNS lookup for domain requests.
+func clashNoResolve(cond string) string {
+	if strings.HasPrefix(cond, "IP-CIDR") || strings.HasPrefix(cond, "GEOIP,") {
+		return ",no-resolve"
+	}
+	return ""
+}
+
+// clashPayload converts an inline rule set into a classical payload (or a
+// domain / ipcidr one when it holds nothing else).
+func clashPayload(ctx context.Context, rs option.PlainRuleSet) ([]string, string, bool) {
+	var payload []string
+	for i := range rs.Rules {
+		r := &rs.Rules[i]
+		if r.Type == C.RuleTypeLogical {
+			return nil, "", false
+		}
+		o, err := toObj(ctx, &r.DefaultOptions)
+		if err != nil {
+			return nil, "", false
+		}
+		conds, ok := clashConditions(o, nil)
+		if !ok {
+			return nil, "", false
+		}
+		payload = append(payload, conds...)
+	}
+	return payload, "classical", len(payload) > 0
+}
+
+// clashInbounds maps the mixed / socks listen ports and the TUN inbound.
+func clashInbounds(ctx context.Context, p *ClashProfile, inbounds []option.Inbound) {
+	for i := range inbounds {
+		ib := &inbounds[i]
+		o, err := toObj(ctx, ib)
+		if err != nil {
+			continue
+		}
+		switch ib.Type {
+		case C.TypeMixed:
+			p.MixedPort = o.num("listen_port")
+			if l := o.str("listen"); l == "0.0.0.0" || l == "::" {
+				p.AllowLan = true
+			}
+		case C.TypeSOCKS:
+			p.SocksPort = o.num("listen_port")
+		case C.TypeTun:
+			p.Tun = &ClashTun{
+				Enable:              true,
+				Stack:               "mixed",
+				AutoRoute:           o.boolean("auto_route"),
+				AutoDetectInterface: true,
+				StrictRoute:         o.boolean("strict_route"),
+				MTU:                 o.num("mtu"),
+				DNSHijack:           []string{"any:53"},
+			}
+		}
+	}
+}
+
+// clashDNS maps the DNS servers onto Clash nameserver URLs: the final server
+// answers by default, DNS rules become nameserver-policy entries.
+func clashDNS(ctx context.Context, dns *option.DNSOptions) *ClashDNS {
+	d := &ClashDNS{Enable: true, IPv6: true, EnhancedMode: "redir-host"}
+	urls := make(map[string]string)
+	var plain []string
+	for i := range dns.Servers {
+		s := &dns.Servers[i]
+		o, err := toObj(ctx, s)
+		if err != nil {
+			continue
+		}
+		switch s.Type {
+		case C.DNSTypeFakeIP:
+			d.EnhancedMode = "fake-ip"
+			d.FakeIPRange = o.str("inet4_range")
+			continue
+		case C.DNSTypeHTTPS:
+			host := o.str("server")
+			if tls := o.child("tls"); tls != nil && tls.str("server_name") != "" {
+				host = tls.str("server_name")
+			}
+			path := o.str("path")
+			if path == "" {
+				path = "/dns-query"
+			}
+			urls[s.Tag] = "https://" + host + path
+		case C.DNSTypeTLS:
+			urls[s.Tag] = "tls://" + o.str("server")
+		case C.DNSTypeUDP:
+			urls[s.Tag] = o.str("server")
+		case C.DNSTypeLocal:
+			urls[s.Tag] = "system"
+			continue
+		default:
+			continue
+		}
+		// literal addresses can bootstrap the other servers and resolve proxy hosts
+		if _, err := netip.ParseAddr(o.str("server")); err == nil {
+			plain = append(plain, o.str("server"))
+		}
+	}
+
+	final := dns.Final
+	if u, ok := urls[final]; ok {
+		d.Nameserver = []string{u}
+	} else {
+		for i := range dns.Servers {
+			if u, ok := urls[dns.Servers[i].Tag]; ok {
+				d.Nameserver = []string{u}
+				break
+			}
+		}
+	}
+	d.DefaultNameserver = uniqueStrings(plain)
+	d.ProxyServerNS = d.DefaultNameserver
+
+	policySeen := make(map[string]bool)
+	for i := range dns.Rules {
+		r := &dns.Rules[i]
+		if r.Type == C.RuleTypeLogical || r.DefaultOptions.Action != C.RuleActionTypeRoute && r.DefaultOptions.Action != "" {
+			continue
+		}
+		u, ok := urls[r.DefaultOptions.RouteOptions.Server]
+		if !ok {
+			continue
+		}
+		o, err := toObj(ctx, &r.DefaultOptions.RawDefaultDNSRule)
+		if err != nil {
+			continue
+		}
+		keys := o.strs("domain")
+		for _, s := range o.strs("domain_suffix") {
+			keys = append(keys, "+."+strings.TrimPrefix(s, "."))
+		}
+		for _, tag := range o.strs("rule_set") {
+			if strings.HasPrefix(tag, "geosite-") {
+				keys = append(keys, "geosite:"+strings.TrimPrefix(tag, "geosite-"))
+			}
+		}
+		for _, k := range keys {
+			// like sing-box, the first matching rule wins
+			if !policySeen[k] {
+				policySeen[k] = true
+				d.NameserverPolicy = append(d.NameserverPolicy, yaml.MapItem{Key: k, Value: u})
+			}
+		}
+	}
+	return d
+}
+
+func uniqueStrings(in []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, s := range in {
+		if s != "" && !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,118 @@
+package format
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"go.yaml.in/yaml/v2"
+)
+
+func TestClash(t *testing.T) {
+	p, err := Clash(context.Background(), testProfile())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var proxies []string
+	for _, px := range p.Proxies {
+		proxies = append(proxies, px[0].Value.(string))
+	}
+	if want := []string{"SS 01", "Trojan, 02", "VLESS 03"}; !slices.Equal(proxies, want) {
+		t.Errorf("proxies = %v, want %v", proxies, want)
+	}
+	if want := []string{"SSH 04"}; !slices.Equal(p.Skipped, want) {
+		t.Errorf("skipped = %v, want %v", p.Skipped, want)
+	}
+
+	// nested only held only-ssh, which only held the skipped node
+	wantGroups := []ClashGroup{
+		{Name: "proxy", Type: "select", Proxies: []string{"auto-out", "DIRECT", "SS 01", "Trojan, 02", "VLESS 03"}},
+		{Name: "auto-out", Type: "url-test", Proxies: []string{"SS 01", "Trojan, 02", "VLESS 03"},
+			URL: "https://www.gstatic.com/generate_204", Interval: 300, Tolerance: 50},
+	}
+	if len(p.ProxyGroups) != len(wantGroups) {
+		t.Fatalf("groups = %+v", p.ProxyGroups)
+	}
+	for i, g := range wantGroups {
+		got := p.ProxyGroups[i]
+		if got.Name != g.Name || got.Type != g.Type || !slices.Equal(got.Proxies, g.Proxies) ||
+			got.URL != g.URL || got.Interval != g.Interval || got.Tolerance != g.Tolerance {
+			t.Errorf("group %d = %+v, want %+v", i, got, g)
+		}
+	}
+
+	wantRules := []string{"DOMAIN-SUFFIX,example.org,proxy", "GEOIP,LAN,DIRECT,no-resolve", "GEOSITE,cn,DIRECT", "MATCH,proxy"}
+	if !slices.Equal(p.Rules, wantRules) {
+		t.Errorf("rules = %q, want %q", p.Rules, wantRules)
+	}
+
+	b, err := p.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back map[string]any
+	if err := yaml.Unmarshal(b, &back); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := back["Skipped"]; ok {
+		t.Error("skipped nodes marshalled into the profile")
+	}
+}
+
+func TestClashProxy(t *testing.T) {
+	tests := []struct {
+		name string
+		typ  string
+		o    obj
+		want yaml.MapSlice
+		err  bool
+	}{
+		{
+			name: "ss obfs",
+			typ:  "shadowsocks",
+			o:    obj{"server": "a.example", "server_port": 8388.0, "method": "aes-256-gcm", "password": "p", "network": "tcp", "plugin": "obfs-local", "plugin_opts": "obfs=http;obfs-host=b.example"},
+			want: yaml.MapSlice{{Key: "name", Value: "n"}, {Key: "type", Value: "ss"}, {Key: "server", Value: "a.example"}, {Key: "port", Value: 8388},
+				{Key: "cipher", Value: "aes-256-gcm"}, {Key: "password", Value: "p"}, {Key: "udp", Value: false},
+				{Key: "plugin", Value: "obfs"}, {Key: "plugin-opts", Value: yaml.MapSlice{{Key: "mode", Value: "http"}, {Key: "host", Value: "b.example"}}}},
+		},
+		{
+			name: "hysteria2",
+			typ:  "hysteria2",
+			o:    obj{"server": "h.example", "server_port": 443.0, "password": "p", "obfs": map[string]any{"type": "salamander", "password": "o"}, "tls": map[string]any{"enabled": true, "server_name": "h.example", "insecure": true}},
+			want: yaml.MapSlice{{Key: "name", Value: "n"}, {Key: "type", Value: "hysteria2"}, {Key: "server", Value: "h.example"}, {Key: "port", Value: 443},
+				{Key: "password", Value: "p"}, {Key: "obfs", Value: "salamander"}, {Key: "obfs-password", Value: "o"},
+				{Key: "sni", Value: "h.example"}, {Key: "skip-cert-verify", Value: true}},
+		},
+		{
+			name: "vmess grpc",
+			typ:  "vmess",
+			o:    obj{"server": "v.example", "server_port": 443.0, "uuid": "u", "transport": map[string]any{"type": "grpc", "service_name": "svc"}},
+			want: yaml.MapSlice{{Key: "name", Value: "n"}, {Key: "type", Value: "vmess"}, {Key: "server", Value: "v.example"}, {Key: "port", Value: 443},
+				{Key: "uuid", Value: "u"}, {Key: "alterId", Value: 0}, {Key: "cipher", Value: "auto"}, {Key: "udp", Value: true},
+				{Key: "network", Value: "grpc"}, {Key: "grpc-opts", Value: yaml.MapSlice{{Key: "grpc-service-name", Value: "svc"}}}},
+		},
+		{name: "unknown plugin", typ: "shadowsocks", o: obj{"plugin": "kcptun"}, err: true},
+		{name: "unknown transport", typ: "vless", o: obj{"transport": map[string]any{"type": "quic"}}, err: true},
+		{name: "unsupported type", typ: "wireguard", o: obj{}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := clashProxy(tt.typ, "n", tt.o)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("got %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			gb, _ := yaml.Marshal(got)
+			wb, _ := yaml.Marshal(tt.want)
+			if string(gb) != string(wb) {
+				t.Errorf("got\n%s\nwant\n%s", gb, wb)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+// Package format renders generated sing-box profiles into the subscription
+// formats of other clients.
+package format
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/include"
+	"github.com/sagernet/sing-box/option"
+	sjson "github.com/sagernet/sing/common/json"
+)
+
+// Well-known tags of generated profiles, see internal/singbox.
+const (
+	directOutboundTag = "direct-out"
+	proxyOutboundTag  = "proxy"
+)
+
+// obj is the JSON object form of a sing-box option, read through the helpers below.
+type obj map[string]any
+
+// toObj marshals a sing-box option (pass a pointer) and decodes it generically.
+func toObj(ctx context.Context, v any) (obj, error) {
+	b, err := sjson.MarshalContext(include.Context(ctx), v)
+	if err != nil {
+		return nil, err
+	}
+	var m obj
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (o obj) str(key string) string {
+	s, _ := o[key].(string)
+	return s
+}
+
+func (o obj) num(key string) int {
+	f, _ := o[key].(float64)
+	return int(f)
+}
+
+func (o obj) boolean(key string) bool {
+	b, _ := o[key].(bool)
+	return b
+}
+
+func (o obj) child(key string) obj {
+	m, _ := o[key].(map[string]any)
+	return m
+}
+
+// strs reads a field sing-box writes as either a string or a list of strings.
+func (o obj) strs(key string) []string {
+	switch v := o[key].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// nums reads a field sing-box writes as either a number or a list of numbers.
+func (o obj) nums(key string) []int {
+	switch v := o[key].(type) {
+	case float64:
+		return []int{int(v)}
+	case []any:
+		out := make([]int, 0, len(v))
+		for _, item := range v {
+			if f, ok := item.(float64); ok {
+				out = append(out, int(f))
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// pluginOpts parses sing-box "k=v;k=v" plugin options.
+func pluginOpts(s string) map[string]string {
+	opts := make(map[string]string)
+	for _, kv := range strings.Split(s, ";") {
+		k, v, ok := strings.Cut(kv, "=")
+		if ok {
+			opts[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		} else if kv != "" {
+			opts[strings.TrimSpace(kv)] = ""
+		}
+	}
+	return opts
+}
+
+// geoRuleSetName returns ("geosite", "cn") for rule sets named or sourced like
+// geosite-cn, so clients with native GEOSITE / GEOIP matching can use those.
+func geoRuleSetName(rs option.RuleSet) (kind, name string) {
+	candidates := []string{rs.Tag}
+	if rs.Type == "remote" {
+		url := rs.RemoteOptions.URL
+		candidates = append([]string{strings.TrimSuffix(url[strings.LastIndex(url, "/")+1:], ".srs")}, candidates...)
+	}
+	for _, c := range candidates {
+		for _, k := range []string{"geosite", "geoip"} {
+			if strings.HasPrefix(c, k+"-") {
+				return k, strings.TrimPrefix(c, k+"-")
+			}
+		}
+	}
+	return "", ""
+}
+
+// groupMembers resolves the members of the selector / urltest outbounds in
+// names to client policy names. Groups left without members are removed from
+// names, repeatedly, as dropping one may empty the groups that referenced it;
+// so no returned group refers to a missing policy.
+func groupMembers(ctx context.Context, outbounds []option.Outbound, names map[string]string) (map[string][]string, error) {
+	raw := make(map[string][]string)
+	for i := range outbounds {
+		ot := &outbounds[i]
+		if _, ok := names[ot.Tag]; !ok || ot.Type != C.TypeSelector && ot.Type != C.TypeURLTest {
+			continue
+		}
+		o, err := toObj(ctx, ot)
+		if err != nil {
+			return nil, err
+		}
+		raw[ot.Tag] = o.strs("outbounds")
+	}
+
+	members := make(map[string][]string)
+	for changed := true; changed; {
+		changed = false
+		clear(members)
+		for tag, outs := range raw {
+			if _, ok := names[tag]; !ok {
+				continue
+			}
+			var ms []string
+			for _, m := range outs {
+				if n, ok := names[m]; ok {
+					ms = append(ms, n)
+				}
+			}
+			if len(ms) == 0 {
+				delete(names, tag)
+				changed = true
+				continue
+			}
+			members[tag] = ms
+		}
+	}
+	return members, nil
+}
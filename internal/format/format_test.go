@@ -0,0 +1,130 @@
+package format
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"testing"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common/json/badoption"
+)
+
+func server(host string, port uint16) option.ServerOptions {
+	return option.ServerOptions{Server: host, ServerPort: port}
+}
+
+// testProfile is a small generated profile: nodes of various types, an
+// urltest group, a chain of groups that ends up empty and a few rules.
+func testProfile() option.Options {
+	tls := func(sni string) option.OutboundTLSOptionsContainer {
+		return option.OutboundTLSOptionsContainer{TLS: &option.OutboundTLSOptions{Enabled: true, ServerName: sni}}
+	}
+	return option.Options{
+		Outbounds: []option.Outbound{
+			{Type: C.TypeDirect, Tag: directOutboundTag, Options: &option.DirectOutboundOptions{}},
+			{Type: C.TypeShadowsocks, Tag: "SS 01", Options: &option.ShadowsocksOutboundOptions{
+				ServerOptions: server("ss.example.com", 8388), Method: "aes-128-gcm", Password: "pass",
+			}},
+			{Type: C.TypeTrojan, Tag: "Trojan, 02", Options: &option.TrojanOutboundOptions{
+				ServerOptions: server("trojan.example.com", 443), Password: "secret", OutboundTLSOptionsContainer: tls("trojan.example.com"),
+				Transport: &option.V2RayTransportOptions{Type: C.V2RayTransportTypeWebsocket, WebsocketOptions: option.V2RayWebsocketOptions{Path: "/ws"}},
+			}},
+			{Type: C.TypeVLESS, Tag: "VLESS 03", Options: &option.VLESSOutboundOptions{
+				ServerOptions: server("vless.example.com", 443), UUID: "b831381d-6324-4d53-ad4f-8cda48b30811", Flow: "xtls-rprx-vision",
+				OutboundTLSOptionsContainer: option.OutboundTLSOptionsContainer{TLS: &option.OutboundTLSOptions{
+					Enabled: true, ServerName: "www.microsoft.com",
+					Reality: &option.OutboundRealityOptions{Enabled: true, PublicKey: "pbk", ShortID: "0123"},
+				}},
+			}},
+			{Type: C.TypeSSH, Tag: "SSH 04", Options: &option.SSHOutboundOptions{ServerOptions: server("ssh.example.com", 22), User: "root"}},
+			// nested refers to only-ssh, declared after it and emptied by the SSH node being skipped
+			{Type: C.TypeSelector, Tag: "nested", Options: &option.SelectorOutboundOptions{Outbounds: []string{"only-ssh"}}},
+			{Type: C.TypeSelector, Tag: "only-ssh", Options: &option.SelectorOutboundOptions{Outbounds: []string{"SSH 04"}}},
+			{Type: C.TypeURLTest, Tag: "auto-out", Options: &option.URLTestOutboundOptions{
+				Outbounds: []string{"SS 01", "Trojan, 02", "VLESS 03", "SSH 04"}, URL: "https://www.gstatic.com/generate_204",
+				Interval: badoption.Duration(300e9), Tolerance: 50,
+			}},
+			{Type: C.TypeSelector, Tag: proxyOutboundTag, Options: &option.SelectorOutboundOptions{
+				Outbounds: []string{"auto-out", "nested", directOutboundTag, "SS 01", "Trojan, 02", "VLESS 03", "SSH 04"},
+			}},
+		},
+		Route: &option.RouteOptions{
+			Rules: []option.Rule{
+				{Type: C.RuleTypeDefault, DefaultOptions: option.DefaultRule{
+					RawDefaultRule: option.RawDefaultRule{DomainSuffix: []string{"example.org"}},
+					RuleAction:     option.RuleAction{Action: C.RuleActionTypeRoute, RouteOptions: option.RouteActionOptions{Outbound: "nested"}},
+				}},
+				{Type: C.RuleTypeDefault, DefaultOptions: option.DefaultRule{
+					RawDefaultRule: option.RawDefaultRule{IPIsPrivate: true},
+					RuleAction:     option.RuleAction{Action: C.RuleActionTypeRoute, RouteOptions: option.RouteActionOptions{Outbound: directOutboundTag}},
+				}},
+				{Type: C.RuleTypeDefault, DefaultOptions: option.DefaultRule{
+					RawDefaultRule: option.RawDefaultRule{RuleSet: []string{"geosite-cn"}},
+					RuleAction:     option.RuleAction{Action: C.RuleActionTypeRoute, RouteOptions: option.RouteActionOptions{Outbound: directOutboundTag}},
+				}},
+			},
+			RuleSet: []option.RuleSet{{Type: C.RuleSetTypeRemote, Tag: "geosite-cn", Format: C.RuleSetFormatBinary,
+				RemoteOptions: option.RemoteRuleSet{URL: "https://example.com/geosite-cn.srs"}}},
+			Final: proxyOutboundTag,
+		},
+	}
+}
+
+func TestGroupMembers(t *testing.T) {
+	sel := func(tag string, members ...string) option.Outbound {
+		return option.Outbound{Type: C.TypeSelector, Tag: tag, Options: &option.SelectorOutboundOptions{Outbounds: members}}
+	}
+	outbounds := []option.Outbound{
+		sel("a", "b", "node"),
+		sel("b", "c"),
+		sel("c", "gone"),
+		sel("d", "a", "DIRECT-TAG"),
+		{Type: C.TypeShadowsocks, Tag: "node"},
+	}
+	names := map[string]string{"a": "a", "b": "b", "c": "c", "d": "d", "node": "Node", "DIRECT-TAG": "DIRECT"}
+	members, err := groupMembers(context.Background(), outbounds, names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{"a": {"Node"}, "d": {"a", "DIRECT"}}
+	if len(members) != len(want) {
+		t.Fatalf("members = %v, want %v", members, want)
+	}
+	for tag, ms := range want {
+		if !slices.Equal(members[tag], ms) {
+			t.Errorf("%s = %v, want %v", tag, members[tag], ms)
+		}
+	}
+	for _, tag := range []string{"b", "c"} {
+		if _, ok := names[tag]; ok {
+			t.Errorf("empty group %s still named", tag)
+		}
+	}
+}
+
+func TestPluginOpts(t *testing.T) {
+	got := pluginOpts("obfs=http; obfs-host=example.com;tls")
+	want := map[string]string{"obfs": "http", "obfs-host": "example.com", "tls": ""}
+	if !maps.Equal(got, want) {
+		t.Errorf("pluginOpts = %v, want %v", got, want)
+	}
+}
+
+func TestGeoRuleSetName(t *testing.T) {
+	tests := []struct {
+		rs         option.RuleSet
+		kind, name string
+	}{
+		{option.RuleSet{Tag: "geosite-cn"}, "geosite", "cn"},
+		{option.RuleSet{Tag: "geoip-us"}, "geoip", "us"},
+		{option.RuleSet{Type: C.RuleSetTypeRemote, Tag: "cn-sites", RemoteOptions: option.RemoteRuleSet{URL: "https://example.com/rule-set/geosite-cn.srs"}}, "geosite", "cn"},
+		{option.RuleSet{Tag: "ads"}, "", ""},
+	}
+	for _, tt := range tests {
+		if kind, name := geoRuleSetName(tt.rs); kind != tt.kind || name != tt.name {
+			t.Errorf("geoRuleSetName(%s) = %s, %s", tt.rs.Tag, kind, name)
+		}
+	}
+}
@@ -0,0 +1,546 @@
+package format
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+)
+
+// Conf is a Surge style configuration (Surge, Loon): INI sections of
+// "name = value" lines.
+type Conf struct {
+	General []string
+	Proxies []string
+	Groups  []string
+	Rules   []string
+	// Skipped lists the nodes the client cannot use.
+	Skipped []string
+}
+
+// Marshal encodes the configuration as text.
+func (c *Conf) Marshal() []byte {
+	var b bytes.Buffer
+	for _, s := range []struct {
+		name  string
+		lines []string
+	}{
+		{"General", c.General},
+		{"Proxy", c.Proxies},
+		{"Proxy Group", c.Groups},
+		{"Rule", c.Rules},
+	} {
+		fmt.Fprintf(&b, "[%s]\n", s.name)
+		for _, l := range s.lines {
+			b.WriteString(l)
+			b.WriteByte('\n')
+		}
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// confDialect is what sets Surge and Loon apart: node syntax, the DNS keys
+// and which rule types the client knows.
+type confDialect struct {
+	name    string
+	sep     string // list separator
+	proxy   func(typ string, o obj) (string, error)
+	general func(dns *ClashDNS) []string
+	rules   map[string]bool
+}
+
+// Surge converts a generated sing-box profile into a Surge configuration.
+// Supported nodes: ss (obfs), vmess, trojan, hysteria2, tuic, socks, http.
+func Surge(ctx context.Context, opts option.Options) (*Conf, error) {
+	return confProfile(ctx, opts, confDialect{
+		name:  "surge",
+		sep:   ", ",
+		proxy: surgeProxy,
+		general: func(dns *ClashDNS) []string {
+			lines := []string{"loglevel = notify", "ipv6 = true", "dns-server = " + strings.Join(append([]string{"system"}, dns.DefaultNameserver...), ", ")}
+			for _, ns := range dns.Nameserver {
+				if strings.HasPrefix(ns, "https://") || strings.HasPrefix(ns, "tls://") {
+					lines = append(lines, "encrypted-dns-server = "+ns)
+					break
+				}
+			}
+			return lines
+		},
+		rules: map[string]bool{"DOMAIN": true, "DOMAIN-SUFFIX": true, "DOMAIN-KEYWORD": true, "IP-CIDR": true,
+			"IP-CIDR6": true, "GEOIP": true, "PROCESS-NAME": true, "DEST-PORT": true, "SRC-PORT": true, "SRC-IP": true},
+	})
+}
+
+// Loon converts a generated sing-box profile into a Loon configuration.
+// Supported nodes: ss (obfs), vmess, vless (reality), trojan, hysteria2, socks, http.
+func Loon(ctx context.Context, opts option.Options) (*Conf, error) {
+	return confProfile(ctx, opts, confDialect{
+		name:  "loon",
+		sep:   ",",
+		proxy: loonProxy,
+		general: func(dns *ClashDNS) []string {
+			lines := []string{"ip-mode = dual", "dns-server = " + strings.Join(append([]string{"system"}, dns.DefaultNameserver...), ",")}
+			for _, ns := range dns.Nameserver {
+				if strings.HasPrefix(ns, "https://") {
+					lines = append(lines, "doh-server = "+ns)
+					break
+				}
+			}
+			return lines
+		},
+		rules: map[string]bool{"DOMAIN": true, "DOMAIN-SUFFIX": true, "DOMAIN-KEYWORD": true, "IP-CIDR": true,
+			"IP-CIDR6": true, "GEOIP": true, "DEST-PORT": true, "SRC-IP": true},
+	})
+}
+
+// privateCIDRs stands in for sing-box ip_is_private, which neither client has.
+var privateCIDRs = []string{"IP-CIDR,10.0.0.0/8", "IP-CIDR,100.64.0.0/10", "IP-CIDR,127.0.0.0/8", "IP-CIDR,169.254.0.0/16",
+	"IP-CIDR,172.16.0.0/12", "IP-CIDR,192.168.0.0/16", "IP-CIDR6,fc00::/7", "IP-CIDR6,fe80::/10"}
+
+func confProfile(ctx context.Context, opts option.Options, d confDialect) (*Conf, error) {
+	c := &Conf{}
+	// "," and "=" are separators, so names holding them cannot be referenced
+	valid := func(name string) bool { return name != "" && !strings.ContainsAny(name, ",=\n") }
+
+	names := make(map[string]string) // sing-box tag -> policy name
+	names[directOutboundTag] = "DIRECT"
+	for i := range opts.Outbounds {
+		ot := &opts.Outbounds[i]
+		switch ot.Type {
+		case C.TypeDirect, C.TypeBlock, C.TypeDNS:
+			continue
+		case C.TypeSelector, C.TypeURLTest:
+			if valid(ot.Tag) {
+				names[ot.Tag] = ot.Tag
+			}
+			continue
+		}
+		if !valid(ot.Tag) {
+			c.Skipped = append(c.Skipped, ot.Tag)
+			continue
+		}
+		o, err := toObj(ctx, ot)
+		if err != nil {
+			return nil, err
+		}
+		line, err := d.proxy(ot.Type, o)
+		if err != nil {
+			c.Skipped = append(c.Skipped, ot.Tag)
+			continue
+		}
+		c.Proxies = append(c.Proxies, ot.Tag+" = "+line)
+		names[ot.Tag] = ot.Tag
+	}
+
+	members, err := groupMembers(ctx, opts.Outbounds, names)
+	if err != nil {
+		return nil, err
+	}
+	var groups []string
+	for i := range opts.Outbounds {
+		ot := &opts.Outbounds[i]
+		ms, ok := members[ot.Tag]
+		if !ok {
+			continue
+		}
+		o, err := toObj(ctx, ot)
+		if err != nil {
+			return nil, err
+		}
+		fields := append([]string{"select"}, ms...)
+		if ot.Type == C.TypeURLTest {
+			fields[0] = "url-test"
+			if u := o.str("url"); u != "" {
+				fields = append(fields, "url="+u)
+			}
+			if s := durationSeconds(o.str("interval")); s > 0 {
+				fields = append(fields, "interval="+strconv.Itoa(s))
+			}
+			if t := o.num("tolerance"); t > 0 {
+				fields = append(fields, "tolerance="+strconv.Itoa(t))
+			}
+		}
+		line := ot.Tag + " = " + strings.Join(fields, d.sep)
+		// the top-level selector first, as with Clash
+		if ot.Tag == proxyOutboundTag {
+			groups = append([]string{line}, groups...)
+		} else {
+			groups = append(groups, line)
+		}
+	}
+	c.Groups = groups
+
+	if opts.Route != nil {
+		if err := confRoute(ctx, c, opts.Route, names, d); err != nil {
+			return nil, err
+		}
+	}
+	dns := &ClashDNS{}
+	if opts.DNS != nil {
+		dns = clashDNS(ctx, opts.DNS)
+	}
+	c.General = d.general(dns)
+	return c, nil
+}
+
+// confRoute converts route rules with the Clash condition mapping, expanding
+// inline rule sets into plain rules and dropping conditions the client lacks.
+func confRoute(ctx context.Context, c *Conf, route *option.RouteOptions, names map[string]string, d confDialect) error {
+	sets := make(map[string]string)
+	payloads := make(map[string][]string)
+	for _, rs := range route.RuleSet {
+		if kind, name := geoRuleSetName(rs); kind != "" {
+			sets[rs.Tag] = strings.ToUpper(kind) + "," + name
+			continue
+		}
+		if rs.Type == C.RuleSetTypeInline || rs.Type == "" {
+			if payload, _, ok := clashPayload(ctx, rs.InlineOptions); ok {
+				sets[rs.Tag] = "RULE-SET," + rs.Tag
+				payloads[rs.Tag] = payload
+			}
+		}
+	}
+
+	target := func(tag string) string {
+		if n, ok := names[tag]; ok {
+			return n
+		}
+		return proxyOutboundTag
+	}
+
+	dropped := 0
+	for i := range route.Rules {
+		r := &route.Rules[i]
+		if r.Type == C.RuleTypeLogical {
+			continue
+		}
+		var policy string
+		switch r.DefaultOptions.Action {
+		case C.RuleActionTypeReject:
+			policy = "REJECT"
+		case C.RuleActionTypeRoute, "":
+			policy = target(r.DefaultOptions.RouteOptions.Outbound)
+		default:
+			continue
+		}
+		o, err := toObj(ctx, &r.DefaultOptions.RawDefaultRule)
+		if err != nil {
+			return err
+		}
+		conds, ok := clashConditions(o, sets)
+		if !ok {
+			continue
+		}
+		var expanded []string
+		for _, cond := range conds {
+			switch {
+			case strings.HasPrefix(cond, "RULE-SET,"):
+				expanded = append(expanded, payloads[strings.TrimPrefix(cond, "RULE-SET,")]...)
+			case cond == "GEOIP,LAN":
+				expanded = append(expanded, privateCIDRs...)
+			default:
+				expanded = append(expanded, cond)
+			}
+		}
+		for _, cond := range expanded {
+			typ, value, _ := strings.Cut(cond, ",")
+			switch typ {
+			case "DST-PORT":
+				typ = "DEST-PORT"
+			case "SRC-IP-CIDR":
+				typ = "SRC-IP"
+			case "GEOIP":
+				// only country codes, not the named sets (telegram, ...) mihomo knows
+				if len(value) != 2 {
+					typ = ""
+				}
+				value = strings.ToUpper(value)
+			}
+			if !d.rules[typ] {
+				dropped++
+				continue
+			}
+			cond = typ + "," + value
+			c.Rules = append(c.Rules, cond+","+policy+clashNoResolve(cond))
+		}
+	}
+	if dropped > 0 {
+		log.Printf("format: %s: dropped %d rule conditions the client does not support", d.name, dropped)
+	}
+
+	final := proxyOutboundTag
+	if route.Final != "" {
+		final = target(route.Final)
+	}
+	c.Rules = append(c.Rules, "FINAL,"+final)
+	return nil
+}
+
+// v2rayTransport reads the transport of vmess / vless / trojan nodes; for
+// gRPC path holds the service name.
+func v2rayTransport(o obj) (network, path, host string) {
+	t := o.child("transport")
+	if t == nil {
+		return "tcp", "", ""
+	}
+	switch t.str("type") {
+	case C.V2RayTransportTypeWebsocket:
+		if h := t.child("headers"); h != nil {
+			host = strings.Join(h.strs("Host"), ",")
+		}
+		return "ws", t.str("path"), host
+	case C.V2RayTransportTypeGRPC:
+		return "grpc", t.str("service_name"), ""
+	case C.V2RayTransportTypeHTTP:
+		return "http", t.str("path"), strings.Join(t.strs("host"), ",")
+	}
+	return t.str("type"), t.str("path"), t.str("host")
+}
+
+// surgeProxy maps one node onto the value of a Surge [Proxy] line.
+func surgeProxy(typ string, o obj) (string, error) {
+	fields := []string{"", o.str("server"), strconv.Itoa(o.num("server_port"))}
+	kv := func(k, v string) {
+		if v != "" {
+			fields = append(fields, k+"="+v)
+		}
+	}
+	quoted := func(s string) string { return strconv.Quote(s) }
+	tls := o.child("tls")
+	tlsEnabled := tls != nil && tls.boolean("enabled")
+	tlsOpts := func() error {
+		if !tlsEnabled {
+			return nil
+		}
+		if reality := tls.child("reality"); reality != nil && reality.boolean("enabled") {
+			return fmt.Errorf("reality")
+		}
+		kv("sni", tls.str("server_name"))
+		if tls.boolean("insecure") {
+			kv("skip-cert-verify", "true")
+		}
+		return nil
+	}
+	transport := func() error {
+		network, path, host := v2rayTransport(o)
+		switch network {
+		case "tcp":
+		case "ws":
+			kv("ws", "true")
+			kv("ws-path", path)
+			if host != "" {
+				kv("ws-headers", "Host:"+host)
+			}
+		default:
+			return fmt.Errorf("transport %q", network)
+		}
+		return nil
+	}
+
+	switch typ {
+	case C.TypeShadowsocks:
+		fields[0] = "ss"
+		kv("encrypt-method", o.str("method"))
+		kv("password", quoted(o.str("password")))
+		switch o.str("plugin") {
+		case "":
+		case "obfs-local":
+			po := pluginOpts(o.str("plugin_opts"))
+			kv("obfs", po["obfs"])
+			kv("obfs-host", po["obfs-host"])
+		default:
+			return "", fmt.Errorf("plugin %q", o.str("plugin"))
+		}
+		if o.str("network") != "tcp" {
+			kv("udp-relay", "true")
+		}
+	case C.TypeVMess:
+		fields[0] = "vmess"
+		kv("username", o.str("uuid"))
+		if o.num("alter_id") == 0 {
+			kv("vmess-aead", "true")
+		}
+		if tlsEnabled {
+			kv("tls", "true")
+		}
+		if err := tlsOpts(); err != nil {
+			return "", err
+		}
+		if err := transport(); err != nil {
+			return "", err
+		}
+	case C.TypeTrojan:
+		fields[0] = "trojan"
+		kv("password", quoted(o.str("password")))
+		if err := tlsOpts(); err != nil {
+			return "", err
+		}
+		if err := transport(); err != nil {
+			return "", err
+		}
+	case C.TypeHysteria2:
+		if obfs := o.child("obfs"); obfs != nil && obfs.str("type") != "" {
+			return "", fmt.Errorf("hysteria2 obfs")
+		}
+		fields[0] = "hysteria2"
+		kv("password", quoted(o.str("password")))
+		if err := tlsOpts(); err != nil {
+			return "", err
+		}
+		if down := o.num("down_mbps"); down > 0 {
+			kv("download-bandwidth", strconv.Itoa(down))
+		}
+	case C.TypeTUIC:
+		fields[0] = "tuic-v5"
+		kv("uuid", o.str("uuid"))
+		kv("password", quoted(o.str("password")))
+		if tlsEnabled {
+			kv("alpn", strings.Join(tls.strs("alpn"), ","))
+		}
+		if err := tlsOpts(); err != nil {
+			return "", err
+		}
+	case C.TypeSOCKS, C.TypeHTTP:
+		fields[0] = "socks5"
+		if typ == C.TypeHTTP {
+			fields[0] = "http"
+		}
+		if tlsEnabled {
+			fields[0] = map[string]string{"socks5": "socks5-tls", "http": "https"}[fields[0]]
+		}
+		if u := o.str("username"); u != "" {
+			fields = append(fields, u, quoted(o.str("password")))
+		}
+		if err := tlsOpts(); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("type %q has no Surge equivalent", typ)
+	}
+	return strings.Join(fields, ", "), nil
+}
+
+// loonProxy maps one node onto the value of a Loon [Proxy] line.
+func loonProxy(typ string, o obj) (string, error) {
+	fields := []string{"", o.str("server"), strconv.Itoa(o.num("server_port"))}
+	kv := func(k, v string) {
+		if v != "" {
+			fields = append(fields, k+"="+v)
+		}
+	}
+	quoted := func(s string) string { return strconv.Quote(s) }
+	tls := o.child("tls")
+	tlsEnabled := tls != nil && tls.boolean("enabled")
+	tlsOpts := func(overTLS bool) {
+		if !tlsEnabled {
+			return
+		}
+		if overTLS {
+			kv("over-tls", "true")
+		}
+		kv("sni", tls.str("server_name"))
+		if tls.boolean("insecure") {
+			kv("skip-cert-verify", "true")
+		}
+		if reality := tls.child("reality"); reality != nil && reality.boolean("enabled") {
+			kv("public-key", quoted(reality.str("public_key")))
+			kv("short-id", reality.str("short_id"))
+		}
+	}
+	transport := func() error {
+		network, path, host := v2rayTransport(o)
+		switch network {
+		case "tcp", "ws", "http":
+			kv("transport", network)
+			kv("path", path)
+			kv("host", host)
+		default:
+			return fmt.Errorf("transport %q", network)
+		}
+		return nil
+	}
+	reality := tls != nil && tls.child("reality") != nil && tls.child("reality").boolean("enabled")
+
+	switch typ {
+	case C.TypeShadowsocks:
+		fields[0] = "Shadowsocks"
+		fields = append(fields, o.str("method"), quoted(o.str("password")))
+		switch o.str("plugin") {
+		case "":
+		case "obfs-local":
+			po := pluginOpts(o.str("plugin_opts"))
+			kv("obfs-name", po["obfs"])
+			kv("obfs-host", po["obfs-host"])
+		default:
+			return "", fmt.Errorf("plugin %q", o.str("plugin"))
+		}
+		if o.str("network") != "tcp" {
+			kv("udp", "true")
+		}
+	case C.TypeVMess:
+		security := o.str("security")
+		if security == "" {
+			security = "auto"
+		}
+		fields[0] = "vmess"
+		fields = append(fields, security, quoted(o.str("uuid")))
+		if err := transport(); err != nil {
+			return "", err
+		}
+		kv("alterId", strconv.Itoa(o.num("alter_id")))
+		if reality {
+			return "", fmt.Errorf("vmess reality")
+		}
+		tlsOpts(true)
+	case C.TypeVLESS:
+		fields[0] = "VLESS"
+		fields = append(fields, quoted(o.str("uuid")))
+		if err := transport(); err != nil {
+			return "", err
+		}
+		kv("flow", o.str("flow"))
+		tlsOpts(true)
+	case C.TypeTrojan:
+		if reality {
+			return "", fmt.Errorf("trojan reality")
+		}
+		fields[0] = "trojan"
+		fields = append(fields, quoted(o.str("password")))
+		if err := transport(); err != nil {
+			return "", err
+		}
+		tlsOpts(false)
+	case C.TypeHysteria2:
+		fields[0] = "Hysteria2"
+		fields = append(fields, quoted(o.str("password")))
+		if obfs := o.child("obfs"); obfs != nil && obfs.str("type") != "" {
+			if obfs.str("type") != "salamander" {
+				return "", fmt.Errorf("hysteria2 obfs %q", obfs.str("type"))
+			}
+			kv("salamander-password", obfs.str("password"))
+		}
+		tlsOpts(false)
+		kv("udp", "true")
+	case C.TypeSOCKS, C.TypeHTTP:
+		fields[0] = "socks5"
+		if typ == C.TypeHTTP {
+			fields[0] = "http"
+			if tlsEnabled {
+				fields[0] = "https"
+			}
+		}
+		if u := o.str("username"); u != "" {
+			fields = append(fields, u, quoted(o.str("password")))
+		}
+		tlsOpts(typ == C.TypeSOCKS)
+	default:
+		return "", fmt.Errorf("type %q has no Loon equivalent", typ)
+	}
+	return strings.Join(fields, ","), nil
+}
@@ -0,0 +1,165 @@
+package format
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sagernet/sing-box/option"
+)
+
+var privateRules = []string{
+	"IP-CIDR,10.0.0.0/8,DIRECT,no-resolve", "IP-CIDR,100.64.0.0/10,DIRECT,no-resolve", "IP-CIDR,127.0.0.0/8,DIRECT,no-resolve",
+	"IP-CIDR,169.254.0.0/16,DIRECT,no-resolve", "IP-CIDR,172.16.0.0/12,DIRECT,no-resolve", "IP-CIDR,192.168.0.0/16,DIRECT,no-resolve",
+	"IP-CIDR6,fc00::/7,DIRECT,no-resolve", "IP-CIDR6,fe80::/10,DIRECT,no-resolve",
+}
+
+func TestConfProfiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		render  func(context.Context, option.Options) (*Conf, error)
+		proxies []string
+		groups  []string
+		skipped []string
+	}{
+		{
+			name:    "surge",
+			render:  Surge,
+			proxies: []string{`SS 01 = ss, ss.example.com, 8388, encrypt-method=aes-128-gcm, password="pass", udp-relay=true`},
+			// "," in a name cannot be referenced, reality is Loon only; nested ends up empty
+			groups: []string{
+				"proxy = select, auto-out, DIRECT, SS 01",
+				"auto-out = url-test, SS 01, url=https://www.gstatic.com/generate_204, interval=300, tolerance=50",
+			},
+			skipped: []string{"Trojan, 02", "VLESS 03", "SSH 04"},
+		},
+		{
+			name:   "loon",
+			render: Loon,
+			proxies: []string{
+				`SS 01 = Shadowsocks,ss.example.com,8388,aes-128-gcm,"pass",udp=true`,
+				`VLESS 03 = VLESS,vless.example.com,443,"b831381d-6324-4d53-ad4f-8cda48b30811",transport=tcp,flow=xtls-rprx-vision,over-tls=true,sni=www.microsoft.com,public-key="pbk",short-id=0123`,
+			},
+			groups: []string{
+				"proxy = select,auto-out,DIRECT,SS 01,VLESS 03",
+				"auto-out = url-test,SS 01,VLESS 03,url=https://www.gstatic.com/generate_204,interval=300,tolerance=50",
+			},
+			skipped: []string{"Trojan, 02", "SSH 04"},
+		},
+	}
+	// neither client has GEOSITE, ip_is_private expands to the private ranges
+	rules := append(append([]string{"DOMAIN-SUFFIX,example.org,proxy"}, privateRules...), "FINAL,proxy")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := tt.render(context.Background(), testProfile())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(c.Proxies, tt.proxies) {
+				t.Errorf("proxies = %q\nwant %q", c.Proxies, tt.proxies)
+			}
+			if !slices.Equal(c.Groups, tt.groups) {
+				t.Errorf("groups = %q\nwant %q", c.Groups, tt.groups)
+			}
+			if !slices.Equal(c.Rules, rules) {
+				t.Errorf("rules = %q", c.Rules)
+			}
+			if !slices.Equal(c.Skipped, tt.skipped) {
+				t.Errorf("skipped = %q, want %q", c.Skipped, tt.skipped)
+			}
+			text := string(c.Marshal())
+			for _, section := range []string{"[General]\n", "[Proxy]\n", "[Proxy Group]\n", "[Rule]\n"} {
+				if !strings.Contains(text, section) {
+					t.Errorf("no %s section", section)
+				}
+			}
+		})
+	}
+}
+
+func TestSurgeProxy(t *testing.T) {
+	tests := []struct {
+		name string
+		typ  string
+		o    obj
+		want string
+		err  bool
+	}{
+		{
+			name: "vmess ws tls",
+			typ:  "vmess",
+			o: obj{"server": "v.example", "server_port": 443.0, "uuid": "u", "tls": map[string]any{"enabled": true, "server_name": "v.example"},
+				"transport": map[string]any{"type": "ws", "path": "/ws", "headers": map[string]any{"Host": "cdn.example"}}},
+			want: "vmess, v.example, 443, username=u, vmess-aead=true, tls=true, sni=v.example, ws=true, ws-path=/ws, ws-headers=Host:cdn.example",
+		},
+		{
+			name: "https with auth",
+			typ:  "http",
+			o:    obj{"server": "p.example", "server_port": 443.0, "username": "user", "password": "p", "tls": map[string]any{"enabled": true}},
+			want: `https, p.example, 443, user, "p"`,
+		},
+		{name: "reality", typ: "vless", o: obj{"tls": map[string]any{"enabled": true, "reality": map[string]any{"enabled": true}}}, err: true},
+		{name: "hysteria2 obfs", typ: "hysteria2", o: obj{"obfs": map[string]any{"type": "salamander"}}, err: true},
+		{name: "grpc", typ: "trojan", o: obj{"transport": map[string]any{"type": "grpc"}}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := surgeProxy(tt.typ, tt.o)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("got %s, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoonProxy(t *testing.T) {
+	tests := []struct {
+		name string
+		typ  string
+		o    obj
+		want string
+		err  bool
+	}{
+		{
+			name: "hysteria2 salamander",
+			typ:  "hysteria2",
+			o:    obj{"server": "h.example", "server_port": 443.0, "password": "p", "obfs": map[string]any{"type": "salamander", "password": "o"}, "tls": map[string]any{"enabled": true, "server_name": "h.example"}},
+			want: `Hysteria2,h.example,443,"p",salamander-password=o,sni=h.example,udp=true`,
+		},
+		{
+			name: "trojan ws",
+			typ:  "trojan",
+			o:    obj{"server": "t.example", "server_port": 443.0, "password": "p", "tls": map[string]any{"enabled": true, "server_name": "t.example"}, "transport": map[string]any{"type": "ws", "path": "/ws"}},
+			want: `trojan,t.example,443,"p",transport=ws,path=/ws,sni=t.example`,
+		},
+		{name: "trojan reality", typ: "trojan", o: obj{"tls": map[string]any{"enabled": true, "reality": map[string]any{"enabled": true}}}, err: true},
+		{name: "tuic", typ: "tuic", o: obj{}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loonProxy(tt.typ, tt.o)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("got %s, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package format
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+)
+
+// URIs encodes every node of a generated sing-box profile as its share link
+// (ss, vmess, vless, trojan, hysteria2, tuic), the format v2rayN and
+// Shadowrocket import. Nodes a link cannot describe are returned in skipped.
+func URIs(ctx context.Context, opts option.Options) (links []string, skipped []string, err error) {
+	for i := range opts.Outbounds {
+		ot := &opts.Outbounds[i]
+		switch ot.Type {
+		case C.TypeDirect, C.TypeBlock, C.TypeDNS, C.TypeSelector, C.TypeURLTest:
+			continue
+		}
+		o, err := toObj(ctx, ot)
+		if err != nil {
+			return nil, nil, err
+		}
+		link, err := shareLink(ot.Type, ot.Tag, o)
+		if err != nil {
+			skipped = append(skipped, ot.Tag)
+			continue
+		}
+		links = append(links, link)
+	}
+	if len(links) == 0 {
+		return nil, skipped, errors.New("no node can be represented as a share link")
+	}
+	return links, skipped, nil
+}
+
+// EncodeURIs returns the links as a subscription body: one link per line, base64 encoded.
+func EncodeURIs(links []string) []byte {
+	src := []byte(strings.Join(links, "\n"))
+	dst := make([]byte, base64.StdEncoding.EncodedLen(len(src)))
+	base64.StdEncoding.Encode(dst, src)
+	return dst
+}
+
+// shareLink maps one node outbound onto its canonical share link.
+func shareLink(typ, name string, o obj) (string, error) {
+	if o.num("server_port") == 0 {
+		return "", errors.New("no server port")
+	}
+	host := net.JoinHostPort(o.str("server"), strconv.Itoa(o.num("server_port")))
+	fragment := "#" + url.PathEscape(name)
+
+	q := url.Values{}
+	tls := o.child("tls")
+	tlsEnabled := tls != nil && tls.boolean("enabled")
+	tlsParams := func(insecureKey string) {
+		if !tlsEnabled {
+			return
+		}
+		if sni := tls.str("server_name"); sni != "" {
+			q.Set("sni", sni)
+		}
+		if alpn := tls.strs("alpn"); len(alpn) > 0 {
+			q.Set("alpn", strings.Join(alpn, ","))
+		}
+		if tls.boolean("insecure") {
+			q.Set(insecureKey, "1")
+		}
+		if utls := tls.child("utls"); utls != nil && utls.boolean("enabled") && utls.str("fingerprint") != "" {
+			q.Set("fp", utls.str("fingerprint"))
+		}
+	}
+	// transportParams writes the v2ray transport in the query form shared by vless and trojan links
+	transportParams := func() error {
+		t := o.child("transport")
+		if t == nil {
+			q.Set("type", "tcp")
+			return nil
+		}
+		switch t.str("type") {
+		case C.V2RayTransportTypeWebsocket:
+			q.Set("type", "ws")
+			setIf(q, "path", t.str("path"))
+			if h := t.child("headers"); h != nil {
+				setIf(q, "host", strings.Join(h.strs("Host"), ","))
+			}
+		case C.V2RayTransportTypeHTTPUpgrade:
+			q.Set("type", "httpupgrade")
+			setIf(q, "path", t.str("path"))
+			setIf(q, "host", t.str("host"))
+		case C.V2RayTransportTypeGRPC:
+			q.Set("type", "grpc")
+			setIf(q, "serviceName", t.str("service_name"))
+		case C.V2RayTransportTypeHTTP:
+			q.Set("type", "http")
+			setIf(q, "path", t.str("path"))
+			setIf(q, "host", strings.Join(t.strs("host"), ","))
+		default:
+			return fmt.Errorf("transport %q", t.str("type"))
+		}
+		return nil
+	}
+
+	switch typ {
+	case C.TypeShadowsocks:
+		method, password := o.str("method"), o.str("password")
+		// SIP002: 2022 ciphers keep the user info percent-encoded, the rest base64url
+		userinfo := base64.RawURLEncoding.EncodeToString([]byte(method + ":" + password))
+		if strings.HasPrefix(method, "2022-") {
+			userinfo = url.UserPassword(method, password).String()
+		}
+		link := "ss://" + userinfo + "@" + host
+		switch o.str("plugin") {
+		case "":
+		case "obfs-local", "v2ray-plugin":
+			plugin := o.str("plugin")
+			if po := o.str("plugin_opts"); po != "" {
+				plugin += ";" + po
+			}
+			link += "/?plugin=" + url.QueryEscape(plugin)
+		default:
+			return "", fmt.Errorf("plugin %q", o.str("plugin"))
+		}
+		return link + fragment, nil
+	case C.TypeVMess:
+		v := map[string]string{
+			"v":    "2",
+			"ps":   name,
+			"add":  o.str("server"),
+			"port": strconv.Itoa(o.num("server_port")),
+			"id":   o.str("uuid"),
+			"aid":  strconv.Itoa(o.num("alter_id")),
+			"scy":  o.str("security"),
+			"net":  "tcp",
+			"type": "none",
+		}
+		if v["scy"] == "" {
+			v["scy"] = "auto"
+		}
+		if err := transportParams(); err != nil {
+			return "", err
+		}
+		tlsParams("allowInsecure")
+		if tlsEnabled {
+			v["tls"] = "tls"
+		}
+		// vmess links carry the same fields in a JSON object with their own names
+		for from, to := range map[string]string{"type": "net", "path": "path", "host": "host", "sni": "sni", "alpn": "alpn", "fp": "fp"} {
+			if q.Has(from) {
+				v[to] = q.Get(from)
+			}
+		}
+		if v["net"] == "grpc" {
+			v["path"] = q.Get("serviceName")
+		}
+		if v["net"] == "http" {
+			v["net"] = "h2"
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return "vmess://" + base64.StdEncoding.EncodeToString(b), nil
+	case C.TypeVLESS, C.TypeTrojan:
+		if err := transportParams(); err != nil {
+			return "", err
+		}
+		tlsParams("allowInsecure")
+		q.Set("security", "none")
+		if tlsEnabled {
+			q.Set("security", "tls")
+			if reality := tls.child("reality"); reality != nil && reality.boolean("enabled") {
+				q.Set("security", "reality")
+				q.Set("pbk", reality.str("public_key"))
+				setIf(q, "sid", reality.str("short_id"))
+			}
+		}
+		user := url.User(o.str("password")).String()
+		scheme := "trojan"
+		if typ == C.TypeVLESS {
+			user, scheme = o.str("uuid"), "vless"
+			q.Set("encryption", "none")
+			setIf(q, "flow", o.str("flow"))
+		}
+		return scheme + "://" + user + "@" + host + "?" + q.Encode() + fragment, nil
+	case C.TypeHysteria2:
+		tlsParams("insecure")
+		if obfs := o.child("obfs"); obfs != nil && obfs.str("type") != "" {
+			q.Set("obfs", obfs.str("type"))
+			q.Set("obfs-password", obfs.str("password"))
+		}
+		return "hysteria2://" + url.User(o.str("password")).String() + "@" + host + "/?" + q.Encode() + fragment, nil
+	case C.TypeTUIC:
+		tlsParams("allow_insecure")
+		setIf(q, "congestion_control", o.str("congestion_control"))
+		setIf(q, "udp_relay_mode", o.str("udp_relay_mode"))
+		userinfo := url.UserPassword(o.str("uuid"), o.str("password")).String()
+		return "tuic://" + userinfo + "@" + host + "?" + q.Encode() + fragment, nil
+	default:
+		return "", fmt.Errorf("type %q has no share link", typ)
+	}
+}
+
+func setIf(q url.Values, key, value string) {
+	if value != "" {
+		q.Set(key, value)
+	}
+}
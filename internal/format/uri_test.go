@@ -0,0 +1,129 @@
+package format
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+)
+
+func TestURIs(t *testing.T) {
+	links, skipped, err := URIs(context.Background(), testProfile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ss://YWVzLTEyOC1nY206cGFzcw@ss.example.com:8388#SS%2001",
+		"trojan://secret@trojan.example.com:443?path=%2Fws&security=tls&sni=trojan.example.com&type=ws#Trojan%2C%2002",
+		"vless://b831381d-6324-4d53-ad4f-8cda48b30811@vless.example.com:443?encryption=none&flow=xtls-rprx-vision&pbk=pbk&security=reality&sid=0123&sni=www.microsoft.com&type=tcp#VLESS%2003",
+	}
+	if !slices.Equal(links, want) {
+		t.Errorf("links = %q, want %q", links, want)
+	}
+	if !slices.Equal(skipped, []string{"SSH 04"}) {
+		t.Errorf("skipped = %q", skipped)
+	}
+
+	body, err := base64.StdEncoding.DecodeString(string(EncodeURIs(links)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != strings.Join(want, "\n") {
+		t.Errorf("encoded body = %q", body)
+	}
+}
+
+func TestURIsWithoutLinks(t *testing.T) {
+	opts := option.Options{Outbounds: []option.Outbound{
+		{Type: C.TypeSSH, Tag: "ssh", Options: &option.SSHOutboundOptions{ServerOptions: server("ssh.example.com", 22)}},
+	}}
+	if _, skipped, err := URIs(context.Background(), opts); err == nil || !slices.Equal(skipped, []string{"ssh"}) {
+		t.Errorf("skipped %q, error %v", skipped, err)
+	}
+}
+
+func TestShareLink(t *testing.T) {
+	tests := []struct {
+		name string
+		typ  string
+		o    obj
+		want string
+		err  bool
+	}{
+		{
+			name: "ss 2022 keeps userinfo",
+			typ:  "shadowsocks",
+			o:    obj{"server": "a.example", "server_port": 443.0, "method": "2022-blake3-aes-128-gcm", "password": "k/+="},
+			want: "ss://2022-blake3-aes-128-gcm:k%2F+=@a.example:443#n",
+		},
+		{
+			name: "ss plugin",
+			typ:  "shadowsocks",
+			o:    obj{"server": "a.example", "server_port": 443.0, "method": "aes-128-gcm", "password": "p", "plugin": "obfs-local", "plugin_opts": "obfs=http"},
+			want: "ss://YWVzLTEyOC1nY206cA@a.example:443/?plugin=obfs-local%3Bobfs%3Dhttp#n",
+		},
+		{
+			name: "hysteria2",
+			typ:  "hysteria2",
+			o:    obj{"server": "2001:db8::1", "server_port": 443.0, "password": "p@ss", "tls": map[string]any{"enabled": true, "server_name": "h.example", "insecure": true}},
+			want: "hysteria2://p%40ss@[2001:db8::1]:443/?insecure=1&sni=h.example#n",
+		},
+		{
+			name: "tuic",
+			typ:  "tuic",
+			o:    obj{"server": "t.example", "server_port": 443.0, "uuid": "u", "password": "p", "congestion_control": "bbr", "tls": map[string]any{"enabled": true, "alpn": []any{"h3"}}},
+			want: "tuic://u:p@t.example:443?alpn=h3&congestion_control=bbr#n",
+		},
+		{name: "no port", typ: "trojan", o: obj{"server": "a.example"}, err: true},
+		{name: "unknown plugin", typ: "shadowsocks", o: obj{"server_port": 1.0, "plugin": "kcptun"}, err: true},
+		{name: "unknown transport", typ: "vless", o: obj{"server_port": 1.0, "transport": map[string]any{"type": "quic"}}, err: true},
+		{name: "socks", typ: "socks", o: obj{"server_port": 1.0}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := shareLink(tt.typ, "n", tt.o)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("got %s, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVMessLink(t *testing.T) {
+	o := obj{"server": "v.example", "server_port": 443.0, "uuid": "u", "alter_id": 0.0,
+		"tls":       map[string]any{"enabled": true, "server_name": "v.example"},
+		"transport": map[string]any{"type": "grpc", "service_name": "svc"}}
+	link, err := shareLink("vmess", "Node 1", o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(link, "vmess://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]string
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"v": "2", "ps": "Node 1", "add": "v.example", "port": "443", "id": "u", "aid": "0",
+		"scy": "auto", "net": "grpc", "type": "none", "tls": "tls", "sni": "v.example", "path": "svc"}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+}
@@ -1,8 +1,13 @@
 package proxy
 
 import (
+	"bytes"
 	"context"
 	"log"
+	"net/url"
+	"reflect"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -24,8 +29,37 @@ var store atomic.Value // of type []upstream.ProxyOutbound
 var (
 	perMu       sync.Mutex
 	perUpstream map[string][]upstream.ProxyOutbound
+	perRouting  map[string]*upstream.Routing
+	perGroups   map[string][]upstream.ProxyGroup
+	perBase     map[string][]byte
+	perUserinfo map[string]*upstream.Userinfo
+	perUpdated  map[string]time.Time
+	// perFailures counts consecutive fetches without nodes; perLastNodes and
+	// perPrevNodes hold the node counts of the last two successful fetches
+	perFailures  map[string]int
+	perLastNodes map[string]int
+	perPrevNodes map[string]int
+	// upstreamNames maps upstream url to its configured name
+	upstreamNames map[string]string
 )
 
+// routings holds the preserved routing of upstreams with preserve_routing enabled.
+var routings atomic.Value // of type []upstream.Routing
+
+// version increases whenever the stored outbounds, routings or groups change.
+var version atomic.Uint64
+
+// groups holds the proxy groups of upstreams with import_groups enabled.
+var groups atomic.Value // of type []upstream.ProxyGroup
+
+// passThrough holds the raw sing-box profile of the first pass_through upstream.
+var passThrough atomic.Value // of type passThroughBase
+
+type passThroughBase struct {
+	url, name string
+	base      []byte
+}
+
 // master cancel to stop all tickers during reload.
 var (
 	masterMu     sync.Mutex
@@ -33,11 +67,19 @@ var (
 )
 
 type Upstream struct {
+	// Name 上游名称，供 token 的 upstreams 引用，缺省为 url
+	Name         string   `mapstructure:"name"`
 	URL          string   `mapstructure:"url"`
 	Timeout      int      `mapstructure:"timeout"`
 	Retry        int      `mapstructure:"retry"`
 	Interval     int      `mapstructure:"interval"`
 	NodeKeywords []string `mapstructure:"node_keywords"`
+	// PreserveRouting 保留上游 Clash 配置中的 rules / rule-providers
+	PreserveRouting bool `mapstructure:"preserve_routing"`
+	// ImportGroups 将上游 Clash proxy-groups 作为分组加入生成的配置
+	ImportGroups bool `mapstructure:"import_groups"`
+	// PassThrough 以上游 sing-box 配置为底稿，保留其分组、路由与 DNS
+	PassThrough bool `mapstructure:"pass_through"`
 }
 
 func Setup() error {
@@ -50,6 +92,9 @@ func Setup() error {
 
 	// initialize atomic store if not set
 	store.Store(make([]upstream.ProxyOutbound, 0))
+	routings.Store(make([]upstream.Routing, 0))
+	groups.Store(make([]upstream.ProxyGroup, 0))
+	passThrough.Store(passThroughBase{})
 	return reloadUpstreams(upstreams)
 }
 
@@ -72,6 +117,19 @@ func reloadUpstreams(upstreams []Upstream) error {
 	// reset per-upstream cache
 	perMu.Lock()
 	perUpstream = make(map[string][]upstream.ProxyOutbound)
+	perRouting = make(map[string]*upstream.Routing)
+	perGroups = make(map[string][]upstream.ProxyGroup)
+	perBase = make(map[string][]byte)
+	perUserinfo = make(map[string]*upstream.Userinfo)
+	perUpdated = make(map[string]time.Time)
+	perFailures = make(map[string]int)
+	perLastNodes = make(map[string]int)
+	perPrevNodes = make(map[string]int)
+	upstreamNames = make(map[string]string, len(upstreams))
+	for _, u := range upstreams {
+		upstreamNames[u.URL] = u.Name
+	}
+	version.Add(1)
 	perMu.Unlock()
 
 	ctx := include.Context(context.Background())
@@ -109,20 +167,36 @@ func startUpstream(ctx context.Context, u Upstream) {
 	}()
 }
 
-func FetchUpstreams(ctx context.Context, up Upstream) []upstream.ProxyOutbound {
-	var result []upstream.ProxyOutbound
+// Fetched is what one upstream contributes to the generated profiles.
+type Fetched struct {
+	Outbounds []upstream.ProxyOutbound
+	Routing   *upstream.Routing     // set when PreserveRouting is enabled
+	Groups    []upstream.ProxyGroup // set when ImportGroups is enabled
+	Base      []byte                // raw sing-box profile, set when PassThrough is enabled
+	Userinfo  *upstream.Userinfo    // traffic and expiry, when the provider reports them
+}
+
+// FetchUpstreams fetches the upstream outbounds, plus its routing and groups when enabled.
+func FetchUpstreams(ctx context.Context, up Upstream) Fetched {
+	return FetchUpstreamsWith(ctx, client, up)
+}
+
+// FetchUpstreamsWith is FetchUpstreams over the given http client.
+func FetchUpstreamsWith(ctx context.Context, client *resty.Client, up Upstream) Fetched {
+	var result Fetched
 
 	ups := []upstream.UpstreamSubscriber{
-		upstream.ClashVergeSubscriber{},
+		upstream.ClashVergeSubscriber{ProxyProviders: up.ImportGroups},
 		upstream.SingBoxSubscriber{},
 	}
 
 	for _, subscriber := range ups {
-		rs, err := subscriber.Outboards(ctx, client, up.URL)
+		sub, err := subscriber.Fetch(ctx, client, up.URL)
 		if err != nil {
 			log.Printf("Failed to fetch from %s: %v", subscriber.Name(), err)
 			continue
 		}
+		rs := sub.Outbounds
 
 		// 如果没有获取到任何出站，继续尝试下一个订阅源
 		if len(rs) == 0 {
@@ -142,7 +216,24 @@ func FetchUpstreams(ctx context.Context, up Upstream) []upstream.ProxyOutbound {
 			filtered = rs
 		}
 		if len(filtered) > 0 {
-			result = append(result, filtered...)
+			result.Outbounds = append(result.Outbounds, filtered...)
+			result.Userinfo = sub.Userinfo
+			if up.PreserveRouting && sub.Clash != nil {
+				result.Routing = sub.Clash.Routing(ctx, client)
+				for _, entry := range result.Routing.Unsupported {
+					log.Printf("proxy: %s: unsupported rule %q", up.URL, entry)
+				}
+			}
+			if up.PassThrough && sub.SingBox != nil {
+				result.Base = sub.SingBox.Raw
+			}
+			if up.ImportGroups && sub.Clash != nil {
+				var unsupported []string
+				result.Groups, unsupported = sub.Clash.ProxyGroups()
+				for _, entry := range unsupported {
+					log.Printf("proxy: %s: unsupported %s", up.URL, entry)
+				}
+			}
 			break
 		}
 	}
@@ -150,6 +241,126 @@ func FetchUpstreams(ctx context.Context, up Upstream) []upstream.ProxyOutbound {
 	return result
 }
 
+// Version identifies the current node snapshot; it changes on every upstream refresh and reload.
+func Version() uint64 {
+	return version.Load()
+}
+
+// GetOutboundsFrom returns the current outbounds of the upstreams listed by name or url.
+func GetOutboundsFrom(upstreams []string) []upstream.ProxyOutbound {
+	perMu.Lock()
+	defer perMu.Unlock()
+
+	var out []upstream.ProxyOutbound
+	urls := make([]string, 0, len(perUpstream))
+	for u := range perUpstream {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+	for _, u := range urls {
+		name := upstreamNames[u]
+		if slices.Contains(upstreams, u) || (name != "" && slices.Contains(upstreams, name)) {
+			out = append(out, perUpstream[u]...)
+		}
+	}
+	return out
+}
+
+// UpstreamStatus is the state of one upstream as of its last fetch.
+type UpstreamStatus struct {
+	Name      string             `json:"name"`
+	URL       string             `json:"url"`
+	Nodes     int                `json:"nodes"`
+	PrevNodes int                `json:"prev_nodes"` // of the successful fetch before the latest one
+	Failures  int                `json:"failures"`   // consecutive fetches without nodes
+	UpdatedAt time.Time          `json:"updated_at"`
+	Userinfo  *upstream.Userinfo `json:"userinfo,omitempty"`
+}
+
+// DisplayName is the configured name, or the host of the url.
+func (s UpstreamStatus) DisplayName() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	if u, err := url.Parse(s.URL); err == nil && u.Host != "" {
+		return u.Hostname()
+	}
+	return s.URL
+}
+
+// GetUpstreamStatus returns the status of every fetched upstream, sorted by url.
+func GetUpstreamStatus() []UpstreamStatus {
+	perMu.Lock()
+	defer perMu.Unlock()
+
+	urls := make([]string, 0, len(perUpstream))
+	for u := range perUpstream {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+	out := make([]UpstreamStatus, 0, len(urls))
+	for _, u := range urls {
+		out = append(out, UpstreamStatus{
+			Name:      upstreamNames[u],
+			URL:       u,
+			Nodes:     len(perUpstream[u]),
+			PrevNodes: perPrevNodes[u],
+			Failures:  perFailures[u],
+			UpdatedAt: perUpdated[u],
+			Userinfo:  perUserinfo[u],
+		})
+	}
+	return out
+}
+
+// GetUserinfo aggregates the traffic and expiry of the upstreams listed by
+// name or url, or of all upstreams when none are listed; nil when none report any.
+func GetUserinfo(upstreams []string) *upstream.Userinfo {
+	perMu.Lock()
+	defer perMu.Unlock()
+
+	var total *upstream.Userinfo
+	for u, info := range perUserinfo {
+		name := upstreamNames[u]
+		if len(upstreams) > 0 && !slices.Contains(upstreams, u) && (name == "" || !slices.Contains(upstreams, name)) {
+			continue
+		}
+		if total == nil {
+			total = &upstream.Userinfo{}
+		}
+		*total = total.Add(*info)
+	}
+	return total
+}
+
+// GetPassThrough returns the raw profile of the pass-through upstream when it
+// is listed by name or url, or none are listed; nil when none is configured.
+func GetPassThrough(upstreams []string) []byte {
+	pt, _ := passThrough.Load().(passThroughBase)
+	if len(upstreams) > 0 && !slices.Contains(upstreams, pt.url) && (pt.name == "" || !slices.Contains(upstreams, pt.name)) {
+		return nil
+	}
+	return pt.base
+}
+
+// GetProxyGroups returns a snapshot of the imported upstream proxy groups.
+func GetProxyGroups() []upstream.ProxyGroup {
+	v := groups.Load()
+	if v == nil {
+		return nil
+	}
+	return v.([]upstream.ProxyGroup)
+}
+
+// GetRoutings returns a snapshot of the preserved upstream routings.
+func GetRoutings() []upstream.Routing {
+	v := routings.Load()
+	if v == nil {
+		return nil
+	}
+	return v.([]upstream.Routing)
+}
+
 // updateStore replaces the global OutboundsStore content atomically.
 func updateStore(items []upstream.ProxyOutbound) {
 	// Store new aggregated slice atomically
@@ -175,28 +386,135 @@ func GetOutbounds[T upstream.ProxyOutbound]() []T {
 }
 
 // updatePerAndAggregate replaces perUpstream[url] and atomically updates aggregated store.
-func updatePerAndAggregate(url string, items []upstream.ProxyOutbound) {
+func updatePerAndAggregate(url string, fetched Fetched) {
 	perMu.Lock()
 	defer perMu.Unlock()
 
+	// a fetch returning what is already stored keeps the version, and so the rendered profiles' ETags
+	_, seen := perUpstream[url]
+	prev := Fetched{Outbounds: perUpstream[url], Routing: perRouting[url], Groups: perGroups[url], Base: perBase[url], Userinfo: perUserinfo[url]}
+	changed := !seen || !sameFetched(prev, fetched)
+
 	if perUpstream == nil {
 		perUpstream = make(map[string][]upstream.ProxyOutbound)
 	}
 
 	// store a copy to avoid external mutation
-	perUpstream[url] = append([]upstream.ProxyOutbound(nil), items...)
+	perUpstream[url] = append([]upstream.ProxyOutbound(nil), fetched.Outbounds...)
+	if perRouting == nil {
+		perRouting = make(map[string]*upstream.Routing)
+	}
+	if fetched.Routing != nil {
+		perRouting[url] = fetched.Routing
+	} else {
+		delete(perRouting, url)
+	}
+	if perGroups == nil {
+		perGroups = make(map[string][]upstream.ProxyGroup)
+	}
+	if len(fetched.Groups) > 0 {
+		perGroups[url] = fetched.Groups
+	} else {
+		delete(perGroups, url)
+	}
+	if perBase == nil {
+		perBase = make(map[string][]byte)
+	}
+	if perUserinfo == nil {
+		perUserinfo = make(map[string]*upstream.Userinfo)
+	}
+	if fetched.Userinfo != nil {
+		perUserinfo[url] = fetched.Userinfo
+	} else {
+		delete(perUserinfo, url)
+	}
+	if perUpdated == nil {
+		perUpdated = make(map[string]time.Time)
+	}
+	perUpdated[url] = time.Now()
+	if perFailures == nil {
+		perFailures = make(map[string]int)
+		perLastNodes = make(map[string]int)
+		perPrevNodes = make(map[string]int)
+	}
+	if len(fetched.Outbounds) == 0 {
+		perFailures[url]++
+	} else {
+		perFailures[url] = 0
+		perPrevNodes[url] = perLastNodes[url]
+		perLastNodes[url] = len(fetched.Outbounds)
+	}
+	if len(fetched.Base) > 0 {
+		perBase[url] = fetched.Base
+	} else {
+		delete(perBase, url)
+	}
 
-	// aggregate all slices
+	if !changed {
+		return
+	}
+
+	// aggregate all slices, sorted by url so the generated profile stays stable between requests
+	urls := make([]string, 0, len(perUpstream))
 	total := 0
-	for _, list := range perUpstream {
+	for u, list := range perUpstream {
+		urls = append(urls, u)
 		total += len(list)
 	}
+	sort.Strings(urls)
 	agg := make([]upstream.ProxyOutbound, 0, total)
-	for _, list := range perUpstream {
-		agg = append(agg, list...)
+	for _, u := range urls {
+		agg = append(agg, perUpstream[u]...)
 	}
 
 	updateStore(agg)
+
+	urls = urls[:0]
+	for u := range perRouting {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+	rts := make([]upstream.Routing, 0, len(urls))
+	for _, u := range urls {
+		rts = append(rts, *perRouting[u])
+	}
+	routings.Store(rts)
+
+	urls = urls[:0]
+	for u := range perGroups {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+	var gs []upstream.ProxyGroup
+	for _, u := range urls {
+		gs = append(gs, perGroups[u]...)
+	}
+	groups.Store(gs)
+
+	// only one profile can serve as the base; the first upstream by url wins
+	urls = urls[:0]
+	for u := range perBase {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+	var pt passThroughBase
+	if len(urls) > 0 {
+		pt = passThroughBase{url: urls[0], name: upstreamNames[urls[0]], base: perBase[urls[0]]}
+		if len(urls) > 1 {
+			log.Printf("proxy: %d pass_through upstreams, using %s as the base profile", len(urls), urls[0])
+		}
+	}
+	passThrough.Store(pt)
+	version.Add(1)
+}
+
+// sameFetched reports whether a and b hold the same content; nil and empty lists are equal.
+func sameFetched(a, b Fetched) bool {
+	return len(a.Outbounds) == len(b.Outbounds) && (len(a.Outbounds) == 0 || reflect.DeepEqual(a.Outbounds, b.Outbounds)) &&
+		len(a.Groups) == len(b.Groups) && (len(a.Groups) == 0 || reflect.DeepEqual(a.Groups, b.Groups)) &&
+		bytes.Equal(a.Base, b.Base) &&
+		reflect.DeepEqual(a.Routing, b.Routing) &&
+		reflect.DeepEqual(a.Userinfo, b.Userinfo)
 }
 
 func AnyContained(s string, subs []string) bool {
@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/dingdayu/go-project-template/internal/upstream"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+)
+
+// testNode is a minimal upstream node named after its outbound tag.
+type testNode string
+
+func (n testNode) Name() string { return string(n) }
+
+func (n testNode) ToOutbound() (option.Outbound, error) {
+	return option.Outbound{Type: C.TypeSOCKS, Tag: string(n), Options: option.SOCKSOutboundOptions{}}, nil
+}
+
+func TestUpdatePerAndAggregate(t *testing.T) {
+	t.Cleanup(func() {
+		if err := reloadUpstreams(nil); err != nil {
+			t.Error(err)
+		}
+	})
+	if err := reloadUpstreams(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	names := func() []string {
+		var out []string
+		for _, ot := range GetOutbounds[upstream.ProxyOutbound]() {
+			out = append(out, ot.Name())
+		}
+		return out
+	}
+
+	v := Version()
+	updatePerAndAggregate("https://b.example", Fetched{Outbounds: []upstream.ProxyOutbound{testNode("b1")}})
+	updatePerAndAggregate("https://a.example", Fetched{Outbounds: []upstream.ProxyOutbound{testNode("a1")}})
+	if got := names(); len(got) != 2 || got[0] != "a1" || got[1] != "b1" {
+		t.Errorf("outbounds %v, want sorted by upstream url", got)
+	}
+	if Version() == v {
+		t.Fatal("version kept after new nodes")
+	}
+
+	v = Version()
+	updatePerAndAggregate("https://a.example", Fetched{Outbounds: []upstream.ProxyOutbound{testNode("a1")}, Groups: []upstream.ProxyGroup{}})
+	if Version() != v {
+		t.Error("version bumped by an unchanged fetch")
+	}
+	updatePerAndAggregate("https://a.example", Fetched{Outbounds: []upstream.ProxyOutbound{testNode("a1")}, Userinfo: &upstream.Userinfo{Upload: 1}})
+	if Version() == v {
+		t.Error("version kept after the userinfo changed")
+	}
+}
+
+func TestGetPassThrough(t *testing.T) {
+	t.Cleanup(func() {
+		if err := reloadUpstreams(nil); err != nil {
+			t.Error(err)
+		}
+	})
+	if err := reloadUpstreams(nil); err != nil {
+		t.Fatal(err)
+	}
+	// named without starting its fetch ticker
+	perMu.Lock()
+	upstreamNames["https://sb.example"] = "sb"
+	perMu.Unlock()
+	base := []byte(`{"outbounds":[]}`)
+	updatePerAndAggregate("https://sb.example", Fetched{Base: base})
+
+	tests := []struct {
+		upstreams []string
+		want      bool
+	}{
+		{nil, true},
+		{[]string{"sb"}, true},
+		{[]string{"https://sb.example"}, true},
+		{[]string{"other"}, false},
+	}
+	for _, tt := range tests {
+		if got := GetPassThrough(tt.upstreams) != nil; got != tt.want {
+			t.Errorf("GetPassThrough(%v) returned a profile: %v", tt.upstreams, got)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Package render caches rendered subscription profiles.
+package render
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Entry is a rendered profile ready to be written to the response.
+type Entry struct {
+	Body        []byte
+	ContentType string
+	ETag        string
+	Headers     map[string]string
+	CreatedAt   time.Time
+}
+
+type CacheConfig struct {
+	Enabled bool          `mapstructure:"enabled"`
+	TTL     time.Duration `mapstructure:"ttl"` // bounds staleness for inputs without a version, e.g. managed rule sets in the db
+	MaxSize int           `mapstructure:"max_entries"`
+}
+
+func GetCacheConfig() (CacheConfig, error) {
+	cfg := CacheConfig{
+		Enabled: true,
+		TTL:     5 * time.Minute,
+		MaxSize: 1024,
+	}
+	if err := viper.UnmarshalKey("cache", &cfg); err != nil {
+		return cfg, fmt.Errorf("render.GetCacheConfig: unable to decode 'cache' into struct: %v", err)
+	}
+	return cfg, nil
+}
+
+var (
+	mu      sync.Mutex
+	entries = make(map[string]*Entry)
+)
+
+// generation changes on every Invalidate, so keys built before it never hit again.
+var generation atomic.Uint64
+
+// Key builds a cache key from the node snapshot version and the request variant parts.
+func Key(version uint64, parts ...string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d/%d", generation.Load(), version)
+	for _, p := range parts {
+		// length prefix keeps ("ab","c") and ("a","bc") apart
+		fmt.Fprintf(h, "/%d:%s", len(p), p)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get returns the cached entry for key when caching is enabled and it has not expired.
+func Get(key string) (*Entry, bool) {
+	cfg, err := GetCacheConfig()
+	if err != nil || !cfg.Enabled {
+		return nil, false
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	e, ok := entries[key]
+	if !ok {
+		return nil, false
+	}
+	if cfg.TTL > 0 && time.Since(e.CreatedAt) > cfg.TTL {
+		delete(entries, key)
+		return nil, false
+	}
+	return e, true
+}
+
+// Put stores body under key and returns the entry with its strong ETag.
+func Put(key string, body []byte, contentType string, headers map[string]string) *Entry {
+	sum := sha256.Sum256(body)
+	e := &Entry{
+		Body:        body,
+		ContentType: contentType,
+		ETag:        `"` + hex.EncodeToString(sum[:16]) + `"`,
+		Headers:     headers,
+		CreatedAt:   time.Now(),
+	}
+
+	cfg, err := GetCacheConfig()
+	if err != nil || !cfg.Enabled {
+		return e
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if cfg.MaxSize > 0 && len(entries) >= cfg.MaxSize {
+		evict(cfg)
+	}
+	entries[key] = e
+	return e
+}
+
+// evict drops expired entries, then the oldest one if the cache is still full; mu must be held.
+func evict(cfg CacheConfig) {
+	var oldestKey string
+	var oldest time.Time
+	for k, e := range entries {
+		if cfg.TTL > 0 && time.Since(e.CreatedAt) > cfg.TTL {
+			delete(entries, k)
+			continue
+		}
+		if oldestKey == "" || e.CreatedAt.Before(oldest) {
+			oldestKey, oldest = k, e.CreatedAt
+		}
+	}
+	if len(entries) >= cfg.MaxSize && oldestKey != "" {
+		delete(entries, oldestKey)
+	}
+}
+
+// Invalidate drops every cached profile, e.g. after a config change.
+func Invalidate() {
+	generation.Add(1)
+	mu.Lock()
+	entries = make(map[string]*Entry)
+	mu.Unlock()
+	log.Printf("render: profile cache invalidated")
+}
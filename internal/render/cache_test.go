@@ -0,0 +1,87 @@
+package render
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestKey(t *testing.T) {
+	if Key(1, "ab", "c") == Key(1, "a", "bc") {
+		t.Error("parts are not kept apart")
+	}
+	if Key(1, "t1") == Key(2, "t1") {
+		t.Error("version is not part of the key")
+	}
+	k := Key(1, "t1")
+	if Key(1, "t1") != k {
+		t.Error("key is not stable")
+	}
+	Invalidate()
+	if Key(1, "t1") == k {
+		t.Error("key survives Invalidate")
+	}
+}
+
+func TestGetPut(t *testing.T) {
+	t.Cleanup(func() {
+		viper.Set("cache", nil)
+		Invalidate()
+	})
+
+	viper.Set("cache", map[string]any{"enabled": false})
+	if e := Put("k", []byte("body"), "text/plain", nil); e.ETag == "" {
+		t.Error("disabled cache returns no ETag")
+	}
+	if _, ok := Get("k"); ok {
+		t.Error("disabled cache stored an entry")
+	}
+
+	viper.Set("cache", map[string]any{"enabled": true, "ttl": time.Hour, "max_entries": 2})
+	a := Put("a", []byte("body"), "text/plain", map[string]string{"X-Skipped-Nodes": "1"})
+	if b := Put("b", []byte("body"), "text/plain", nil); b.ETag != a.ETag {
+		t.Errorf("same body, ETags %s and %s", a.ETag, b.ETag)
+	}
+	e, ok := Get("a")
+	if !ok || string(e.Body) != "body" || e.Headers["X-Skipped-Nodes"] != "1" {
+		t.Fatalf("Get(a) = %+v, %v", e, ok)
+	}
+	if c := Put("c", []byte("other"), "text/plain", nil); c.ETag == a.ETag {
+		t.Error("different bodies share an ETag")
+	}
+	// full at two entries: the oldest one makes room
+	if _, ok := Get("a"); ok {
+		t.Error("oldest entry not evicted")
+	}
+	if _, ok := Get("c"); !ok {
+		t.Error("newest entry missing")
+	}
+}
+
+func TestGetExpired(t *testing.T) {
+	viper.Set("cache", map[string]any{"enabled": true, "ttl": time.Minute})
+	t.Cleanup(func() {
+		viper.Set("cache", nil)
+		Invalidate()
+	})
+
+	Put("fresh", []byte("body"), "text/plain", nil)
+	Put("old", []byte("body"), "text/plain", nil)
+	mu.Lock()
+	entries["old"].CreatedAt = time.Now().Add(-2 * time.Minute)
+	mu.Unlock()
+
+	if _, ok := Get("old"); ok {
+		t.Error("expired entry returned")
+	}
+	mu.Lock()
+	_, kept := entries["old"]
+	mu.Unlock()
+	if kept {
+		t.Error("expired entry not dropped")
+	}
+	if _, ok := Get("fresh"); !ok {
+		t.Error("fresh entry missing")
+	}
+}
@@ -0,0 +1,109 @@
+package ruleset
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dingdayu/go-project-template/internal/singbox"
+	"github.com/dingdayu/go-project-template/model/dao"
+	sjson "github.com/sagernet/sing/common/json"
+)
+
+// compiled caches compiled managed rule sets by tag together with the hash of
+// their source, so a rule set is only recompiled after it changes.
+var (
+	compiledMu sync.Mutex
+	compiled   = map[string]compiledEntry{}
+)
+
+type compiledEntry struct {
+	sum   string
+	entry *Entry
+}
+
+// stored caches the enabled managed rule sets of the database, a
+// storedRows, so profiles do not query it on every render. Reload refreshes
+// it, and so does the first request after storedMaxAge.
+var stored atomic.Value
+
+// storedMaxAge bounds how long edits to the database table go unnoticed.
+const storedMaxAge = time.Minute
+
+type storedRows struct {
+	rows     []singbox.StoredRuleSet
+	loadedAt time.Time
+}
+
+// loadStored reads the managed rule sets of the database into stored.
+func loadStored(ctx context.Context) ([]singbox.StoredRuleSet, error) {
+	rows, err := dao.ListManagedRuleSets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ruleset.loadStored: %w", err)
+	}
+	sets := make([]singbox.StoredRuleSet, 0, len(rows))
+	for _, row := range rows {
+		sets = append(sets, singbox.StoredRuleSet{Tag: row.Tag, Mode: row.Mode, Outbound: row.Outbound, Content: row.Content})
+	}
+	stored.Store(storedRows{rows: sets, loadedAt: time.Now()})
+	return sets, nil
+}
+
+// ManagedRuleSets returns the managed rule sets of the config and the cached
+// database rows, reading the rows with ctx when the cache is empty or stale.
+// A failed read keeps the previous rows, or none at all (say the table was
+// never migrated), so profiles still render with the config's sets.
+func ManagedRuleSets(ctx context.Context) ([]singbox.ManagedRuleSet, error) {
+	cached, ok := stored.Load().(storedRows)
+	rows := cached.rows
+	if !ok || time.Since(cached.loadedAt) > storedMaxAge {
+		fresh, err := loadStored(ctx)
+		if err == nil {
+			rows = fresh
+		} else {
+			log.Printf("%v, using %d rows read before", err, len(rows))
+			// retry after storedMaxAge rather than on every request
+			stored.Store(storedRows{rows: rows, loadedAt: time.Now()})
+		}
+	}
+	return singbox.GetManagedRuleSets(rows)
+}
+
+// Managed returns the compiled `.srs` of the managed rule set with the given
+// tag; ok is false when no such managed rule set exists.
+func Managed(ctx context.Context, tag string) (e *Entry, ok bool, err error) {
+	sets, err := ManagedRuleSets(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, rs := range sets {
+		if rs.Tag != tag {
+			continue
+		}
+		source, err := sjson.Marshal(rs.Rules)
+		if err != nil {
+			return nil, true, err
+		}
+		h := sha256.Sum256(append(source, rs.Version))
+		sum := hex.EncodeToString(h[:])
+
+		compiledMu.Lock()
+		defer compiledMu.Unlock()
+		if c, ok := compiled[tag]; ok && c.sum == sum {
+			return c.entry, true, nil
+		}
+		content, err := rs.Compile()
+		if err != nil {
+			return nil, true, err
+		}
+		e := &Entry{Tag: tag, Source: "managed", Content: content, ETag: etag(content), UpdatedAt: time.Now()}
+		compiled[tag] = compiledEntry{sum: sum, entry: e}
+		return e, true, nil
+	}
+	return nil, false, nil
+}
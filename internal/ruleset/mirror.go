@@ -0,0 +1,248 @@
+// Package ruleset mirrors the remote rule sets referenced by generated
+// profiles so clients can download them from the adapter itself.
+package ruleset
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dingdayu/go-project-template/internal/singbox"
+	"github.com/spf13/viper"
+	"resty.dev/v3"
+)
+
+var client = resty.New()
+
+// Entry is a mirrored rule set file.
+type Entry struct {
+	Tag       string
+	Source    string
+	Content   []byte
+	ETag      string
+	UpdatedAt time.Time
+}
+
+// store holds map[tag]*Entry for lock-free reads; a stored map is never mutated.
+var store atomic.Value
+
+// sources maps tag to upstream URL for the rule sets being mirrored.
+var sources atomic.Value
+
+// putMu serialises writers of store.
+var putMu sync.Mutex
+
+var (
+	masterMu     sync.Mutex
+	masterCancel context.CancelFunc
+)
+
+type MirrorConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	Dir      string `mapstructure:"dir"`
+	Interval int    `mapstructure:"interval"` // seconds
+	Timeout  int    `mapstructure:"timeout"`  // seconds
+}
+
+// GetMirrorConfig reads the `rule_set.mirror` key.
+func GetMirrorConfig() (MirrorConfig, error) {
+	cfg := MirrorConfig{
+		Dir:      "./data/rules",
+		Interval: 86400,
+		Timeout:  60,
+	}
+	if err := viper.UnmarshalKey("rule_set.mirror", &cfg); err != nil {
+		return cfg, fmt.Errorf("ruleset.GetMirrorConfig: unable to decode 'rule_set.mirror' into struct: %v", err)
+	}
+	return cfg, nil
+}
+
+// Setup loads cached files from disk and starts the refresh loop.
+func Setup() error {
+	store.Store(map[string]*Entry{})
+	sources.Store(map[string]string{})
+	return Reload()
+}
+
+// Reload re-reads the managed rule sets of the database and the mirror
+// config, and restarts the refresh loop.
+func Reload() error {
+	// a failed read keeps the previous rows
+	if _, err := loadStored(context.Background()); err != nil {
+		log.Printf("ruleset.Reload: %v", err)
+	}
+
+	cfg, err := GetMirrorConfig()
+	if err != nil {
+		log.Printf("ruleset.Reload: %v", err)
+		return err
+	}
+
+	masterMu.Lock()
+	defer masterMu.Unlock()
+	if masterCancel != nil {
+		masterCancel()
+		masterCancel = nil
+	}
+	if !cfg.Enabled {
+		return nil
+	}
+
+	src := make(map[string]string)
+	for _, rs := range singbox.RemoteRuleSets() {
+		src[rs.Tag] = rs.RemoteOptions.URL
+	}
+	sources.Store(src)
+	loadFromDisk(cfg.Dir, src)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	masterCancel = cancel
+	go refreshLoop(ctx, cfg, src)
+	return nil
+}
+
+// Get returns the mirrored rule set with the given tag.
+func Get(tag string) (*Entry, bool) {
+	m, _ := store.Load().(map[string]*Entry)
+	e, ok := m[tag]
+	return e, ok
+}
+
+// Source returns the upstream URL of a mirrored rule set, used as a fallback
+// while the mirror has not downloaded it yet.
+func Source(tag string) (string, bool) {
+	m, _ := sources.Load().(map[string]string)
+	u, ok := m[tag]
+	return u, ok
+}
+
+func refreshLoop(ctx context.Context, cfg MirrorConfig, src map[string]string) {
+	interval := time.Duration(cfg.Interval) * time.Second
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+
+	refreshAll(ctx, cfg, src)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			refreshAll(ctx, cfg, src)
+		case <-ctx.Done():
+			log.Printf("ruleset: mirror refresh stopped")
+			return
+		}
+	}
+}
+
+func refreshAll(ctx context.Context, cfg MirrorConfig, src map[string]string) {
+	for tag, u := range src {
+		content, err := download(ctx, u, time.Duration(cfg.Timeout)*time.Second)
+		if err != nil {
+			log.Printf("ruleset: refresh %s from %s failed: %v", tag, u, err)
+			continue
+		}
+		put(&Entry{Tag: tag, Source: u, Content: content, ETag: etag(content), UpdatedAt: time.Now()})
+		if err := writeFile(cfg.Dir, tag, content); err != nil {
+			log.Printf("ruleset: cache %s to disk failed: %v", tag, err)
+		}
+	}
+}
+
+func download(ctx context.Context, u string, timeout time.Duration) ([]byte, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	resp, err := client.R().SetContext(ctx).Get(u)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status())
+	}
+	if len(resp.Bytes()) == 0 {
+		return nil, fmt.Errorf("empty response")
+	}
+	return resp.Bytes(), nil
+}
+
+// put stores e by copying the current map, keeping readers lock-free.
+func put(e *Entry) {
+	putMu.Lock()
+	defer putMu.Unlock()
+
+	current, _ := store.Load().(map[string]*Entry)
+	next := make(map[string]*Entry, len(current)+1)
+	for k, v := range current {
+		next[k] = v
+	}
+	next[e.Tag] = e
+	store.Store(next)
+}
+
+func loadFromDisk(dir string, src map[string]string) {
+	for tag, u := range src {
+		if _, ok := Get(tag); ok {
+			continue
+		}
+		if !validTag(tag) {
+			continue
+		}
+		path := filepath.Join(dir, tag+".srs")
+		content, err := os.ReadFile(path)
+		if err != nil || len(content) == 0 {
+			continue
+		}
+		updatedAt := time.Now()
+		if fi, err := os.Stat(path); err == nil {
+			updatedAt = fi.ModTime()
+		}
+		put(&Entry{Tag: tag, Source: u, Content: content, ETag: etag(content), UpdatedAt: updatedAt})
+	}
+}
+
+// writeFile replaces the cached file atomically so a crash never leaves a truncated rule set.
+func writeFile(dir, tag string, content []byte) error {
+	if !validTag(tag) {
+		return fmt.Errorf("tag %q is not usable as a file name", tag)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, tag+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, tag+".srs"))
+}
+
+// etag returns a strong ETag for content.
+func etag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// validTag reports whether tag can be used as a file name inside the mirror dir.
+func validTag(tag string) bool {
+	return tag != "" && tag != "." && tag != ".." && filepath.Base(tag) == tag
+}
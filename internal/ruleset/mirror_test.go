@@ -0,0 +1,79 @@
+package ruleset
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRefreshAll(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok.srs":
+			w.Write([]byte("rules"))
+		case "/empty.srs":
+		default:
+			http.Error(w, "gone", http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	store.Store(map[string]*Entry{})
+	t.Cleanup(func() { store.Store(map[string]*Entry{}) })
+
+	cfg := MirrorConfig{Dir: t.TempDir(), Timeout: 5}
+	src := map[string]string{
+		"ok":      srv.URL + "/ok.srs",
+		"empty":   srv.URL + "/empty.srs",
+		"missing": srv.URL + "/missing.srs",
+		"../up":   srv.URL + "/ok.srs",
+	}
+	refreshAll(context.Background(), cfg, src)
+
+	e, ok := Get("ok")
+	if !ok || string(e.Content) != "rules" || e.Source != src["ok"] || e.ETag != etag([]byte("rules")) {
+		t.Fatalf("ok = %+v, %v", e, ok)
+	}
+	for _, tag := range []string{"empty", "missing"} {
+		if _, ok := Get(tag); ok {
+			t.Errorf("%s stored", tag)
+		}
+	}
+	if b, err := os.ReadFile(filepath.Join(cfg.Dir, "ok.srs")); err != nil || string(b) != "rules" {
+		t.Errorf("disk copy %q, %v", b, err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(cfg.Dir), "up.srs")); err == nil {
+		t.Error("tag escaped the mirror dir")
+	}
+
+	// a restart serves the disk copy until the next refresh
+	store.Store(map[string]*Entry{})
+	loadFromDisk(cfg.Dir, src)
+	if e2, ok := Get("ok"); !ok || e2.ETag != e.ETag {
+		t.Errorf("from disk = %+v, %v", e2, ok)
+	}
+}
+
+func TestSource(t *testing.T) {
+	sources.Store(map[string]string{"geosite-cn": "https://example.com/geosite-cn.srs"})
+	t.Cleanup(func() { sources.Store(map[string]string{}) })
+
+	// not mirrored yet: the handler redirects to the source
+	if u, ok := Source("geosite-cn"); !ok || u != "https://example.com/geosite-cn.srs" {
+		t.Errorf("Source = %q, %v", u, ok)
+	}
+	if _, ok := Source("unknown"); ok {
+		t.Error("unknown tag has a source")
+	}
+}
+
+func TestETag(t *testing.T) {
+	if etag([]byte("a")) == etag([]byte("b")) {
+		t.Error("different contents share an ETag")
+	}
+	if e := etag([]byte("a")); e != etag([]byte("a")) || e[0] != '"' || e[len(e)-1] != '"' {
+		t.Errorf("ETag %s is not a stable strong ETag", e)
+	}
+}
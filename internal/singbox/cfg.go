@@ -1,8 +1,15 @@
 package singbox
 
 import (
+	"cmp"
+	"context"
+	"encoding/json"
 	"fmt"
+	"slices"
+	"time"
 
+	"github.com/sagernet/sing-box/include"
+	sjson "github.com/sagernet/sing/common/json"
 	"github.com/spf13/viper"
 )
 
@@ -20,3 +27,305 @@ func GetSelectors() ([]SelectorItem, error) {
 	}
 	return selectors, nil
 }
+
+// SniffConfig controls the `sniff` route action emitted for the TUN inbound.
+type SniffConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Sniffers []string      `mapstructure:"sniffers"` // empty means every sniffer sing-box supports
+	Timeout  time.Duration `mapstructure:"timeout"`
+}
+
+// ResolveConfig controls the optional `resolve` route action, which resolves
+// domain destinations so IP based rules (geoip-cn, ip_is_private) can match.
+type ResolveConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	Server   string `mapstructure:"server"`
+	Strategy string `mapstructure:"strategy"` // prefer_ipv4 / prefer_ipv6 / ipv4_only / ipv6_only
+}
+
+// ProxySelectorConfig tunes the top-level "proxy" selector that holds auto-out,
+// the named groups, direct-out and optionally every node.
+type ProxySelectorConfig struct {
+	Default                   string `mapstructure:"default"`
+	IncludeNodes              bool   `mapstructure:"include_nodes"`
+	InterruptExistConnections bool   `mapstructure:"interrupt_exist_connections"`
+}
+
+type RouteConfig struct {
+	Final     string              `mapstructure:"final"` // defaults to the "proxy" selector
+	Proxy     ProxySelectorConfig `mapstructure:"proxy"`
+	Sniff     SniffConfig         `mapstructure:"sniff"`
+	HijackDNS bool                `mapstructure:"hijack_dns"`
+	Resolve   ResolveConfig       `mapstructure:"resolve"`
+}
+
+// GetRouteConfig reads the `route` key, keeping sniff, hijack-dns and node
+// entries in the proxy selector enabled when unset.
+func GetRouteConfig() (RouteConfig, error) {
+	cfg := RouteConfig{
+		Proxy:     ProxySelectorConfig{IncludeNodes: true},
+		Sniff:     SniffConfig{Enabled: true},
+		HijackDNS: true,
+	}
+	if err := viper.UnmarshalKey("route", &cfg); err != nil {
+		return cfg, fmt.Errorf("singbox.GetRouteConfig: unable to decode 'route' into struct: %v", err)
+	}
+	return cfg, nil
+}
+
+// FakeIPConfig enables the fakeip DNS server for TUN profiles.
+type FakeIPConfig struct {
+	Enabled    bool   `mapstructure:"enabled"`
+	Inet4Range string `mapstructure:"inet4_range"`
+	Inet6Range string `mapstructure:"inet6_range"`
+}
+
+type DNSConfig struct {
+	// Servers are raw sing-box DNS server objects (any type: udp, tls, https,
+	// quic, dhcp, local, fakeip, ...); the built-in DoH servers are used when empty.
+	Servers       []map[string]any `mapstructure:"servers"`
+	Final         string           `mapstructure:"final"`
+	Direct        string           `mapstructure:"direct"` // server for domestic domains and clash_mode=direct
+	Remote        string           `mapstructure:"remote"` // server for clash_mode=global
+	DirectDomains []string         `mapstructure:"direct_domains"`
+	Strategy      string           `mapstructure:"strategy"`
+	ClientSubnet  string           `mapstructure:"client_subnet"`
+	FakeIP        FakeIPConfig     `mapstructure:"fakeip"`
+}
+
+// GetDNSConfig reads the `dns` key on top of the built-in defaults. Unset
+// final / direct / remote default to the built-in servers, or to the first of
+// `dns.servers` once those are configured; set ones must name a server.
+func GetDNSConfig() (DNSConfig, error) {
+	cfg := DNSConfig{
+		DirectDomains: []string{
+			"onmicrosoft.cn",
+			"s4b4.com",
+			"github.com",
+			"raw.githubusercontent.com",
+		},
+		FakeIP: FakeIPConfig{
+			Inet4Range: "198.18.0.0/15",
+			Inet6Range: "fc00::/18",
+		},
+	}
+	if err := viper.UnmarshalKey("dns", &cfg); err != nil {
+		return cfg, fmt.Errorf("singbox.GetDNSConfig: unable to decode 'dns' into struct: %v", err)
+	}
+
+	var tags []string
+	for i, raw := range cfg.Servers {
+		tag, _ := raw["tag"].(string)
+		if tag == "" {
+			return cfg, fmt.Errorf("singbox.GetDNSConfig: dns.servers[%d] has no tag", i)
+		}
+		tags = append(tags, tag)
+	}
+	if len(tags) == 0 {
+		for _, server := range dnsServers {
+			tags = append(tags, server.Tag)
+		}
+		cfg.Final = cmp.Or(cfg.Final, "google-doh")
+		cfg.Direct = cmp.Or(cfg.Direct, "alidns")
+		cfg.Remote = cmp.Or(cfg.Remote, "google-doh")
+	}
+	for _, ref := range []struct {
+		key string
+		tag *string
+	}{{"final", &cfg.Final}, {"direct", &cfg.Direct}, {"remote", &cfg.Remote}} {
+		if *ref.tag == "" {
+			*ref.tag = tags[0]
+		} else if !slices.Contains(tags, *ref.tag) {
+			return cfg, fmt.Errorf("singbox.GetDNSConfig: dns.%s %q is not a tag of dns.servers %v", ref.key, *ref.tag, tags)
+		}
+	}
+	return cfg, nil
+}
+
+type InboundUser struct {
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+}
+
+type TunInboundConfig struct {
+	Enabled             bool     `mapstructure:"enabled"`
+	Stack               string   `mapstructure:"stack"`
+	Address             []string `mapstructure:"address"`
+	MTU                 uint32   `mapstructure:"mtu"`
+	AutoRoute           bool     `mapstructure:"auto_route"`
+	StrictRoute         bool     `mapstructure:"strict_route"`
+	RouteExcludeAddress []string `mapstructure:"route_exclude_address"`
+	IncludePackage      []string `mapstructure:"include_package"`
+	ExcludePackage      []string `mapstructure:"exclude_package"`
+	IncludeUID          []uint32 `mapstructure:"include_uid"`
+	ExcludeUID          []uint32 `mapstructure:"exclude_uid"`
+}
+
+// ListenInboundConfig describes the local socks and mixed inbounds; listening
+// on a LAN address should come with users so the port is not an open proxy.
+type ListenInboundConfig struct {
+	Enabled        bool          `mapstructure:"enabled"`
+	Listen         string        `mapstructure:"listen"`
+	Port           uint16        `mapstructure:"port"`
+	Users          []InboundUser `mapstructure:"users"`
+	SetSystemProxy bool          `mapstructure:"set_system_proxy"` // mixed only
+}
+
+type InboundConfig struct {
+	Tun   TunInboundConfig    `mapstructure:"tun"`
+	Socks ListenInboundConfig `mapstructure:"socks"`
+	Mixed ListenInboundConfig `mapstructure:"mixed"`
+	// Custom are raw sing-box inbound objects appended as-is.
+	Custom []map[string]any `mapstructure:"custom"`
+}
+
+// GetInboundConfig reads the `inbounds` key on top of the built-in defaults
+// and then applies each override document (token settings, query params) in order.
+func GetInboundConfig(overrides ...map[string]any) (InboundConfig, error) {
+	cfg := InboundConfig{
+		Tun: TunInboundConfig{
+			Enabled:     true,
+			Address:     []string{"172.19.0.1/30", "fdfe:dcba:9876::1/126"},
+			MTU:         9000,
+			AutoRoute:   true,
+			StrictRoute: true,
+		},
+		Socks: ListenInboundConfig{Enabled: true, Listen: "127.0.0.1", Port: 2333},
+		Mixed: ListenInboundConfig{Enabled: true, Listen: "127.0.0.1", Port: 2334},
+	}
+	if err := viper.UnmarshalKey("inbounds", &cfg); err != nil {
+		return cfg, fmt.Errorf("singbox.GetInboundConfig: unable to decode 'inbounds' into struct: %v", err)
+	}
+	for _, override := range overrides {
+		if len(override) == 0 {
+			continue
+		}
+		// a scratch viper keeps the same decode hooks as the main config
+		v := viper.New()
+		v.Set("inbounds", override)
+		if err := v.UnmarshalKey("inbounds", &cfg); err != nil {
+			return cfg, fmt.Errorf("singbox.GetInboundConfig: unable to apply inbound override: %v", err)
+		}
+	}
+	return cfg, nil
+}
+
+// unmarshalRaw decodes a raw config object into a sing-box option type
+// through the registries linked by the include package.
+func unmarshalRaw(raw map[string]any, out any) error {
+	content, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return sjson.UnmarshalContext(include.Context(context.Background()), content, out)
+}
+
+type ClashAPIConfig struct {
+	Enabled                  bool   `mapstructure:"enabled"`
+	ExternalController       string `mapstructure:"external_controller"`
+	ExternalUI               string `mapstructure:"external_ui"`
+	ExternalUIDownloadURL    string `mapstructure:"external_ui_download_url"`
+	ExternalUIDownloadDetour string `mapstructure:"external_ui_download_detour"`
+	// Secret is shared by every profile when set; otherwise a stable secret is
+	// derived per token from SecretKey (falling back to jwt.secret).
+	Secret      string `mapstructure:"secret"`
+	SecretKey   string `mapstructure:"secret_key"`
+	DefaultMode string `mapstructure:"default_mode"`
+}
+
+// CacheFileConfig persists selector choices, rule sets and optionally fakeip
+// and rejected DNS responses across client restarts.
+type CacheFileConfig struct {
+	Enabled     bool          `mapstructure:"enabled"`
+	Path        string        `mapstructure:"path"`
+	StoreFakeIP bool          `mapstructure:"store_fakeip"`
+	StoreRDRC   bool          `mapstructure:"store_rdrc"`
+	RDRCTimeout time.Duration `mapstructure:"rdrc_timeout"`
+}
+
+type ExperimentalConfig struct {
+	ClashAPI  ClashAPIConfig  `mapstructure:"clash_api"`
+	CacheFile CacheFileConfig `mapstructure:"cache_file"`
+}
+
+// GetExperimentalConfig reads the `experimental` key on top of the built-in defaults.
+func GetExperimentalConfig() (ExperimentalConfig, error) {
+	cfg := ExperimentalConfig{
+		ClashAPI: ClashAPIConfig{
+			Enabled:                  true,
+			ExternalController:       "127.0.0.1:9090",
+			ExternalUI:               "ui",
+			ExternalUIDownloadURL:    "https://github.com/MetaCubeX/metacubexd/archive/refs/heads/gh-pages.zip",
+			ExternalUIDownloadDetour: proxyOutboundTag,
+			DefaultMode:              "rule",
+		},
+		CacheFile: CacheFileConfig{
+			Enabled:   true,
+			StoreRDRC: true,
+		},
+	}
+	if err := viper.UnmarshalKey("experimental", &cfg); err != nil {
+		return cfg, fmt.Errorf("singbox.GetExperimentalConfig: unable to decode 'experimental' into struct: %v", err)
+	}
+	return cfg, nil
+}
+
+// CheckConfig controls validating generated profiles with sing-box before serving them.
+type CheckConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// DropInvalid removes a node sing-box rejects and renders the profile again.
+	DropInvalid bool `mapstructure:"drop_invalid"`
+}
+
+// GetCheckConfig reads the `check` key on top of the built-in defaults.
+func GetCheckConfig() (CheckConfig, error) {
+	cfg := CheckConfig{Enabled: true}
+	if err := viper.UnmarshalKey("check", &cfg); err != nil {
+		return cfg, fmt.Errorf("singbox.GetCheckConfig: unable to decode 'check' into struct: %v", err)
+	}
+	return cfg, nil
+}
+
+// RegionConfig controls the automatic per-region urltest groups.
+type RegionConfig struct {
+	Enabled  bool     `mapstructure:"enabled"`
+	MinNodes int      `mapstructure:"min_nodes"`
+	Suffix   string   `mapstructure:"suffix"`   // group tag is the region code plus suffix, e.g. "HK-auto"
+	Selector string   `mapstructure:"selector"` // tag of the selector over the region groups
+	Include  []string `mapstructure:"include"`  // limit to these region codes; empty = all detected
+	// GeoIPFile is a CSV of "start,end,country" ranges used for nodes whose
+	// name has no region hint and whose server is an IP literal.
+	GeoIPFile string `mapstructure:"geoip_file"`
+}
+
+// GetRegionConfig reads the `regions` key on top of the built-in defaults.
+func GetRegionConfig() (RegionConfig, error) {
+	cfg := RegionConfig{
+		MinNodes: 1,
+		Suffix:   "-auto",
+		Selector: "region",
+	}
+	if err := viper.UnmarshalKey("regions", &cfg); err != nil {
+		return cfg, fmt.Errorf("singbox.GetRegionConfig: unable to decode 'regions' into struct: %v", err)
+	}
+	if cfg.MinNodes < 1 {
+		cfg.MinNodes = 1
+	}
+	return cfg, nil
+}
+
+// InfoNodesConfig controls the informational entries showing each provider's
+// remaining traffic and expiry.
+type InfoNodesConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Group   string `mapstructure:"group"` // tag of the selector holding the entries
+}
+
+// GetInfoNodesConfig reads the `info_nodes` key on top of the built-in defaults.
+func GetInfoNodesConfig() (InfoNodesConfig, error) {
+	cfg := InfoNodesConfig{Group: "📊 subscription"}
+	if err := viper.UnmarshalKey("info_nodes", &cfg); err != nil {
+		return cfg, fmt.Errorf("singbox.GetInfoNodesConfig: unable to decode 'info_nodes' into struct: %v", err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,177 @@
+package singbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	box "github.com/sagernet/sing-box"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/include"
+	"github.com/sagernet/sing-box/option"
+	sjson "github.com/sagernet/sing/common/json"
+)
+
+// ProfileError pinpoints the part of a generated profile that failed validation.
+type ProfileError struct {
+	Section string `json:"section"` // outbound, inbound, endpoint, rule, rule-set, dns server, dns rule, route, dns
+	Index   int    `json:"index"`
+	Tag     string `json:"tag,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *ProfileError) Error() string {
+	if e.Tag != "" {
+		return fmt.Sprintf("%s[%d] %q: %s", e.Section, e.Index, e.Tag, e.Message)
+	}
+	return fmt.Sprintf("%s[%d]: %s", e.Section, e.Index, e.Message)
+}
+
+// boxErrorPattern matches the "initialize outbound[3]: ..." prefixes of box.New errors.
+var boxErrorPattern = regexp.MustCompile(`(?i)(?:initialize|parse) (outbound|inbound|endpoint|rule-set|rule|dns server|dns rule|service)\[(\d+)\]: (.*)`)
+
+// CheckProfile validates a profile the way `sing-box check` does: references
+// between tags are resolved first, then the profile is built into a sing-box
+// instance and closed without starting. Features missing from this binary's
+// build (QUIC, clash API, ...) are skipped, the client may well have them.
+func CheckProfile(ctx context.Context, opts option.Options) (err error) {
+	ctx = include.Context(ctx)
+	// check what the client will read: the marshalled profile, decoded again
+	b, err := sjson.MarshalContext(ctx, opts)
+	if err != nil {
+		return &ProfileError{Section: "profile", Index: -1, Message: err.Error()}
+	}
+	opts = option.Options{}
+	if err := sjson.UnmarshalContext(ctx, b, &opts); err != nil {
+		return &ProfileError{Section: "profile", Index: -1, Message: err.Error()}
+	}
+	if err := checkReferences(opts); err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = &ProfileError{Section: "profile", Index: -1, Message: fmt.Sprint(r)}
+		}
+	}()
+
+	// experimental options only matter on the client and need build tags we may lack
+	opts.Experimental = nil
+	outbounds := slices.Clone(opts.Outbounds)
+	// positions of the checked outbounds in the served profile
+	positions := make([]int, len(outbounds))
+	for i := range positions {
+		positions[i] = i
+	}
+	for {
+		opts.Outbounds = outbounds
+		instance, err := box.New(box.Options{Context: ctx, Options: opts})
+		if err == nil {
+			return instance.Close()
+		}
+		pe := parseBoxError(err)
+		if !strings.Contains(err.Error(), "not included in this build") {
+			if pe != nil && pe.Section == "outbound" && pe.Index < len(outbounds) {
+				pe.Tag = outbounds[pe.Index].Tag
+				pe.Index = positions[pe.Index]
+			}
+			if pe == nil {
+				return &ProfileError{Section: "profile", Index: -1, Message: err.Error()}
+			}
+			return pe
+		}
+		// keep checking the rest without the outbound this build cannot create
+		if pe == nil || pe.Section != "outbound" || pe.Index >= len(outbounds) {
+			log.Printf("singbox: check stopped early: %v", err)
+			return nil
+		}
+		outbounds = slices.Delete(slices.Clone(outbounds), pe.Index, pe.Index+1)
+		positions = slices.Delete(positions, pe.Index, pe.Index+1)
+	}
+}
+
+func parseBoxError(err error) *ProfileError {
+	m := boxErrorPattern.FindStringSubmatch(err.Error())
+	if m == nil {
+		return nil
+	}
+	index, _ := strconv.Atoi(m[2])
+	return &ProfileError{Section: strings.ToLower(m[1]), Index: index, Message: m[3]}
+}
+
+// checkReferences catches what box.New leaves to Start: duplicate tags and
+// group members, rule targets and rule sets naming nothing.
+func checkReferences(opts option.Options) error {
+	tags := make(map[string]bool, len(opts.Outbounds))
+	for i, ot := range opts.Outbounds {
+		if tags[ot.Tag] {
+			return &ProfileError{Section: "outbound", Index: i, Tag: ot.Tag, Message: "duplicate tag"}
+		}
+		tags[ot.Tag] = true
+	}
+	for _, ep := range opts.Endpoints {
+		tags[ep.Tag] = true
+	}
+	for i, ot := range opts.Outbounds {
+		var members []string
+		switch o := ot.Options.(type) {
+		case *option.SelectorOutboundOptions:
+			members = o.Outbounds
+		case *option.URLTestOutboundOptions:
+			members = o.Outbounds
+		}
+		for _, m := range members {
+			if !tags[m] {
+				return &ProfileError{Section: "outbound", Index: i, Tag: ot.Tag, Message: fmt.Sprintf("member %q not found", m)}
+			}
+		}
+	}
+
+	if opts.Route != nil {
+		sets := make(map[string]bool, len(opts.Route.RuleSet))
+		for i, rs := range opts.Route.RuleSet {
+			if sets[rs.Tag] {
+				return &ProfileError{Section: "rule-set", Index: i, Tag: rs.Tag, Message: "duplicate tag"}
+			}
+			sets[rs.Tag] = true
+		}
+		for i, r := range opts.Route.Rules {
+			if msg := checkRule(r, tags, sets); msg != "" {
+				return &ProfileError{Section: "rule", Index: i, Message: msg}
+			}
+		}
+		if opts.Route.Final != "" && !tags[opts.Route.Final] {
+			return &ProfileError{Section: "route", Index: -1, Message: fmt.Sprintf("final outbound %q not found", opts.Route.Final)}
+		}
+	}
+	return nil
+}
+
+func checkRule(r option.Rule, outbounds, sets map[string]bool) string {
+	if r.Type == C.RuleTypeLogical {
+		for _, sub := range r.LogicalOptions.Rules {
+			if msg := checkRule(sub, outbounds, sets); msg != "" {
+				return msg
+			}
+		}
+		return checkRuleAction(r.LogicalOptions.RuleAction, outbounds)
+	}
+	for _, tag := range r.DefaultOptions.RuleSet {
+		if !sets[tag] {
+			return fmt.Sprintf("rule set %q not found", tag)
+		}
+	}
+	return checkRuleAction(r.DefaultOptions.RuleAction, outbounds)
+}
+
+func checkRuleAction(action option.RuleAction, outbounds map[string]bool) string {
+	if action.Action == C.RuleActionTypeRoute || action.Action == "" {
+		if tag := action.RouteOptions.Outbound; tag != "" && !outbounds[tag] {
+			return fmt.Sprintf("outbound %q not found", tag)
+		}
+	}
+	return ""
+}
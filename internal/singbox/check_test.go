@@ -0,0 +1,77 @@
+package singbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+)
+
+func TestCheckProfile(t *testing.T) {
+	direct := option.Outbound{Type: C.TypeDirect, Tag: directOutboundTag, Options: &option.DirectOutboundOptions{}}
+	node := func(tag, method string) option.Outbound {
+		return option.Outbound{Type: C.TypeShadowsocks, Tag: tag, Options: &option.ShadowsocksOutboundOptions{
+			ServerOptions: option.ServerOptions{Server: "192.0.2.1", ServerPort: 8388},
+			Method:        method,
+			Password:      "secret",
+		}}
+	}
+	selector := func(members ...string) option.Outbound {
+		return option.Outbound{Type: C.TypeSelector, Tag: proxyOutboundTag, Options: &option.SelectorOutboundOptions{Outbounds: members}}
+	}
+	route := func(rules ...option.Rule) *option.RouteOptions {
+		return &option.RouteOptions{Rules: rules, Final: proxyOutboundTag}
+	}
+	routeTo := func(outbound string, sets ...string) option.Rule {
+		return option.Rule{Type: C.RuleTypeDefault, DefaultOptions: option.DefaultRule{
+			RawDefaultRule: option.RawDefaultRule{RuleSet: sets, Domain: []string{"example.com"}},
+			RuleAction:     option.RuleAction{Action: C.RuleActionTypeRoute, RouteOptions: option.RouteActionOptions{Outbound: outbound}},
+		}}
+	}
+
+	tests := []struct {
+		name    string
+		opts    option.Options
+		section string
+		tag     string
+	}{
+		{"valid", option.Options{Outbounds: []option.Outbound{direct, node("a", "aes-128-gcm"), selector("a", directOutboundTag)}, Route: route(routeTo("a"))}, "", ""},
+		{"invalid node", option.Options{Outbounds: []option.Outbound{direct, node("a", "aes-128-gcm"), node("bad", "no-such-method"), selector("a", "bad")}}, "outbound", "bad"},
+		// sing-box refuses duplicate tags while decoding, before the references are checked
+		{"duplicate tag", option.Options{Outbounds: []option.Outbound{direct, node("a", "aes-128-gcm"), node("a", "aes-128-gcm")}}, "profile", ""},
+		{"missing member", option.Options{Outbounds: []option.Outbound{direct, selector("gone")}}, "outbound", proxyOutboundTag},
+		{"missing rule outbound", option.Options{Outbounds: []option.Outbound{direct, selector(directOutboundTag)}, Route: route(routeTo("gone"))}, "rule", ""},
+		{"missing rule set", option.Options{Outbounds: []option.Outbound{direct, selector(directOutboundTag)}, Route: route(routeTo(directOutboundTag, "geosite-gone"))}, "rule", ""},
+		{"missing final", option.Options{Outbounds: []option.Outbound{direct}, Route: route()}, "route", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckProfile(context.Background(), tt.opts)
+			if tt.section == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var pe *ProfileError
+			if !errors.As(err, &pe) {
+				t.Fatalf("error %v is not a ProfileError", err)
+			}
+			if pe.Section != tt.section || pe.Tag != tt.tag {
+				t.Errorf("error %v, want section %s tag %q", pe, tt.section, tt.tag)
+			}
+		})
+	}
+}
+
+func TestParseBoxError(t *testing.T) {
+	pe := parseBoxError(errors.New("initialize outbound[3]: unknown method: x"))
+	if pe == nil || pe.Section != "outbound" || pe.Index != 3 || pe.Message != "unknown method: x" {
+		t.Errorf("parsed %+v", pe)
+	}
+	if pe := parseBoxError(errors.New("something else")); pe != nil {
+		t.Errorf("parsed %+v", pe)
+	}
+}
@@ -0,0 +1,271 @@
+package singbox
+
+import (
+	"fmt"
+	"maps"
+	"net/netip"
+	"slices"
+	"strconv"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common/json/badoption"
+)
+
+const fakeIPServerTag = "fakeip"
+
+// dnsServers are used when `dns.servers` is not configured. alidns dials
+// directly without a detour: sing-box rejects detours to an empty direct outbound.
+var dnsServers = []option.DNSServerOptions{
+	{
+		Type: C.DNSTypeHTTPS,
+		Tag:  "google-doh",
+		Options: option.RemoteHTTPSDNSServerOptions{
+			RemoteTLSDNSServerOptions: option.RemoteTLSDNSServerOptions{
+				RemoteDNSServerOptions: option.RemoteDNSServerOptions{
+					DNSServerAddressOptions: option.DNSServerAddressOptions{
+						Server:     "8.8.8.8",
+						ServerPort: 443,
+					},
+					LocalDNSServerOptions: option.LocalDNSServerOptions{
+						DialerOptions: option.DialerOptions{
+							Detour: proxyOutboundTag,
+						},
+					},
+				},
+
+				OutboundTLSOptionsContainer: option.OutboundTLSOptionsContainer{
+					TLS: &option.OutboundTLSOptions{
+						ServerName: "dns.google",
+					},
+				},
+			},
+			Path: "/dns-query",
+		},
+	},
+	{
+		Type: C.DNSTypeHTTPS,
+		Tag:  "alidns",
+		Options: option.RemoteHTTPSDNSServerOptions{
+			RemoteTLSDNSServerOptions: option.RemoteTLSDNSServerOptions{
+				RemoteDNSServerOptions: option.RemoteDNSServerOptions{
+					DNSServerAddressOptions: option.DNSServerAddressOptions{
+						Server:     "223.5.5.5",
+						ServerPort: 443,
+					},
+				},
+				OutboundTLSOptionsContainer: option.OutboundTLSOptionsContainer{
+					TLS: &option.OutboundTLSOptions{
+						ServerName: "dns.alidns.com",
+					},
+				},
+			},
+			Path: "/dns-query",
+		},
+	},
+	{
+		Type: C.DNSTypeHTTPS,
+		Tag:  "cloudflare-doh",
+		Options: option.RemoteHTTPSDNSServerOptions{
+			RemoteTLSDNSServerOptions: option.RemoteTLSDNSServerOptions{
+				RemoteDNSServerOptions: option.RemoteDNSServerOptions{
+					DNSServerAddressOptions: option.DNSServerAddressOptions{
+						Server:     "1.1.1.1",
+						ServerPort: 443,
+					},
+					LocalDNSServerOptions: option.LocalDNSServerOptions{
+						DialerOptions: option.DialerOptions{
+							Detour: proxyOutboundTag,
+						},
+					},
+				},
+				OutboundTLSOptionsContainer: option.OutboundTLSOptionsContainer{
+					TLS: &option.OutboundTLSOptions{
+						ServerName: "cloudflare-dns.com",
+					},
+				},
+			},
+			Path: "/dns-query",
+		},
+	},
+}
+
+// dnsRules builds the DNS rules: adblock is rejected, direct domains, the
+// direct clash mode and geosite-cn use the direct server, the global clash
+// mode uses the remote server and everything else falls through to Final.
+func dnsRules(cfg DNSConfig) []option.DNSRule {
+	route := func(raw option.RawDefaultDNSRule, server string) option.DNSRule {
+		return option.DNSRule{
+			Type: C.RuleTypeDefault,
+			DefaultOptions: option.DefaultDNSRule{
+				RawDefaultDNSRule: raw,
+				DNSRuleAction: option.DNSRuleAction{
+					Action: C.RuleActionTypeRoute,
+					RouteOptions: option.DNSRouteActionOptions{
+						Server: server,
+					},
+				},
+			},
+		}
+	}
+
+	cDNSRules := []option.DNSRule{
+		// 1) adblock 优先且直接拒绝
+		{
+			Type: C.RuleTypeDefault,
+			DefaultOptions: option.DefaultDNSRule{
+				RawDefaultDNSRule: option.RawDefaultDNSRule{
+					RuleSet: []string{"adblock"},
+				},
+				DNSRuleAction: option.DNSRuleAction{
+					Action:        C.RuleActionTypeReject,
+					RejectOptions: option.RejectActionOptions{},
+				},
+			},
+		},
+	}
+	// 保留按域名走直连 DNS 的特例
+	if len(cfg.DirectDomains) > 0 {
+		cDNSRules = append(cDNSRules, route(option.RawDefaultDNSRule{DomainSuffix: cfg.DirectDomains}, cfg.Direct))
+	}
+	cDNSRules = append(cDNSRules,
+		// clash_mode=direct 时全部使用直连 DNS 解析
+		route(option.RawDefaultDNSRule{ClashMode: clashModeDirect}, cfg.Direct),
+		// clash_mode=global 时全部经代理解析
+		route(option.RawDefaultDNSRule{ClashMode: clashModeGlobal}, cfg.Remote),
+		// 国内域名使用直连 DNS 解析，其余落到 Final
+		route(option.RawDefaultDNSRule{RuleSet: []string{"geosite-cn"}}, cfg.Direct),
+	)
+	return cDNSRules
+}
+
+// fakeIPDNSRule answers A/AAAA queries from the TUN inbound with fake addresses;
+// it must come after the direct rules so domestic domains keep real addresses.
+func fakeIPDNSRule() option.DNSRule {
+	return option.DNSRule{
+		Type: C.RuleTypeDefault,
+		DefaultOptions: option.DefaultDNSRule{
+			RawDefaultDNSRule: option.RawDefaultDNSRule{
+				Inbound:   []string{tunInboundTag},
+				QueryType: []option.DNSQueryType{1, 28}, // A, AAAA
+			},
+			DNSRuleAction: option.DNSRuleAction{
+				Action: C.RuleActionTypeRoute,
+				RouteOptions: option.DNSRouteActionOptions{
+					Server: fakeIPServerTag,
+				},
+			},
+		},
+	}
+}
+
+// dnsServerOptions returns the configured DNS servers decoded through the
+// sing-box transport registry, or the built-in servers when none are set.
+func dnsServerOptions(cfg DNSConfig) ([]option.DNSServerOptions, error) {
+	if len(cfg.Servers) == 0 {
+		return slices.Clone(dnsServers), nil
+	}
+
+	servers := make([]option.DNSServerOptions, 0, len(cfg.Servers))
+	for i, raw := range cfg.Servers {
+		// sing-box rejects a detour to an empty direct outbound, dialing directly is equivalent
+		if raw["detour"] == directOutboundTag {
+			raw = maps.Clone(raw)
+			delete(raw, "detour")
+		}
+		var server option.DNSServerOptions
+		if err := unmarshalRaw(raw, &server); err != nil {
+			return nil, fmt.Errorf("dns.servers[%d]: %w", i, err)
+		}
+		servers = append(servers, server)
+	}
+	return servers, nil
+}
+
+// fakeIPServer builds the fakeip DNS server from the configured ranges.
+func fakeIPServer(cfg FakeIPConfig) (option.DNSServerOptions, error) {
+	opts := &option.FakeIPDNSServerOptions{}
+	if cfg.Inet4Range != "" {
+		prefix, err := netip.ParsePrefix(cfg.Inet4Range)
+		if err != nil {
+			return option.DNSServerOptions{}, fmt.Errorf("dns.fakeip.inet4_range: %w", err)
+		}
+		opts.Inet4Range = (*badoption.Prefix)(&prefix)
+	}
+	if cfg.Inet6Range != "" {
+		prefix, err := netip.ParsePrefix(cfg.Inet6Range)
+		if err != nil {
+			return option.DNSServerOptions{}, fmt.Errorf("dns.fakeip.inet6_range: %w", err)
+		}
+		opts.Inet6Range = (*badoption.Prefix)(&prefix)
+	}
+	return option.DNSServerOptions{
+		Type:    C.DNSTypeFakeIP,
+		Tag:     fakeIPServerTag,
+		Options: opts,
+	}, nil
+}
+
+// buildDNSOptions assembles the DNS section; extraRules are inserted before
+// the fakeip rule so service specific servers still return real addresses.
+func buildDNSOptions(cfg DNSConfig, extraRules []option.DNSRule, tun bool) (*option.DNSOptions, error) {
+	servers, err := dnsServerOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	cDNSRules := dnsRules(cfg)
+	for _, rule := range extraRules {
+		// service rules may name a server the deployment did not configure
+		if server := rule.DefaultOptions.RouteOptions.Server; server != "" && !hasDNSServer(servers, server) {
+			continue
+		}
+		cDNSRules = append(cDNSRules, rule)
+	}
+	if cfg.FakeIP.Enabled && tun {
+		// a configured server tagged fakeip takes the place of the built-in one
+		if !hasDNSServer(servers, fakeIPServerTag) {
+			server, err := fakeIPServer(cfg.FakeIP)
+			if err != nil {
+				return nil, err
+			}
+			servers = append(servers, server)
+		}
+		cDNSRules = append(cDNSRules, fakeIPDNSRule())
+	}
+
+	strategy, err := parseDomainStrategy(cfg.Strategy)
+	if err != nil {
+		return nil, fmt.Errorf("dns.strategy: %w", err)
+	}
+
+	var clientSubnet *badoption.Prefixable
+	if cfg.ClientSubnet != "" {
+		clientSubnet = new(badoption.Prefixable)
+		if err := clientSubnet.UnmarshalJSON([]byte(strconv.Quote(cfg.ClientSubnet))); err != nil {
+			return nil, fmt.Errorf("dns.client_subnet: %w", err)
+		}
+	}
+
+	return &option.DNSOptions{
+		RawDNSOptions: option.RawDNSOptions{
+			Servers: servers,
+			Rules:   cDNSRules,
+			Final:   cfg.Final,
+			DNSClientOptions: option.DNSClientOptions{
+				Strategy:     strategy,
+				ClientSubnet: clientSubnet,
+			},
+		},
+	}, nil
+}
+
+// hasDNSServer reports whether a server with the given tag is present.
+func hasDNSServer(servers []option.DNSServerOptions, tag string) bool {
+	for _, server := range servers {
+		if server.Tag == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package singbox
+
+import (
+	"strings"
+	"testing"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/spf13/viper"
+)
+
+func TestGetDNSConfigTags(t *testing.T) {
+	servers := []map[string]any{
+		{"type": "udp", "tag": "lan", "server": "192.168.1.1"},
+		{"type": "tls", "tag": "quad9", "server": "9.9.9.9"},
+	}
+	tests := []struct {
+		name                  string
+		dns                   map[string]any
+		final, direct, remote string
+		err                   string
+	}{
+		{"built-in", nil, "google-doh", "alidns", "google-doh", ""},
+		{"built-in override", map[string]any{"direct": "google-doh"}, "google-doh", "google-doh", "google-doh", ""},
+		{"built-in unknown", map[string]any{"final": "lan"}, "", "", "", `dns.final "lan"`},
+		{"servers default", map[string]any{"servers": servers}, "lan", "lan", "lan", ""},
+		{"servers named", map[string]any{"servers": servers, "final": "quad9", "remote": "quad9"}, "quad9", "lan", "quad9", ""},
+		{"servers stale default", map[string]any{"servers": servers, "remote": "google-doh"}, "", "", "", `dns.remote "google-doh"`},
+		{"server without tag", map[string]any{"servers": []map[string]any{{"type": "local"}}}, "", "", "", "dns.servers[0] has no tag"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("dns", tt.dns)
+			t.Cleanup(func() { viper.Set("dns", nil) })
+			cfg, err := GetDNSConfig()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Final != tt.final || cfg.Direct != tt.direct || cfg.Remote != tt.remote {
+				t.Errorf("final/direct/remote = %s/%s/%s, want %s/%s/%s", cfg.Final, cfg.Direct, cfg.Remote, tt.final, tt.direct, tt.remote)
+			}
+		})
+	}
+}
+
+func TestBuildDNSOptionsFakeIP(t *testing.T) {
+	viper.Set("dns", map[string]any{"fakeip": map[string]any{"enabled": true, "inet4_range": "198.18.0.0/15"}})
+	t.Cleanup(func() { viper.Set("dns", nil) })
+	cfg, err := GetDNSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fakeIPServers := func(tun bool) []string {
+		t.Helper()
+		opts, err := buildDNSOptions(cfg, nil, tun)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var types []string
+		for _, server := range opts.Servers {
+			if server.Tag == fakeIPServerTag {
+				types = append(types, server.Type)
+			}
+		}
+		return types
+	}
+	if got := fakeIPServers(false); len(got) != 0 {
+		t.Errorf("without tun: fakeip servers %v", got)
+	}
+	if got := fakeIPServers(true); len(got) != 1 || got[0] != C.DNSTypeFakeIP {
+		t.Errorf("with tun: fakeip servers %v", got)
+	}
+
+	// a configured server already tagged fakeip is kept, not duplicated
+	viper.Set("dns", map[string]any{
+		"servers": []map[string]any{{"type": "fakeip", "tag": "fakeip", "inet4_range": "100.64.0.0/10"}, {"type": "local", "tag": "local"}},
+		"final":   "local",
+		"fakeip":  map[string]any{"enabled": true},
+	})
+	if cfg, err = GetDNSConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fakeIPServers(true); len(got) != 1 {
+		t.Errorf("configured fakeip: servers %v", got)
+	}
+}
@@ -0,0 +1,61 @@
+package singbox
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common/json/badoption"
+	"github.com/spf13/viper"
+)
+
+// buildExperimental assembles the clash API and cache file settings; fakeIP
+// forces store_fakeip so fake addresses survive a client restart.
+func buildExperimental(cfg ExperimentalConfig, token string, fakeIP bool) *option.ExperimentalOptions {
+	var exp option.ExperimentalOptions
+
+	if cfg.ClashAPI.Enabled {
+		exp.ClashAPI = &option.ClashAPIOptions{
+			ExternalController:       cfg.ClashAPI.ExternalController,
+			ExternalUI:               cfg.ClashAPI.ExternalUI,
+			ExternalUIDownloadURL:    cfg.ClashAPI.ExternalUIDownloadURL,
+			ExternalUIDownloadDetour: cfg.ClashAPI.ExternalUIDownloadDetour,
+			Secret:                   clashAPISecret(cfg.ClashAPI, token),
+			DefaultMode:              cfg.ClashAPI.DefaultMode,
+		}
+	}
+
+	if cfg.CacheFile.Enabled {
+		exp.CacheFile = &option.CacheFileOptions{
+			Enabled:     true,
+			Path:        cfg.CacheFile.Path,
+			StoreFakeIP: cfg.CacheFile.StoreFakeIP || fakeIP,
+			StoreRDRC:   cfg.CacheFile.StoreRDRC,
+			RDRCTimeout: badoption.Duration(cfg.CacheFile.RDRCTimeout),
+		}
+	}
+
+	if exp.ClashAPI == nil && exp.CacheFile == nil {
+		return nil
+	}
+	return &exp
+}
+
+// clashAPISecret returns the fixed secret, or derives a stable one from the
+// token so each holder gets their own dashboard secret across refreshes.
+func clashAPISecret(cfg ClashAPIConfig, token string) string {
+	if cfg.Secret != "" || token == "" {
+		return cfg.Secret
+	}
+	key := cfg.SecretKey
+	if key == "" {
+		key = viper.GetString("jwt.secret")
+	}
+	if key == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
@@ -0,0 +1,60 @@
+package singbox
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestClashAPISecret(t *testing.T) {
+	viper.Set("jwt.secret", "jwt-key")
+	t.Cleanup(func() { viper.Set("jwt.secret", nil) })
+
+	fixed := clashAPISecret(ClashAPIConfig{Secret: "shared"}, "t1")
+	if fixed != "shared" {
+		t.Errorf("fixed secret = %q", fixed)
+	}
+
+	t1 := clashAPISecret(ClashAPIConfig{SecretKey: "key"}, "t1")
+	if len(t1) != 32 {
+		t.Fatalf("derived secret %q is not 32 hex characters", t1)
+	}
+	if again := clashAPISecret(ClashAPIConfig{SecretKey: "key"}, "t1"); again != t1 {
+		t.Error("derived secret is not stable")
+	}
+	if t2 := clashAPISecret(ClashAPIConfig{SecretKey: "key"}, "t2"); t2 == t1 {
+		t.Error("tokens share a derived secret")
+	}
+	if other := clashAPISecret(ClashAPIConfig{SecretKey: "other"}, "t1"); other == t1 {
+		t.Error("secret_key does not change the derived secret")
+	}
+	if jwt := clashAPISecret(ClashAPIConfig{}, "t1"); jwt == "" || jwt == t1 {
+		t.Errorf("secret derived from jwt.secret = %q", jwt)
+	}
+
+	if anon := clashAPISecret(ClashAPIConfig{SecretKey: "key"}, ""); anon != "" {
+		t.Errorf("anonymous profile got secret %q", anon)
+	}
+	viper.Set("jwt.secret", "")
+	if none := clashAPISecret(ClashAPIConfig{}, "t1"); none != "" {
+		t.Errorf("secret without any key = %q", none)
+	}
+}
+
+func TestBuildExperimental(t *testing.T) {
+	if exp := buildExperimental(ExperimentalConfig{}, "t1", false); exp != nil {
+		t.Errorf("nothing enabled: %+v", exp)
+	}
+
+	cfg := ExperimentalConfig{
+		ClashAPI:  ClashAPIConfig{Enabled: true, SecretKey: "key"},
+		CacheFile: CacheFileConfig{Enabled: true},
+	}
+	exp := buildExperimental(cfg, "t1", true)
+	if exp.ClashAPI == nil || exp.ClashAPI.Secret != clashAPISecret(cfg.ClashAPI, "t1") {
+		t.Errorf("clash api %+v", exp.ClashAPI)
+	}
+	if exp.CacheFile == nil || !exp.CacheFile.StoreFakeIP {
+		t.Errorf("fakeip does not force store_fakeip: %+v", exp.CacheFile)
+	}
+}
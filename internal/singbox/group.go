@@ -0,0 +1,122 @@
+package singbox
+
+import (
+	"log"
+	"time"
+
+	"github.com/dingdayu/go-project-template/internal/upstream"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common/json/badoption"
+)
+
+// upstreamGroupOutbounds turns imported upstream proxy groups into selector /
+// urltest outbounds. existing holds the tags already generated (nodes, our own
+// groups); a group reusing one of them is skipped. Members that name no
+// outbound are dropped, as are references closing a cycle between groups and
+// groups left without members.
+func upstreamGroupOutbounds(groups []upstream.ProxyGroup, existing map[string]bool) []option.Outbound {
+	byTag := make(map[string]*upstream.ProxyGroup, len(groups))
+	var order []string
+	for i := range groups {
+		g := groups[i]
+		if existing[g.Tag] || byTag[g.Tag] != nil {
+			log.Printf("singbox: upstream group %q skipped, tag already in use", g.Tag)
+			continue
+		}
+		// copy members: the groups are shared by every request
+		g.Outbounds = append([]string(nil), g.Outbounds...)
+		byTag[g.Tag] = &g
+		order = append(order, g.Tag)
+	}
+
+	// break cycles: drop a member edge pointing back at a group still being visited
+	state := make(map[string]int, len(byTag)) // 0 unvisited, 1 visiting, 2 done
+	var visit func(tag string)
+	visit = func(tag string) {
+		state[tag] = 1
+		g := byTag[tag]
+		kept := g.Outbounds[:0]
+		for _, m := range g.Outbounds {
+			if byTag[m] != nil {
+				if state[m] == 1 {
+					continue
+				}
+				if state[m] == 0 {
+					visit(m)
+				}
+			}
+			kept = append(kept, m)
+		}
+		g.Outbounds = kept
+		state[tag] = 2
+	}
+	for _, tag := range order {
+		if state[tag] == 0 {
+			visit(tag)
+		}
+	}
+
+	// prune unknown members and empty groups until stable
+	for changed := true; changed; {
+		changed = false
+		for _, tag := range order {
+			g := byTag[tag]
+			if g == nil {
+				continue
+			}
+			kept := g.Outbounds[:0]
+			for _, m := range g.Outbounds {
+				if existing[m] || m == directOutboundTag || byTag[m] != nil {
+					kept = append(kept, m)
+				}
+			}
+			g.Outbounds = kept
+			if len(kept) == 0 {
+				delete(byTag, tag)
+				changed = true
+			}
+		}
+	}
+
+	var out []option.Outbound
+	for _, tag := range order {
+		g := byTag[tag]
+		if g == nil {
+			continue
+		}
+		if g.Type == C.TypeURLTest {
+			url := g.URL
+			if url == "" {
+				url = "https://www.google.com/generate_204"
+			}
+			interval := g.Interval
+			if interval <= 0 {
+				interval = 300 * time.Second
+			}
+			tolerance := g.Tolerance
+			if tolerance == 0 {
+				tolerance = 50
+			}
+			out = append(out, option.Outbound{
+				Tag:  g.Tag,
+				Type: C.TypeURLTest,
+				Options: option.URLTestOutboundOptions{
+					URL:       url,
+					Interval:  badoption.Duration(interval),
+					Tolerance: tolerance,
+					Outbounds: g.Outbounds,
+				},
+			})
+			continue
+		}
+		out = append(out, option.Outbound{
+			Tag:  g.Tag,
+			Type: C.TypeSelector,
+			Options: option.SelectorOutboundOptions{
+				Outbounds: g.Outbounds,
+			},
+		})
+	}
+	return out
+}
@@ -0,0 +1,194 @@
+package singbox
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common/auth"
+	"github.com/sagernet/sing/common/json/badoption"
+)
+
+// Inbound tags referenced by route and DNS rules.
+const (
+	tunInboundTag   = "tun-in"
+	socksInboundTag = "socks-in"
+	mixedInboundTag = "mixed-in"
+)
+
+// buildInbounds converts the inbound config into sing-box inbounds.
+func buildInbounds(cfg InboundConfig) ([]option.Inbound, error) {
+	var ibs []option.Inbound
+
+	if cfg.Tun.Enabled {
+		address, err := parsePrefixes(cfg.Tun.Address)
+		if err != nil {
+			return nil, fmt.Errorf("inbounds.tun.address: %w", err)
+		}
+		excludeAddress, err := parsePrefixes(cfg.Tun.RouteExcludeAddress)
+		if err != nil {
+			return nil, fmt.Errorf("inbounds.tun.route_exclude_address: %w", err)
+		}
+		ibs = append(ibs, option.Inbound{
+			Type: C.TypeTun,
+			Tag:  tunInboundTag,
+			Options: option.TunInboundOptions{
+				Stack:               cfg.Tun.Stack,
+				AutoRoute:           cfg.Tun.AutoRoute,
+				Address:             address,
+				MTU:                 cfg.Tun.MTU,
+				StrictRoute:         cfg.Tun.StrictRoute, // 强制严格路由规则，可能导致部分流量无法访问，建议开启后测试可用性
+				RouteExcludeAddress: excludeAddress,
+				IncludePackage:      cfg.Tun.IncludePackage,
+				ExcludePackage:      cfg.Tun.ExcludePackage,
+				IncludeUID:          cfg.Tun.IncludeUID,
+				ExcludeUID:          cfg.Tun.ExcludeUID,
+			},
+		})
+	}
+
+	if cfg.Socks.Enabled {
+		listen, err := listenOptions(cfg.Socks)
+		if err != nil {
+			return nil, fmt.Errorf("inbounds.socks: %w", err)
+		}
+		ibs = append(ibs, option.Inbound{
+			Type: C.TypeSOCKS,
+			Tag:  socksInboundTag,
+			Options: option.SocksInboundOptions{
+				ListenOptions: listen,
+				Users:         inboundUsers(cfg.Socks.Users),
+			},
+		})
+	}
+
+	if cfg.Mixed.Enabled {
+		listen, err := listenOptions(cfg.Mixed)
+		if err != nil {
+			return nil, fmt.Errorf("inbounds.mixed: %w", err)
+		}
+		ibs = append(ibs, option.Inbound{
+			Type: C.TypeMixed,
+			Tag:  mixedInboundTag,
+			Options: option.HTTPMixedInboundOptions{
+				ListenOptions:  listen,
+				Users:          inboundUsers(cfg.Mixed.Users),
+				SetSystemProxy: cfg.Mixed.SetSystemProxy,
+			},
+		})
+	}
+
+	for i, raw := range cfg.Custom {
+		var ib option.Inbound
+		if err := unmarshalRaw(raw, &ib); err != nil {
+			return nil, fmt.Errorf("inbounds.custom[%d]: %w", i, err)
+		}
+		ibs = append(ibs, ib)
+	}
+
+	return ibs, nil
+}
+
+// InboundOverrideFromQuery maps subscription query parameters such as
+// `?mixed_port=7890&tun=false&lan=true` onto an `inbounds` override document.
+// base are the overrides applied before it (the token's); lan=true is refused
+// unless the mixed inbound ends up with users.
+func InboundOverrideFromQuery(q url.Values, base ...map[string]any) (map[string]any, error) {
+	override := make(map[string]any)
+	section := func(name string) map[string]any {
+		if m, ok := override[name].(map[string]any); ok {
+			return m
+		}
+		m := make(map[string]any)
+		override[name] = m
+		return m
+	}
+
+	for _, name := range []string{"tun", "socks", "mixed"} {
+		if v := q.Get(name); v != "" {
+			enabled, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			section(name)["enabled"] = enabled
+		}
+	}
+	for _, name := range []string{"socks", "mixed"} {
+		if v := q.Get(name + "_port"); v != "" {
+			port, err := strconv.ParseUint(v, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s_port: %w", name, err)
+			}
+			section(name)["port"] = uint16(port)
+		}
+	}
+	if v := q.Get("mtu"); v != "" {
+		mtu, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mtu: %w", err)
+		}
+		section("tun")["mtu"] = uint32(mtu)
+	}
+	username, password := q.Get("lan_username"), q.Get("lan_password")
+	if (username == "") != (password == "") {
+		return nil, fmt.Errorf("lan_username and lan_password go together")
+	}
+	if username != "" {
+		section("mixed")["users"] = []map[string]any{{"username": username, "password": password}}
+	}
+	if v := q.Get("lan"); v != "" {
+		lan, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lan: %w", err)
+		}
+		if lan {
+			section("mixed")["listen"] = "0.0.0.0"
+			// never share an open proxy with the LAN
+			cfg, err := GetInboundConfig(append(slices.Clone(base), override)...)
+			if err != nil {
+				return nil, err
+			}
+			if len(cfg.Mixed.Users) == 0 {
+				return nil, fmt.Errorf("lan=true needs mixed inbound users: configure inbounds.mixed.users or pass lan_username and lan_password")
+			}
+		}
+	}
+
+	return override, nil
+}
+
+func listenOptions(cfg ListenInboundConfig) (option.ListenOptions, error) {
+	addr, err := netip.ParseAddr(cfg.Listen)
+	if err != nil {
+		return option.ListenOptions{}, fmt.Errorf("listen: %w", err)
+	}
+	listen := badoption.Addr(addr)
+	return option.ListenOptions{
+		Listen:     &listen,
+		ListenPort: cfg.Port,
+	}, nil
+}
+
+func inboundUsers(users []InboundUser) []auth.User {
+	var out []auth.User
+	for _, u := range users {
+		out = append(out, auth.User{Username: u.Username, Password: u.Password})
+	}
+	return out
+}
+
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, v := range values {
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,65 @@
+package singbox
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestInboundOverrideFromQuery(t *testing.T) {
+	tokenUsers := map[string]any{"mixed": map[string]any{
+		"users": []map[string]any{{"username": "u", "password": "p"}},
+	}}
+	tests := []struct {
+		query  string
+		base   []map[string]any
+		listen string
+		users  int
+		err    string
+	}{
+		{query: "", listen: "127.0.0.1"},
+		{query: "lan=false", listen: "127.0.0.1"},
+		{query: "lan=true", err: "needs mixed inbound users"},
+		{query: "lan=true&lan_username=a&lan_password=b", listen: "0.0.0.0", users: 1},
+		{query: "lan=true", base: []map[string]any{tokenUsers}, listen: "0.0.0.0", users: 1},
+		{query: "lan=true&lan_username=a", err: "go together"},
+		{query: "lan=maybe", err: "invalid lan"},
+		{query: "mixed_port=70000", err: "invalid mixed_port"},
+	}
+	for _, tt := range tests {
+		q, _ := url.ParseQuery(tt.query)
+		override, err := InboundOverrideFromQuery(q, tt.base...)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%q: error = %v, want %q", tt.query, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.query, err)
+			continue
+		}
+		cfg, err := GetInboundConfig(append(tt.base, override)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Mixed.Listen != tt.listen || len(cfg.Mixed.Users) != tt.users {
+			t.Errorf("%q: mixed listen %s with %d users, want %s with %d", tt.query, cfg.Mixed.Listen, len(cfg.Mixed.Users), tt.listen, tt.users)
+		}
+	}
+}
+
+func TestInboundOverrideFromQueryPorts(t *testing.T) {
+	q, _ := url.ParseQuery("tun=false&socks_port=1080&mixed_port=7890&mtu=1400")
+	override, err := InboundOverrideFromQuery(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := GetInboundConfig(override)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Tun.Enabled || cfg.Tun.MTU != 1400 || cfg.Socks.Port != 1080 || cfg.Mixed.Port != 7890 {
+		t.Errorf("cfg = %+v", cfg)
+	}
+}
@@ -0,0 +1,89 @@
+package singbox
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dingdayu/go-project-template/internal/upstream"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+)
+
+// Usage is the traffic and expiry one provider reports for its subscription.
+type Usage struct {
+	Name     string // the configured upstream name; the url is never shown
+	Userinfo upstream.Userinfo
+}
+
+// infoOutbounds returns one selector per provider, named after its remaining
+// traffic and expiry, and the group holding them. The entries only contain
+// direct-out and nothing routes to the group, so they are never used for
+// traffic; urltest and the proxy selector do not see them.
+func infoOutbounds(usages []Usage, cfg InfoNodesConfig, existing []option.Outbound) []option.Outbound {
+	taken := make(map[string]bool, len(existing))
+	for _, ot := range existing {
+		taken[ot.Tag] = true
+	}
+	if taken[cfg.Group] {
+		return nil
+	}
+
+	var out []option.Outbound
+	var tags []string
+	for i, u := range usages {
+		tag := usageLabel(u, i)
+		if taken[tag] {
+			continue
+		}
+		taken[tag] = true
+		out = append(out, option.Outbound{
+			Tag:     tag,
+			Type:    C.TypeSelector,
+			Options: option.SelectorOutboundOptions{Outbounds: []string{directOutboundTag}},
+		})
+		tags = append(tags, tag)
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	return append(out, option.Outbound{
+		Tag:     cfg.Group,
+		Type:    C.TypeSelector,
+		Options: option.SelectorOutboundOptions{Outbounds: tags},
+	})
+}
+
+// usageLabel reads like "📊 main: 120.0 GB left | expires 2026-12-01", with
+// "upstream 2" for the unnamed second provider. No commas, as Surge style
+// configurations split on them.
+func usageLabel(u Usage, i int) string {
+	info := u.Userinfo
+	used := info.Upload + info.Download
+	name := u.Name
+	if name == "" {
+		name = fmt.Sprintf("upstream %d", i+1)
+	}
+	label := "📊 " + name + ": "
+	if info.Total > 0 {
+		label += formatBytes(max(info.Total-used, 0)) + " left"
+	} else {
+		label += formatBytes(used) + " used"
+	}
+	if info.Expire > 0 {
+		label += " | expires " + time.Unix(info.Expire, 0).Format(time.DateOnly)
+	}
+	return label
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 4; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTP"[exp])
+}
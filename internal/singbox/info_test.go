@@ -0,0 +1,48 @@
+package singbox
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/dingdayu/go-project-template/internal/upstream"
+	"github.com/sagernet/sing-box/option"
+)
+
+func TestUsageLabel(t *testing.T) {
+	expire := time.Date(2026, 12, 1, 12, 0, 0, 0, time.Local).Unix()
+	tests := []struct {
+		u    Usage
+		i    int
+		want string
+	}{
+		{Usage{Name: "main", Userinfo: upstream.Userinfo{Download: 80 << 30, Total: 200 << 30, Expire: expire}}, 0, "📊 main: 120.0 GB left | expires 2026-12-01"},
+		{Usage{Userinfo: upstream.Userinfo{Upload: 512, Download: 512}}, 1, "📊 upstream 2: 1.0 KB used"},
+		{Usage{Name: "over", Userinfo: upstream.Userinfo{Download: 300, Total: 200}}, 0, "📊 over: 0 B left"},
+	}
+	for _, tt := range tests {
+		if got := usageLabel(tt.u, tt.i); got != tt.want {
+			t.Errorf("usageLabel = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestInfoOutbounds(t *testing.T) {
+	cfg := InfoNodesConfig{Group: "info"}
+	usages := []Usage{
+		{Userinfo: upstream.Userinfo{Total: 1 << 30}},
+		{Userinfo: upstream.Userinfo{Total: 1 << 30}},
+	}
+	out := infoOutbounds(usages, cfg, nil)
+	var tags []string
+	for _, ot := range out {
+		tags = append(tags, ot.Tag)
+	}
+	want := []string{"📊 upstream 1: 1.0 GB left", "📊 upstream 2: 1.0 GB left", "info"}
+	if !slices.Equal(tags, want) {
+		t.Errorf("tags = %q, want %q", tags, want)
+	}
+	if got := infoOutbounds(usages, cfg, []option.Outbound{{Tag: "info"}}); got != nil {
+		t.Errorf("group tag taken: %+v", got)
+	}
+}
@@ -0,0 +1,201 @@
+package singbox
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/dingdayu/go-project-template/internal/upstream"
+	"github.com/sagernet/sing-box/common/srs"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	sjson "github.com/sagernet/sing/common/json"
+	"github.com/spf13/viper"
+)
+
+// Managed rule set modes.
+const (
+	ManagedModeRemote = "remote" // compiled to .srs and served from the adapter
+	ManagedModeInline = "inline" // embedded in the profile as an inline rule set
+)
+
+// ManagedRuleSetConfig is an entry of `rule_set.managed`.
+type ManagedRuleSetConfig struct {
+	Tag           string   `mapstructure:"tag"`
+	Mode          string   `mapstructure:"mode"`
+	Outbound      string   `mapstructure:"outbound"` // optional: route matches to this outbound, or "reject"
+	Domain        []string `mapstructure:"domain"`
+	DomainSuffix  []string `mapstructure:"domain_suffix"`
+	DomainKeyword []string `mapstructure:"domain_keyword"`
+	DomainRegex   []string `mapstructure:"domain_regex"`
+	IPCIDR        []string `mapstructure:"ip_cidr"`
+	ProcessName   []string `mapstructure:"process_name"`
+	PackageName   []string `mapstructure:"package_name"`
+}
+
+// ManagedRuleSet is a rule set maintained by the adapter, from config or the database.
+type ManagedRuleSet struct {
+	Tag      string
+	Mode     string
+	Outbound string
+	Version  uint8
+	Rules    option.PlainRuleSet
+}
+
+// StoredRuleSet is a managed rule set kept outside the config, a database row
+// passed in by internal/ruleset; Content is sing-box source JSON.
+type StoredRuleSet struct {
+	Tag      string
+	Mode     string
+	Outbound string
+	Content  string
+}
+
+// GetManagedRuleSets returns the rule sets from `rule_set.managed` followed by
+// the stored ones. A broken config entry is an error, a broken stored one is
+// logged and skipped so a single bad row does not fail every profile.
+func GetManagedRuleSets(stored []StoredRuleSet) ([]ManagedRuleSet, error) {
+	var cfgs []ManagedRuleSetConfig
+	if err := viper.UnmarshalKey("rule_set.managed", &cfgs); err != nil {
+		return nil, fmt.Errorf("singbox.GetManagedRuleSets: unable to decode 'rule_set.managed' into struct: %v", err)
+	}
+
+	reserved := make(map[string]bool)
+	for _, rs := range RemoteRuleSets() {
+		reserved[rs.Tag] = true
+	}
+	var sets []ManagedRuleSet
+	add := func(rs ManagedRuleSet) error {
+		if rs.Tag == "" {
+			return fmt.Errorf("managed rule set without tag")
+		}
+		// clash-* belong to the rule providers of preserved upstream routing
+		if reserved[rs.Tag] || strings.HasPrefix(rs.Tag, upstream.RuleProviderTagPrefix) {
+			return fmt.Errorf("managed rule set %q: duplicate tag", rs.Tag)
+		}
+		reserved[rs.Tag] = true
+		sets = append(sets, rs)
+		return nil
+	}
+
+	for _, cfg := range cfgs {
+		rule := option.DefaultHeadlessRule{
+			Domain:        cfg.Domain,
+			DomainSuffix:  cfg.DomainSuffix,
+			DomainKeyword: cfg.DomainKeyword,
+			DomainRegex:   cfg.DomainRegex,
+			IPCIDR:        cfg.IPCIDR,
+			ProcessName:   cfg.ProcessName,
+			PackageName:   cfg.PackageName,
+		}
+		if !rule.IsValid() {
+			return nil, fmt.Errorf("managed rule set %q: no rules", cfg.Tag)
+		}
+		err := add(ManagedRuleSet{
+			Tag:      cfg.Tag,
+			Mode:     cfg.Mode,
+			Outbound: cfg.Outbound,
+			Version:  C.RuleSetVersion2,
+			Rules: option.PlainRuleSet{
+				Rules: []option.HeadlessRule{{Type: C.RuleTypeDefault, DefaultOptions: rule}},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, row := range stored {
+		compat, err := sjson.UnmarshalExtended[option.PlainRuleSetCompat]([]byte(row.Content))
+		if err != nil {
+			log.Printf("singbox.GetManagedRuleSets: skip stored rule set %q: %v", row.Tag, err)
+			continue
+		}
+		plain, err := compat.Upgrade()
+		if err != nil {
+			log.Printf("singbox.GetManagedRuleSets: skip stored rule set %q: %v", row.Tag, err)
+			continue
+		}
+		err = add(ManagedRuleSet{
+			Tag:      row.Tag,
+			Mode:     row.Mode,
+			Outbound: row.Outbound,
+			Version:  compat.Version,
+			Rules:    plain,
+		})
+		if err != nil {
+			log.Printf("singbox.GetManagedRuleSets: skip stored rule set: %v", err)
+		}
+	}
+
+	return sets, nil
+}
+
+// Compile encodes the rule set in the sing-box binary (.srs) format.
+func (rs ManagedRuleSet) Compile() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := srs.Write(&buf, rs.Rules, rs.Version); err != nil {
+		return nil, fmt.Errorf("compile rule set %q: %w", rs.Tag, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// managedProfileEntries returns the rule set declarations for the managed rule
+// sets and a routing rule for each one that names an outbound. Sets naming an
+// outbound missing from ots, or an empty group, are left out. Remote sets are
+// fetched with the profile's token and fall back to inline when the adapter's
+// public URL or the token is unknown.
+func managedProfileEntries(sets []ManagedRuleSet, ots []option.Outbound, baseURL, token string) ([]option.RuleSet, []option.Rule) {
+	var ruleSets []option.RuleSet
+	var routeRules []option.Rule
+
+	for _, rs := range sets {
+		if rs.Outbound != "" && rs.Outbound != C.RuleActionTypeReject && !hasMembers(ots, rs.Outbound) {
+			log.Printf("singbox: skip managed rule set %q: outbound %q is not in the profile", rs.Tag, rs.Outbound)
+			continue
+		}
+		if rs.Mode == ManagedModeInline || baseURL == "" || token == "" {
+			ruleSets = append(ruleSets, option.RuleSet{
+				Type:          C.RuleSetTypeInline,
+				Tag:           rs.Tag,
+				InlineOptions: rs.Rules,
+			})
+		} else {
+			ruleSets = append(ruleSets, option.RuleSet{
+				Type:   C.RuleSetTypeRemote,
+				Tag:    rs.Tag,
+				Format: C.RuleSetFormatBinary,
+				RemoteOptions: option.RemoteRuleSet{
+					URL:            MirrorURL(baseURL, rs.Tag) + "?token=" + url.QueryEscape(token),
+					DownloadDetour: directOutboundTag,
+				},
+			})
+		}
+
+		if rs.Outbound == "" {
+			continue
+		}
+		action := option.RuleAction{
+			Action: C.RuleActionTypeRoute,
+			RouteOptions: option.RouteActionOptions{
+				Outbound: rs.Outbound,
+			},
+		}
+		if rs.Outbound == C.RuleActionTypeReject {
+			action = option.RuleAction{Action: C.RuleActionTypeReject}
+		}
+		routeRules = append(routeRules, option.Rule{
+			Type: C.RuleTypeDefault,
+			DefaultOptions: option.DefaultRule{
+				RawDefaultRule: option.RawDefaultRule{
+					RuleSet: []string{rs.Tag},
+				},
+				RuleAction: action,
+			},
+		})
+	}
+
+	return ruleSets, routeRules
+}
@@ -0,0 +1,70 @@
+package singbox
+
+import (
+	"testing"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"github.com/spf13/viper"
+)
+
+func TestGetManagedRuleSets(t *testing.T) {
+	viper.Set("rule_set.managed", []map[string]any{{"tag": "intranet", "mode": "remote", "outbound": "direct-out", "domain_suffix": []string{"corp.example"}}})
+	t.Cleanup(func() { viper.Set("rule_set.managed", nil) })
+
+	stored := []StoredRuleSet{
+		{Tag: "ads", Mode: "inline", Outbound: "reject", Content: `{"version":2,"rules":[{"domain_keyword":["ads"]}]}`},
+		{Tag: "intranet", Content: `{"version":2,"rules":[]}`}, // duplicate of the config one
+		{Tag: "clash-direct", Content: `{"version":2,"rules":[]}`},
+		{Tag: "broken", Content: `{`},
+		{Content: `{"version":2,"rules":[]}`},
+	}
+	sets, err := GetManagedRuleSets(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sets) != 2 || sets[0].Tag != "intranet" || sets[1].Tag != "ads" || sets[1].Version != 2 {
+		t.Fatalf("sets = %+v", sets)
+	}
+
+	viper.Set("rule_set.managed", []map[string]any{{"tag": "clash-reject", "domain_suffix": []string{"ads.example"}}})
+	if _, err := GetManagedRuleSets(nil); err == nil {
+		t.Error("config set named like an upstream rule provider accepted")
+	}
+}
+
+func TestManagedProfileEntries(t *testing.T) {
+	viper.Set("rule_set.managed", []map[string]any{
+		{"tag": "intranet", "mode": "remote", "outbound": "direct-out", "domain_suffix": []string{"corp.example"}},
+		{"tag": "ads", "mode": "inline", "outbound": "reject", "domain_keyword": []string{"ads"}},
+		{"tag": "stale", "mode": "inline", "outbound": "gone", "domain_keyword": []string{"stale"}},
+	})
+	t.Cleanup(func() { viper.Set("rule_set.managed", nil) })
+	sets, err := GetManagedRuleSets(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		baseURL, token string
+		intranetType   string
+		url            string
+	}{
+		{"https://sub.example.com", "t 1", C.RuleSetTypeRemote, "https://sub.example.com/rules/intranet.srs?token=t+1"},
+		{"https://sub.example.com", "", C.RuleSetTypeInline, ""},
+		{"", "t1", C.RuleSetTypeInline, ""},
+	}
+	ots := []option.Outbound{{Type: C.TypeDirect, Tag: "direct-out"}}
+	for _, tt := range tests {
+		ruleSets, rules := managedProfileEntries(sets, ots, tt.baseURL, tt.token)
+		if len(ruleSets) != 2 || ruleSets[1].Type != C.RuleSetTypeInline {
+			t.Fatalf("rule sets = %+v", ruleSets)
+		}
+		if rs := ruleSets[0]; rs.Type != tt.intranetType || rs.RemoteOptions.URL != tt.url {
+			t.Errorf("base %q token %q: intranet is %s %q", tt.baseURL, tt.token, rs.Type, rs.RemoteOptions.URL)
+		}
+		if len(rules) != 2 || rules[0].DefaultOptions.RouteOptions.Outbound != "direct-out" || rules[1].DefaultOptions.Action != C.RuleActionTypeReject {
+			t.Errorf("rules = %+v", rules)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package singbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/sagernet/sing-box/include"
+	"github.com/sagernet/sing-box/option"
+	sjson "github.com/sagernet/sing/common/json"
+	"github.com/spf13/viper"
+)
+
+// OverrideConfig is a named profile override under `overrides`. MergePatch is
+// an RFC 7396 merge patch, JSONPatch a list of RFC 6902 operations; when both
+// are set the merge patch is applied first.
+type OverrideConfig struct {
+	MergePatch map[string]any   `mapstructure:"merge_patch"`
+	JSONPatch  []map[string]any `mapstructure:"json_patch"`
+}
+
+func GetOverrideConfigs() (map[string]OverrideConfig, error) {
+	var overrides map[string]OverrideConfig
+	if err := viper.UnmarshalKey("overrides", &overrides); err != nil {
+		return nil, err
+	}
+	return overrides, nil
+}
+
+// ApplyOverrides applies the named overrides to the profile in order and
+// decodes the result again, so a patch producing an invalid profile fails here
+// rather than on the client.
+func ApplyOverrides(ctx context.Context, opts option.Options, names []string) (option.Options, error) {
+	if len(names) == 0 {
+		return opts, nil
+	}
+	overrides, err := GetOverrideConfigs()
+	if err != nil {
+		return opts, err
+	}
+
+	ctx = include.Context(ctx)
+	doc, err := sjson.MarshalContext(ctx, opts)
+	if err != nil {
+		return opts, err
+	}
+	// RFC 6902 has no negative array indices
+	patchOpts := jsonpatch.NewApplyOptions()
+	patchOpts.SupportNegativeIndices = false
+
+	for _, name := range names {
+		// viper lower-cases map keys
+		ov, ok := overrides[strings.ToLower(name)]
+		if !ok {
+			return opts, fmt.Errorf("override %q not found", name)
+		}
+		if ov.MergePatch != nil {
+			patch, err := json.Marshal(ov.MergePatch)
+			if err != nil {
+				return opts, fmt.Errorf("override %q: merge_patch: %w", name, err)
+			}
+			if doc, err = jsonpatch.MergePatch(doc, patch); err != nil {
+				return opts, fmt.Errorf("override %q: merge_patch: %w", name, err)
+			}
+		}
+		if len(ov.JSONPatch) > 0 {
+			raw, err := json.Marshal(ov.JSONPatch)
+			if err != nil {
+				return opts, fmt.Errorf("override %q: json_patch: %w", name, err)
+			}
+			patch, err := jsonpatch.DecodePatch(raw)
+			if err != nil {
+				return opts, fmt.Errorf("override %q: json_patch: %w", name, err)
+			}
+			if doc, err = patch.ApplyWithOptions(doc, patchOpts); err != nil {
+				return opts, fmt.Errorf("override %q: json_patch: %w", name, err)
+			}
+		}
+	}
+
+	var patched option.Options
+	if err := sjson.UnmarshalContext(ctx, doc, &patched); err != nil {
+		return opts, fmt.Errorf("patched profile is invalid: %w", err)
+	}
+	return patched, nil
+}
@@ -0,0 +1,67 @@
+package singbox
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sagernet/sing-box/option"
+	"github.com/spf13/viper"
+)
+
+func TestApplyOverrides(t *testing.T) {
+	viper.Set("overrides", map[string]any{
+		"direct-final": map[string]any{
+			"merge_patch": map[string]any{"route": map[string]any{"final": "direct-out"}},
+			"json_patch": []map[string]any{
+				{"op": "test", "path": "/outbounds/0/tag", "value": "direct-out"},
+				{"op": "add", "path": "/outbounds/-", "value": map[string]any{"type": "block", "tag": "block-out"}},
+			},
+		},
+		"broken": map[string]any{
+			"json_patch": []map[string]any{{"op": "replace", "path": "/outbounds/0/type", "value": "no-such-type"}},
+		},
+		"drop-final": map[string]any{
+			"merge_patch": map[string]any{"route": map[string]any{"final": nil}},
+		},
+		"test-fails": map[string]any{
+			"json_patch": []map[string]any{{"op": "test", "path": "/outbounds/0/tag", "value": "proxy"}},
+		},
+		"negative-index": map[string]any{
+			"json_patch": []map[string]any{{"op": "remove", "path": "/outbounds/-1"}},
+		},
+		"unknown-op": map[string]any{
+			"json_patch": []map[string]any{{"op": "merge", "path": "/route"}},
+		},
+	})
+	t.Cleanup(func() { viper.Set("overrides", nil) })
+
+	opts := option.Options{
+		Outbounds: []option.Outbound{{Type: "direct", Tag: "direct-out", Options: &option.DirectOutboundOptions{}}},
+		Route:     &option.RouteOptions{Final: "proxy"},
+	}
+
+	got, err := ApplyOverrides(context.Background(), opts, []string{"Direct-Final"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Route.Final != "direct-out" || len(got.Outbounds) != 2 || got.Outbounds[1].Tag != "block-out" {
+		t.Errorf("patched = %+v", got)
+	}
+
+	if got, err := ApplyOverrides(context.Background(), opts, []string{"drop-final"}); err != nil || got.Route.Final != "" {
+		t.Errorf("null in merge patch: final %q, error %v", got.Route.Final, err)
+	}
+
+	for _, name := range []string{"test-fails", "negative-index", "unknown-op"} {
+		if _, err := ApplyOverrides(context.Background(), opts, []string{name}); err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("%s: error = %v", name, err)
+		}
+	}
+	if _, err := ApplyOverrides(context.Background(), opts, []string{"missing"}); err == nil {
+		t.Error("unknown override accepted")
+	}
+	if _, err := ApplyOverrides(context.Background(), opts, []string{"broken"}); err == nil || !strings.Contains(err.Error(), "invalid") {
+		t.Errorf("invalid result: error = %v", err)
+	}
+}
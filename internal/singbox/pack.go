@@ -0,0 +1,180 @@
+package singbox
+
+import (
+	"fmt"
+	"log"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"github.com/spf13/viper"
+)
+
+// ServicePackConfig bundles the routing for one service family: traffic
+// matching it goes to Outbound, and its domains resolve through DNSServer.
+type ServicePackConfig struct {
+	Name     string `mapstructure:"name"`
+	Outbound string `mapstructure:"outbound"` // target group; the pack is skipped while it has no members
+	// GeoSite and GeoIP name SagerNet rule sets, declared as geosite-<name> / geoip-<name>.
+	GeoSite       []string `mapstructure:"geosite"`
+	GeoIP         []string `mapstructure:"geoip"`
+	Domain        []string `mapstructure:"domain"`
+	DomainSuffix  []string `mapstructure:"domain_suffix"`
+	DomainKeyword []string `mapstructure:"domain_keyword"`
+	PackageName   []string `mapstructure:"package_name"`
+	ProcessName   []string `mapstructure:"process_name"`
+	DNSServer     string   `mapstructure:"dns_server"`
+}
+
+// defaultServicePacks keeps the AI routing profiles had before packs were configurable.
+var defaultServicePacks = []ServicePackConfig{
+	{
+		Name:         "ai",
+		Outbound:     "ai-proxy",
+		GeoSite:      []string{"openai", "google-gemini"},
+		DomainSuffix: []string{"openai.com", "oaistatic.com", "oaiusercontent.com"},
+		PackageName:  []string{"com.openai.chatgpt", "com.google.android.apps.bard", "com.google.bard"},
+		DNSServer:    "cloudflare-doh",
+	},
+}
+
+// GetServicePacks reads `service_packs`, falling back to the built-in AI pack when the key is absent.
+func GetServicePacks() ([]ServicePackConfig, error) {
+	if !viper.IsSet("service_packs") {
+		return defaultServicePacks, nil
+	}
+	var packs []ServicePackConfig
+	if err := viper.UnmarshalKey("service_packs", &packs); err != nil {
+		return nil, fmt.Errorf("singbox.GetServicePacks: unable to decode 'service_packs' into struct: %v", err)
+	}
+	return packs, nil
+}
+
+// ruleSets declares the remote rule sets the pack references.
+func (p ServicePackConfig) ruleSets() []option.RuleSet {
+	var sets []option.RuleSet
+	for _, name := range p.GeoSite {
+		sets = append(sets, geoRuleSet("geosite", name))
+	}
+	for _, name := range p.GeoIP {
+		sets = append(sets, geoRuleSet("geoip", name))
+	}
+	return sets
+}
+
+func (p ServicePackConfig) ruleSetTags() []string {
+	var tags []string
+	for _, rs := range p.ruleSets() {
+		tags = append(tags, rs.Tag)
+	}
+	return tags
+}
+
+// servicePackRuleSets lists the rule sets of every configured pack, for the mirror.
+func servicePackRuleSets() []option.RuleSet {
+	packs, err := GetServicePacks()
+	if err != nil {
+		log.Printf("%v", err)
+		return nil
+	}
+	var sets []option.RuleSet
+	seen := make(map[string]bool)
+	for _, p := range packs {
+		for _, rs := range p.ruleSets() {
+			if !seen[rs.Tag] {
+				seen[rs.Tag] = true
+				sets = append(sets, rs)
+			}
+		}
+	}
+	return sets
+}
+
+// servicePackEntries emits the route rules, rule sets and DNS rules of the
+// packs whose target group exists with members in ots. Destination, package
+// and process conditions become separate rules: sing-box ANDs those groups
+// within a single rule.
+func servicePackEntries(packs []ServicePackConfig, ots []option.Outbound) (rs []option.Rule, sets []option.RuleSet, dnsRules []option.DNSRule) {
+	seen := make(map[string]bool)
+	for _, p := range packs {
+		if !hasMembers(ots, p.Outbound) {
+			continue
+		}
+		route := option.RuleAction{
+			Action:       C.RuleActionTypeRoute,
+			RouteOptions: option.RouteActionOptions{Outbound: p.Outbound},
+		}
+		tags := p.ruleSetTags()
+		destination := option.RawDefaultRule{
+			Domain:        p.Domain,
+			DomainSuffix:  p.DomainSuffix,
+			DomainKeyword: p.DomainKeyword,
+			RuleSet:       tags,
+		}
+		if len(destination.Domain)+len(destination.DomainSuffix)+len(destination.DomainKeyword)+len(destination.RuleSet) > 0 {
+			rs = append(rs, option.Rule{
+				Type:           C.RuleTypeDefault,
+				DefaultOptions: option.DefaultRule{RawDefaultRule: destination, RuleAction: route},
+			})
+		}
+		if len(p.PackageName) > 0 {
+			rs = append(rs, option.Rule{
+				Type:           C.RuleTypeDefault,
+				DefaultOptions: option.DefaultRule{RawDefaultRule: option.RawDefaultRule{PackageName: p.PackageName}, RuleAction: route},
+			})
+		}
+		if len(p.ProcessName) > 0 {
+			rs = append(rs, option.Rule{
+				Type:           C.RuleTypeDefault,
+				DefaultOptions: option.DefaultRule{RawDefaultRule: option.RawDefaultRule{ProcessName: p.ProcessName}, RuleAction: route},
+			})
+		}
+		for _, s := range p.ruleSets() {
+			if !seen[s.Tag] {
+				seen[s.Tag] = true
+				sets = append(sets, s)
+			}
+		}
+
+		// geoip sets hold addresses, useless for picking a DNS server
+		var siteTags []string
+		for _, name := range p.GeoSite {
+			siteTags = append(siteTags, "geosite-"+name)
+		}
+		dnsMatch := option.RawDefaultDNSRule{
+			Domain:        p.Domain,
+			DomainSuffix:  p.DomainSuffix,
+			DomainKeyword: p.DomainKeyword,
+			RuleSet:       siteTags,
+		}
+		if p.DNSServer != "" && len(dnsMatch.Domain)+len(dnsMatch.DomainSuffix)+len(dnsMatch.DomainKeyword)+len(dnsMatch.RuleSet) > 0 {
+			dnsRules = append(dnsRules, option.DNSRule{
+				Type: C.RuleTypeDefault,
+				DefaultOptions: option.DefaultDNSRule{
+					RawDefaultDNSRule: dnsMatch,
+					DNSRuleAction: option.DNSRuleAction{
+						Action:       C.RuleActionTypeRoute,
+						RouteOptions: option.DNSRouteActionOptions{Server: p.DNSServer},
+					},
+				},
+			})
+		}
+	}
+	return rs, sets, dnsRules
+}
+
+// hasMembers reports whether tag names a generated outbound that is not an empty group.
+func hasMembers(ots []option.Outbound, tag string) bool {
+	for _, ot := range ots {
+		if ot.Tag != tag {
+			continue
+		}
+		switch o := ot.Options.(type) {
+		case option.SelectorOutboundOptions:
+			return len(o.Outbounds) > 0
+		case option.URLTestOutboundOptions:
+			return len(o.Outbounds) > 0
+		}
+		return true
+	}
+	return false
+}
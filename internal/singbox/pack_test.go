@@ -0,0 +1,126 @@
+package singbox
+
+import (
+	"slices"
+	"testing"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"github.com/spf13/viper"
+)
+
+// testNode is a minimal upstream node named after its outbound tag.
+type testNode string
+
+func (n testNode) Name() string { return string(n) }
+
+func (n testNode) ToOutbound() (option.Outbound, error) {
+	return option.Outbound{Type: C.TypeSOCKS, Tag: string(n), Options: option.SOCKSOutboundOptions{}}, nil
+}
+
+func TestDefaultOptionsTagsSelectors(t *testing.T) {
+	viper.Set("selector", []map[string]any{
+		{"name": "auto-proxy"},
+		{"name": "ai-proxy", "keywords": []string{"US", "JP"}},
+		{"name": "streaming", "keywords": []string{"NF"}},
+		{"name": "empty", "keywords": []string{"none"}},
+	})
+	t.Cleanup(func() { viper.Set("selector", nil) })
+
+	nodes := []testNode{"US 01", "JP 02", "HK NF 03"}
+	otd := defaultOptionsTags(nodes, RouteConfig{}, nil)
+
+	members := func(tag string) []string {
+		for _, ot := range otd {
+			if ot.Tag != tag {
+				continue
+			}
+			switch o := ot.Options.(type) {
+			case option.SelectorOutboundOptions:
+				return o.Outbounds
+			case option.URLTestOutboundOptions:
+				return o.Outbounds
+			}
+		}
+		return nil
+	}
+	tests := []struct {
+		tag  string
+		want []string
+	}{
+		{autoOutboundTag, []string{"US 01", "JP 02", "HK NF 03"}},
+		{"ai-proxy", []string{"US 01", "JP 02"}},
+		{"streaming", []string{"HK NF 03"}},
+		{"empty", nil},
+		{proxyOutboundTag, []string{autoOutboundTag, "ai-proxy", "streaming", directOutboundTag}},
+	}
+	for _, tt := range tests {
+		if got := members(tt.tag); !slices.Equal(got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultOptionsTagsTakenTags(t *testing.T) {
+	viper.Set("selector", []map[string]any{
+		{"name": "US 01", "keywords": []string{"US"}},
+		{"name": "streaming", "keywords": []string{"NF"}},
+		{"name": "streaming", "keywords": []string{"US"}},
+	})
+	t.Cleanup(func() { viper.Set("selector", nil) })
+
+	otd := defaultOptionsTags([]testNode{"US 01", "HK NF 03"}, RouteConfig{}, nil)
+	count := make(map[string]int)
+	for _, ot := range otd {
+		count[ot.Tag]++
+	}
+	for tag, n := range count {
+		if n > 1 {
+			t.Errorf("tag %q used %d times", tag, n)
+		}
+	}
+	// nodes are added after the groups, so a group must not take a node's tag
+	if count["US 01"] != 0 || count["streaming"] != 1 {
+		t.Errorf("tags %v", count)
+	}
+}
+
+func TestServicePackEntries(t *testing.T) {
+	packs := []ServicePackConfig{
+		{Name: "ai", Outbound: "ai-proxy", GeoSite: []string{"openai"}, GeoIP: []string{"us"}, PackageName: []string{"com.openai.chatgpt"}, DNSServer: "cloudflare-doh"},
+		{Name: "streaming", Outbound: "streaming", GeoSite: []string{"netflix"}},
+		{Name: "github", Outbound: "github", DomainSuffix: []string{"github.com"}},
+	}
+	ots := []option.Outbound{
+		{Tag: "ai-proxy", Type: C.TypeSelector, Options: option.SelectorOutboundOptions{Outbounds: []string{"US 01"}}},
+		{Tag: "streaming", Type: C.TypeSelector, Options: option.SelectorOutboundOptions{}},
+	}
+	rules, sets, dnsRules := servicePackEntries(packs, ots)
+
+	if len(rules) != 2 {
+		t.Fatalf("rules = %+v", rules)
+	}
+	if got := rules[0].DefaultOptions.RuleSet; !slices.Equal(got, []string{"geosite-openai", "geoip-us"}) {
+		t.Errorf("destination rule sets = %v", got)
+	}
+	if got := rules[1].DefaultOptions.PackageName; !slices.Equal(got, []string{"com.openai.chatgpt"}) {
+		t.Errorf("package rule = %v", got)
+	}
+	for _, r := range rules {
+		if out := r.DefaultOptions.RouteOptions.Outbound; out != "ai-proxy" {
+			t.Errorf("rule routes to %s", out)
+		}
+	}
+	var tags []string
+	for _, s := range sets {
+		tags = append(tags, s.Tag)
+	}
+	if !slices.Equal(tags, []string{"geosite-openai", "geoip-us"}) {
+		t.Errorf("rule sets = %v", tags)
+	}
+	// only the geosite set picks the DNS server
+	if len(dnsRules) != 1 || !slices.Equal(dnsRules[0].DefaultOptions.RuleSet, []string{"geosite-openai"}) ||
+		dnsRules[0].DefaultOptions.RouteOptions.Server != "cloudflare-doh" {
+		t.Errorf("dns rules = %+v", dnsRules)
+	}
+}
@@ -0,0 +1,194 @@
+package singbox
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/dingdayu/go-project-template/internal/upstream"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/include"
+	"github.com/sagernet/sing-box/option"
+	sjson "github.com/sagernet/sing/common/json"
+)
+
+// passThroughKeptTypes are the outbound types of a pass-through profile kept
+// as they are; every other outbound is a node and is replaced by ots.
+var passThroughKeptTypes = []string{C.TypeSelector, C.TypeURLTest, C.TypeDirect, C.TypeBlock, C.TypeDNS}
+
+// PassThroughProfile renders a profile from an upstream sing-box profile,
+// keeping its inbounds, groups, rules, rule sets and DNS. Its nodes are replaced by ots
+// (the already filtered nodes of every upstream); nodes it did not carry are
+// added to its first selector. Groups, rules and detours naming a node that
+// was filtered out are fixed up: members are dropped, emptied groups removed,
+// rules routing to a removed tag dropped and detours cleared.
+func PassThroughProfile[T upstream.ProxyOutbound](base []byte, ots []T) (option.Options, error) {
+	var opts option.Options
+	ctx := include.Context(context.Background())
+
+	// sing-box accepts comments in its profiles
+	doc, err := sjson.UnmarshalExtended[map[string]any](base)
+	if err != nil {
+		return opts, fmt.Errorf("parse pass-through profile: %w", err)
+	}
+	if doc == nil {
+		return opts, fmt.Errorf("parse pass-through profile: not an object")
+	}
+	baseOutbounds, _ := doc["outbounds"].([]any)
+
+	// keep groups and built-ins, remember the node tags the profile carried
+	var outbounds []any
+	baseNodes := make(map[string]bool)
+	for _, raw := range baseOutbounds {
+		ob, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		typ, _ := ob["type"].(string)
+		tag, _ := ob["tag"].(string)
+		if slices.Contains(passThroughKeptTypes, typ) {
+			outbounds = append(outbounds, ob)
+			continue
+		}
+		baseNodes[tag] = true
+	}
+
+	present := make(map[string]bool)
+	var foreign []any
+	for _, ot := range ots {
+		to, err := ot.ToOutbound()
+		if err != nil || to.Tag == "" || present[to.Tag] {
+			continue
+		}
+		b, err := sjson.MarshalContext(ctx, &to)
+		if err != nil {
+			continue
+		}
+		var ob map[string]any
+		if err := sjson.Unmarshal(b, &ob); err != nil {
+			continue
+		}
+		present[to.Tag] = true
+		outbounds = append(outbounds, ob)
+		if !baseNodes[to.Tag] {
+			foreign = append(foreign, to.Tag)
+		}
+	}
+
+	// nodes from other upstreams join the profile's first selector
+	if len(foreign) > 0 {
+		for _, raw := range outbounds {
+			ob := raw.(map[string]any)
+			if ob["type"] == C.TypeSelector {
+				members, _ := ob["outbounds"].([]any)
+				ob["outbounds"] = append(members, foreign...)
+				break
+			}
+		}
+	}
+
+	for _, raw := range outbounds {
+		ob := raw.(map[string]any)
+		if tag, ok := ob["tag"].(string); ok {
+			present[tag] = true
+		}
+	}
+
+	// prune group members naming missing tags until no group is emptied
+	removed := make(map[string]bool)
+	for tag := range baseNodes {
+		if !present[tag] {
+			removed[tag] = true
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		kept := outbounds[:0]
+		for _, raw := range outbounds {
+			ob := raw.(map[string]any)
+			typ, _ := ob["type"].(string)
+			if typ != C.TypeSelector && typ != C.TypeURLTest {
+				kept = append(kept, ob)
+				continue
+			}
+			members, _ := ob["outbounds"].([]any)
+			var live []any
+			for _, m := range members {
+				if tag, _ := m.(string); present[tag] {
+					live = append(live, m)
+				}
+			}
+			if len(live) == 0 {
+				tag, _ := ob["tag"].(string)
+				delete(present, tag)
+				removed[tag] = true
+				changed = true
+				continue
+			}
+			ob["outbounds"] = live
+			if def, ok := ob["default"].(string); ok && !present[def] {
+				delete(ob, "default")
+			}
+			kept = append(kept, ob)
+		}
+		outbounds = kept
+	}
+	doc["outbounds"] = outbounds
+
+	if route, ok := doc["route"].(map[string]any); ok {
+		if rules, ok := route["rules"].([]any); ok {
+			kept := rules[:0]
+			for _, r := range rules {
+				if !routesToRemoved(r, removed) {
+					kept = append(kept, r)
+				}
+			}
+			route["rules"] = kept
+		}
+		if final, ok := route["final"].(string); ok && removed[final] {
+			delete(route, "final")
+		}
+	}
+	clearDetours(doc, removed)
+
+	b, err := sjson.Marshal(doc)
+	if err != nil {
+		return opts, err
+	}
+	if err := sjson.UnmarshalContext(ctx, b, &opts); err != nil {
+		return opts, fmt.Errorf("decode pass-through profile: %w", err)
+	}
+	return opts, nil
+}
+
+// routesToRemoved reports whether a route rule (or a logical rule's sub-rule) routes to a removed tag.
+func routesToRemoved(rule any, removed map[string]bool) bool {
+	r, ok := rule.(map[string]any)
+	if !ok {
+		return false
+	}
+	if tag, ok := r["outbound"].(string); ok && removed[tag] {
+		return true
+	}
+	subs, _ := r["rules"].([]any)
+	return slices.ContainsFunc(subs, func(sub any) bool { return routesToRemoved(sub, removed) })
+}
+
+// clearDetours deletes every detour / download_detour naming a removed tag, at any depth.
+func clearDetours(v any, removed map[string]bool) {
+	switch node := v.(type) {
+	case map[string]any:
+		for _, key := range []string{"detour", "download_detour"} {
+			if tag, ok := node[key].(string); ok && removed[tag] {
+				delete(node, key)
+			}
+		}
+		for _, child := range node {
+			clearDetours(child, removed)
+		}
+	case []any:
+		for _, child := range node {
+			clearDetours(child, removed)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package singbox
+
+import (
+	"slices"
+	"testing"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+)
+
+func TestPassThroughProfile(t *testing.T) {
+	base := []byte(`{
+		// sing-box profiles may carry comments
+		"inbounds": [{"type": "mixed", "tag": "mixed-in", "listen_port": 2080}],
+		"outbounds": [
+			{"type": "selector", "tag": "proxy", "outbounds": ["a", "b", "only-b"], "default": "b"},
+			{"type": "urltest", "tag": "only-b", "outbounds": ["b"]},
+			{"type": "direct", "tag": "direct", "detour": "b"},
+			{"type": "socks", "tag": "a", "server": "192.0.2.1", "server_port": 1080},
+			{"type": "socks", "tag": "b", "server": "192.0.2.2", "server_port": 1080}
+		],
+		"route": {
+			"rules": [
+				{"domain_suffix": ["example.com"], "outbound": "only-b"},
+				{"domain_suffix": ["example.org"], "outbound": "direct"}
+			],
+			"final": "only-b"
+		}
+	}`)
+
+	opts, err := PassThroughProfile(base, []testNode{"a", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opts.Inbounds) != 1 || opts.Inbounds[0].Tag != "mixed-in" {
+		t.Errorf("inbounds %+v", opts.Inbounds)
+	}
+
+	var tags []string
+	for _, ob := range opts.Outbounds {
+		tags = append(tags, ob.Tag)
+	}
+	if !slices.Equal(tags, []string{"proxy", "direct", "a", "c"}) {
+		t.Fatalf("outbounds %v", tags)
+	}
+	sel := opts.Outbounds[0].Options.(*option.SelectorOutboundOptions)
+	if !slices.Equal(sel.Outbounds, []string{"a", "c"}) || sel.Default != "" {
+		t.Errorf("selector %+v", sel)
+	}
+	if direct := opts.Outbounds[1].Options.(*option.DirectOutboundOptions); direct.Detour != "" {
+		t.Errorf("detour to a removed node kept: %q", direct.Detour)
+	}
+	if opts.Outbounds[3].Type != C.TypeSOCKS {
+		t.Errorf("node c is %s", opts.Outbounds[3].Type)
+	}
+	if rules := opts.Route.Rules; len(rules) != 1 || rules[0].DefaultOptions.RouteOptions.Outbound != "direct" {
+		t.Errorf("rules %+v", rules)
+	}
+	if opts.Route.Final != "" {
+		t.Errorf("final %q names a removed group", opts.Route.Final)
+	}
+
+	for _, bad := range []string{`{`, `null`} {
+		if _, err := PassThroughProfile([]byte(bad), []testNode{"a"}); err == nil {
+			t.Errorf("%s accepted", bad)
+		}
+	}
+}
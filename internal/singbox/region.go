@@ -0,0 +1,315 @@
+package singbox
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dingdayu/go-project-template/internal/upstream"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common/json/badoption"
+)
+
+// region describes how a region shows up in node names. Codes are matched as
+// whole words, names as substrings (case-insensitive).
+type region struct {
+	Code  string   // ISO 3166-1 alpha-2, also the group prefix
+	Names []string // English and Chinese names, major cities
+	IATA  []string // airport codes common in node names
+}
+
+var regions = []region{
+	{"HK", []string{"hong kong", "hongkong", "香港", "港"}, []string{"HKG"}},
+	{"TW", []string{"taiwan", "台湾", "臺灣", "台北", "taipei"}, []string{"TPE", "KHH"}},
+	{"MO", []string{"macau", "macao", "澳门", "澳門"}, []string{"MFM"}},
+	{"JP", []string{"japan", "日本", "东京", "東京", "大阪", "tokyo", "osaka"}, []string{"NRT", "HND", "KIX"}},
+	{"KR", []string{"korea", "韩国", "韓國", "首尔", "seoul"}, []string{"ICN", "GMP"}},
+	{"SG", []string{"singapore", "新加坡", "狮城"}, []string{"SIN"}},
+	{"US", []string{"united states", "美国", "美國", "洛杉矶", "硅谷", "los angeles", "san jose", "seattle", "new york"}, []string{"LAX", "SJC", "SFO", "SEA", "JFK", "ORD", "DFW"}},
+	{"CA", []string{"canada", "加拿大", "toronto", "vancouver"}, []string{"YYZ", "YVR"}},
+	{"GB", []string{"united kingdom", "britain", "england", "英国", "英國", "london", "伦敦"}, []string{"LHR", "LGW"}},
+	{"DE", []string{"germany", "德国", "德國", "frankfurt", "法兰克福"}, []string{"FRA"}},
+	{"FR", []string{"france", "法国", "法國", "paris", "巴黎"}, []string{"CDG"}},
+	{"NL", []string{"netherlands", "holland", "荷兰", "荷蘭", "amsterdam"}, []string{"AMS"}},
+	{"RU", []string{"russia", "俄罗斯", "俄羅斯", "moscow"}, []string{"SVO", "DME"}},
+	{"IN", []string{"india", "印度", "mumbai"}, []string{"BOM", "DEL"}},
+	{"AU", []string{"australia", "澳大利亚", "澳洲", "sydney"}, []string{"SYD", "MEL"}},
+	{"TR", []string{"turkey", "türkiye", "土耳其", "istanbul"}, []string{"IST"}},
+	{"AR", []string{"argentina", "阿根廷"}, []string{"EZE"}},
+	{"BR", []string{"brazil", "巴西"}, []string{"GRU"}},
+	{"TH", []string{"thailand", "泰国", "泰國", "bangkok"}, []string{"BKK"}},
+	{"VN", []string{"vietnam", "越南"}, []string{"SGN", "HAN"}},
+	{"MY", []string{"malaysia", "马来西亚", "馬來西亞"}, []string{"KUL"}},
+	{"PH", []string{"philippines", "菲律宾", "菲律賓"}, []string{"MNL"}},
+	{"ID", []string{"indonesia", "印尼", "印度尼西亚"}, []string{"CGK"}},
+	{"AE", []string{"united arab emirates", "dubai", "阿联酋", "迪拜"}, []string{"DXB"}},
+}
+
+type regionName struct{ name, code string }
+
+// regionNames holds the names of all regions, longest first, so that a name
+// containing another one wins: 印度尼西亚 (ID) over 印度 (IN).
+var regionNames = func() []regionName {
+	var out []regionName
+	for _, r := range regions {
+		for _, n := range r.Names {
+			out = append(out, regionName{n, r.Code})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return len(out[i].name) > len(out[j].name) })
+	return out
+}()
+
+// wordPattern matches standalone ASCII letter runs, used for ISO and airport codes.
+var wordPattern = regexp.MustCompile(`[A-Za-z]+`)
+
+// DetectRegion returns the ISO code of the region a node name refers to, in
+// order of confidence: flag emoji, airport code, country or city name, ISO code.
+func DetectRegion(name string) string {
+	if code := flagRegion(name); code != "" {
+		return code
+	}
+	words := wordPattern.FindAllString(name, -1)
+	for _, r := range regions {
+		for _, w := range words {
+			if slices.Contains(r.IATA, w) {
+				return r.Code
+			}
+		}
+	}
+	lower := strings.ToLower(name)
+	for _, n := range regionNames {
+		if strings.Contains(lower, n.name) {
+			return n.code
+		}
+	}
+	for _, r := range regions {
+		for _, w := range words {
+			if w == r.Code || (r.Code == "GB" && w == "UK") {
+				return r.Code
+			}
+		}
+	}
+	return ""
+}
+
+// flagRegion decodes the first flag emoji (a pair of regional indicator symbols).
+func flagRegion(name string) string {
+	runes := []rune(name)
+	for i := 0; i+1 < len(runes); i++ {
+		a, b := runes[i], runes[i+1]
+		if a >= 0x1F1E6 && a <= 0x1F1FF && b >= 0x1F1E6 && b <= 0x1F1FF {
+			code := string([]rune{'A' + (a - 0x1F1E6), 'A' + (b - 0x1F1E6)})
+			if code == "UK" {
+				code = "GB"
+			}
+			return code
+		}
+	}
+	return ""
+}
+
+// RegionFlag returns the flag emoji of an ISO region code, empty for anything else.
+func RegionFlag(code string) string {
+	if len(code) != 2 || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+		return ""
+	}
+	return string([]rune{0x1F1E6 + rune(code[0]-'A'), 0x1F1E6 + rune(code[1]-'A')})
+}
+
+// geoIPTable is a sorted list of address ranges loaded from a CSV of
+// "start,end,country" lines (db-ip / ip2location lite country format).
+type geoIPTable struct {
+	starts []netip.Addr
+	ends   []netip.Addr
+	codes  []string
+}
+
+var (
+	geoIPMu     sync.Mutex
+	geoIPPath   string
+	geoIPLoaded *geoIPTable
+)
+
+// loadGeoIP reads and caches the table at path, reloading only when the path changes.
+func loadGeoIP(path string) (*geoIPTable, error) {
+	geoIPMu.Lock()
+	defer geoIPMu.Unlock()
+	if path == geoIPPath && geoIPLoaded != nil {
+		return geoIPLoaded, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	type row struct {
+		start, end netip.Addr
+		code       string
+	}
+	var rows []row
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Split(strings.ReplaceAll(scanner.Text(), `"`, ""), ",")
+		if len(fields) < 3 {
+			continue
+		}
+		start, err1 := netip.ParseAddr(strings.TrimSpace(fields[0]))
+		end, err2 := netip.ParseAddr(strings.TrimSpace(fields[1]))
+		if err1 != nil || err2 != nil {
+			continue // header or malformed line
+		}
+		rows = append(rows, row{start.Unmap(), end.Unmap(), strings.ToUpper(strings.TrimSpace(fields[2]))})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].start.Less(rows[j].start) })
+
+	t := &geoIPTable{}
+	for _, r := range rows {
+		t.starts = append(t.starts, r.start)
+		t.ends = append(t.ends, r.end)
+		t.codes = append(t.codes, r.code)
+	}
+	geoIPPath, geoIPLoaded = path, t
+	return t, nil
+}
+
+func (t *geoIPTable) lookup(addr netip.Addr) string {
+	addr = addr.Unmap()
+	i := sort.Search(len(t.starts), func(i int) bool { return addr.Less(t.starts[i]) }) - 1
+	if i >= 0 && !t.ends[i].Less(addr) && t.starts[i].BitLen() == addr.BitLen() {
+		return t.codes[i]
+	}
+	return ""
+}
+
+// outboundServer returns the server address of a node outbound, empty for types without one.
+func outboundServer(ot option.Outbound) string {
+	v := reflect.ValueOf(ot.Options)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	f := v.FieldByName("Server")
+	if !f.IsValid() || f.Kind() != reflect.String {
+		return ""
+	}
+	return f.String()
+}
+
+// regionOutbounds builds one urltest group per detected region with at least
+// cfg.MinNodes nodes, plus a selector over them. Groups whose tag is already
+// taken are left out and the new tags are added to taken. It returns the
+// outbounds and the tag the proxy selector should offer, empty when no group
+// was built.
+func regionOutbounds[T upstream.ProxyOutbound](ots []T, cfg RegionConfig, taken map[string]bool) ([]option.Outbound, string) {
+	if taken[cfg.Selector] {
+		log.Printf("singbox: skip region groups: tag %q is taken", cfg.Selector)
+		return nil, ""
+	}
+	var table *geoIPTable
+	if cfg.GeoIPFile != "" {
+		var err error
+		if table, err = loadGeoIP(cfg.GeoIPFile); err != nil {
+			log.Printf("singbox: region geoip disabled: %v", err)
+		}
+	}
+
+	members := make(map[string][]string)
+	seen := make(map[string]bool)
+	for _, ot := range ots {
+		to, err := ot.ToOutbound()
+		if err != nil || to.Tag == "" || seen[to.Tag] {
+			continue
+		}
+		seen[to.Tag] = true
+		code := DetectRegion(ot.Name())
+		if code == "" && table != nil {
+			// only literal addresses: resolving host names would make rendering depend on DNS
+			if addr, err := netip.ParseAddr(outboundServer(to)); err == nil {
+				code = table.lookup(addr)
+			}
+		}
+		if code == "" || (len(cfg.Include) > 0 && !slices.ContainsFunc(cfg.Include, func(c string) bool { return strings.EqualFold(c, code) })) {
+			continue
+		}
+		members[code] = append(members[code], to.Tag)
+	}
+
+	codes := make([]string, 0, len(members))
+	for code, tags := range members {
+		if len(tags) >= cfg.MinNodes {
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) == 0 {
+		return nil, ""
+	}
+	// regions in table order (roughly by popularity), unknown codes after them
+	rank := func(code string) int {
+		if i := slices.IndexFunc(regions, func(r region) bool { return r.Code == code }); i >= 0 {
+			return i
+		}
+		return len(regions)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if rank(codes[i]) != rank(codes[j]) {
+			return rank(codes[i]) < rank(codes[j])
+		}
+		return codes[i] < codes[j]
+	})
+
+	var otd []option.Outbound
+	var groupTags []string
+	for _, code := range codes {
+		tag := fmt.Sprintf("%s%s", code, cfg.Suffix)
+		if taken[tag] || tag == cfg.Selector {
+			log.Printf("singbox: skip region group %q: tag is taken", tag)
+			continue
+		}
+		otd = append(otd, option.Outbound{
+			Tag:  tag,
+			Type: C.TypeURLTest,
+			Options: option.URLTestOutboundOptions{
+				URL:       "https://www.google.com/generate_204",
+				Interval:  badoption.Duration(300 * time.Second),
+				Tolerance: 50,
+				Outbounds: members[code],
+			},
+		})
+		groupTags = append(groupTags, tag)
+	}
+	if len(groupTags) == 0 {
+		return nil, ""
+	}
+	for _, tag := range groupTags {
+		taken[tag] = true
+	}
+	taken[cfg.Selector] = true
+	otd = append(otd, option.Outbound{
+		Tag:  cfg.Selector,
+		Type: C.TypeSelector,
+		Options: option.SelectorOutboundOptions{
+			Outbounds: groupTags,
+		},
+	})
+	return otd, cfg.Selector
+}
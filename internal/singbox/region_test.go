@@ -0,0 +1,75 @@
+package singbox
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/sagernet/sing-box/option"
+)
+
+func TestDetectRegion(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"🇯🇵 Tokyo 01", "JP"},
+		{"🇬🇧 London", "GB"},
+		{"Node LAX 02", "US"},
+		{"香港 01", "HK"},
+		{"Hong Kong IPLC", "HK"},
+		{"印度尼西亚 01", "ID"},
+		{"印度 01", "IN"},
+		{"印尼 雅加达", "ID"},
+		{"澳大利亚 悉尼", "AU"},
+		{"澳门 01", "MO"},
+		{"South America 01", ""},
+		{"Latin America", ""},
+		{"United States 02", "US"},
+		{"UK 03", "GB"},
+		{"JP-2", "JP"},
+		{"LAXATIVE", ""},
+		{"unknown node", ""},
+	}
+	for _, tt := range tests {
+		if got := DetectRegion(tt.name); got != tt.want {
+			t.Errorf("DetectRegion(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRegionFlag(t *testing.T) {
+	tests := []struct{ code, want string }{
+		{"JP", "🇯🇵"},
+		{"US", "🇺🇸"},
+		{"jp", ""},
+		{"USA", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := RegionFlag(tt.code); got != tt.want {
+			t.Errorf("RegionFlag(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestRegionOutboundsTakenTags(t *testing.T) {
+	cfg := RegionConfig{MinNodes: 1, Suffix: "-auto", Selector: "region"}
+	nodes := []testNode{"HK 01", "JP 02", "JP-auto"}
+
+	taken := map[string]bool{"JP-auto": true}
+	otd, tag := regionOutbounds(nodes, cfg, taken)
+	var tags []string
+	for _, ot := range otd {
+		tags = append(tags, ot.Tag)
+	}
+	if tag != "region" || !slices.Equal(tags, []string{"HK-auto", "region"}) {
+		t.Fatalf("tags %v, selector %q", tags, tag)
+	}
+	if sel := otd[1].Options.(option.SelectorOutboundOptions); !slices.Equal(sel.Outbounds, []string{"HK-auto"}) {
+		t.Errorf("region selector %v", sel.Outbounds)
+	}
+	if !taken["HK-auto"] || !taken["region"] {
+		t.Errorf("new tags not marked taken: %v", taken)
+	}
+
+	if otd, tag := regionOutbounds(nodes, cfg, map[string]bool{"region": true}); otd != nil || tag != "" {
+		t.Errorf("selector tag taken: %v, %q", otd, tag)
+	}
+}
@@ -0,0 +1,79 @@
+package singbox
+
+import (
+	"strings"
+
+	"github.com/dingdayu/go-project-template/internal/upstream"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+)
+
+// geoRuleSet declares a remote SagerNet geosite/geoip rule set, kind being "geosite" or "geoip".
+func geoRuleSet(kind, name string) option.RuleSet {
+	return option.RuleSet{
+		Type:   C.RuleSetTypeRemote,
+		Tag:    kind + "-" + name,
+		Format: C.RuleSetFormatBinary,
+		RemoteOptions: option.RemoteRuleSet{
+			URL:            "https://jsd.onmicrosoft.cn/gh/SagerNet/sing-" + kind + "@rule-set/" + kind + "-" + name + ".srs",
+			DownloadDetour: directOutboundTag,
+		},
+	}
+}
+
+// upstreamRoutingEntries merges the preserved upstream routings into route
+// rules and the rule sets they need. Policies that name no generated outbound
+// (e.g. Clash proxy-groups) fall back to the proxy selector. declared lists
+// the rule set tags the profile already carries; final is the first MATCH
+// policy after the same mapping, empty when no upstream has one.
+func upstreamRoutingEntries(routings []upstream.Routing, ots []option.Outbound, declared []option.RuleSet) (rs []option.Rule, sets []option.RuleSet, final string) {
+	tags := make(map[string]bool, len(ots))
+	for _, ot := range ots {
+		tags[ot.Tag] = true
+	}
+	target := func(policy string) string {
+		if tags[policy] {
+			return policy
+		}
+		return proxyOutboundTag
+	}
+
+	seen := make(map[string]bool, len(declared))
+	for _, s := range declared {
+		seen[s.Tag] = true
+	}
+	addSet := func(s option.RuleSet) {
+		if seen[s.Tag] {
+			return
+		}
+		seen[s.Tag] = true
+		sets = append(sets, s)
+	}
+
+	for _, routing := range routings {
+		for _, r := range routing.Rules {
+			// copy: the routing is shared by every request
+			if r.DefaultOptions.RuleAction.Action == C.RuleActionTypeRoute {
+				r.DefaultOptions.RuleAction.RouteOptions.Outbound = target(r.DefaultOptions.RuleAction.RouteOptions.Outbound)
+			}
+			rs = append(rs, r)
+		}
+		for _, s := range routing.RuleSets {
+			addSet(s)
+		}
+		for _, name := range routing.GeoSites {
+			addSet(geoRuleSet("geosite", name))
+		}
+		for _, name := range routing.GeoIPs {
+			addSet(geoRuleSet("geoip", name))
+		}
+		if final == "" && routing.Final != "" {
+			final = routing.Final
+			if strings.EqualFold(final, upstream.PolicyDirect) {
+				final = directOutboundTag
+			}
+			final = target(final)
+		}
+	}
+	return rs, sets, final
+}
@@ -0,0 +1,34 @@
+package singbox
+
+import (
+	"net/url"
+	"strings"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"github.com/spf13/viper"
+)
+
+// MirrorPath is the route prefix the adapter serves mirrored rule sets from.
+const MirrorPath = "/rules/"
+
+// mirrorRuleSets points remote rule sets at the adapter's own mirror when
+// `rule_set.mirror.enabled` is set and a public base URL is known.
+func mirrorRuleSets(sets []option.RuleSet, baseURL string) []option.RuleSet {
+	if !viper.GetBool("rule_set.mirror.enabled") || baseURL == "" {
+		return sets
+	}
+	out := make([]option.RuleSet, 0, len(sets))
+	for _, rs := range sets {
+		if rs.Type == C.RuleSetTypeRemote && rs.Format == C.RuleSetFormatBinary {
+			rs.RemoteOptions.URL = MirrorURL(baseURL, rs.Tag)
+		}
+		out = append(out, rs)
+	}
+	return out
+}
+
+// MirrorURL returns the public URL of the mirrored rule set with the given tag.
+func MirrorURL(baseURL, tag string) string {
+	return strings.TrimSuffix(baseURL, "/") + MirrorPath + url.PathEscape(tag) + ".srs"
+}
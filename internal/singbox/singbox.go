@@ -1,7 +1,10 @@
 package singbox
 
 import (
-	"net/netip"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/dingdayu/go-project-template/internal/proxy"
@@ -11,193 +14,18 @@ import (
 	"github.com/sagernet/sing/common/json/badoption"
 )
 
-var dnsServers = []option.DNSServerOptions{
-	{
-		Type: C.DNSTypeHTTPS,
-		Tag:  "google-doh",
-		Options: option.RemoteHTTPSDNSServerOptions{
-			RemoteTLSDNSServerOptions: option.RemoteTLSDNSServerOptions{
-				RemoteDNSServerOptions: option.RemoteDNSServerOptions{
-					DNSServerAddressOptions: option.DNSServerAddressOptions{
-						Server:     "8.8.8.8",
-						ServerPort: 443,
-					},
-					LocalDNSServerOptions: option.LocalDNSServerOptions{
-						DialerOptions: option.DialerOptions{
-							Detour: "auto-out",
-						},
-					},
-				},
-
-				OutboundTLSOptionsContainer: option.OutboundTLSOptionsContainer{
-					TLS: &option.OutboundTLSOptions{
-						ServerName: "dns.google",
-					},
-				},
-			},
-			Path: "/dns-query",
-		},
-	},
-	{
-		Type: C.DNSTypeHTTPS,
-		Tag:  "alidns",
-		Options: option.RemoteHTTPSDNSServerOptions{
-			RemoteTLSDNSServerOptions: option.RemoteTLSDNSServerOptions{
-				RemoteDNSServerOptions: option.RemoteDNSServerOptions{
-					DNSServerAddressOptions: option.DNSServerAddressOptions{
-						Server:     "223.5.5.5",
-						ServerPort: 443,
-					},
-					LocalDNSServerOptions: option.LocalDNSServerOptions{
-						DialerOptions: option.DialerOptions{
-							Detour: "direct-out",
-						},
-					},
-				},
-				OutboundTLSOptionsContainer: option.OutboundTLSOptionsContainer{
-					TLS: &option.OutboundTLSOptions{
-						ServerName: "dns.alidns.com",
-					},
-				},
-			},
-			Path: "/dns-query",
-		},
-	},
-	{
-		Type: C.DNSTypeHTTPS,
-		Tag:  "cloudflare-doh",
-		Options: option.RemoteHTTPSDNSServerOptions{
-			RemoteTLSDNSServerOptions: option.RemoteTLSDNSServerOptions{
-				RemoteDNSServerOptions: option.RemoteDNSServerOptions{
-					DNSServerAddressOptions: option.DNSServerAddressOptions{
-						Server:     "1.1.1.1",
-						ServerPort: 443,
-					},
-					LocalDNSServerOptions: option.LocalDNSServerOptions{
-						DialerOptions: option.DialerOptions{
-							Detour: "auto-out",
-						},
-					},
-				},
-				OutboundTLSOptionsContainer: option.OutboundTLSOptionsContainer{
-					TLS: &option.OutboundTLSOptions{
-						ServerName: "cloudflare-dns.com",
-					},
-				},
-			},
-			Path: "/dns-query",
-		},
-	},
-}
-
-var dnsRules = []option.DNSRule{
-	// 1) adblock 优先且直接拒绝
-	{
-		Type: C.RuleTypeDefault,
-		DefaultOptions: option.DefaultDNSRule{
-			RawDefaultDNSRule: option.RawDefaultDNSRule{
-				RuleSet: []string{"adblock"},
-			},
-			DNSRuleAction: option.DNSRuleAction{
-				Action:        C.RuleActionTypeReject,
-				RejectOptions: option.RejectActionOptions{},
-			},
-		},
-	},
-	// 保留原有按域名走 alidns 的特例
-	{
-		Type: C.RuleTypeDefault,
-		DefaultOptions: option.DefaultDNSRule{
-			RawDefaultDNSRule: option.RawDefaultDNSRule{
-				DomainSuffix: []string{
-					"onmicrosoft.cn",
-					"s4b4.com",
-					"github.com",
-					"raw.githubusercontent.com",
-				},
-			},
-			DNSRuleAction: option.DNSRuleAction{
-				Action: C.RuleActionTypeRoute,
-				RouteOptions: option.DNSRouteActionOptions{
-					Server: "alidns",
-				},
-			},
-		},
-	},
-	// 国内直连优先使用 alidns 解析
-	{
-		Type: C.RuleTypeDefault,
-		DefaultOptions: option.DefaultDNSRule{
-			RawDefaultDNSRule: option.RawDefaultDNSRule{
-				RuleSet:   []string{"geosite-cn", "geoip-cn"},
-				ClashMode: C.RuleActionTypeDirect,
-			},
-			DNSRuleAction: option.DNSRuleAction{
-				Action: C.RuleActionTypeRoute,
-				RouteOptions: option.DNSRouteActionOptions{
-					Server: "alidns",
-				},
-			},
-		},
-	},
-	// 全局兜底
-	{
-		Type: C.RuleTypeDefault,
-		DefaultOptions: option.DefaultDNSRule{
-			RawDefaultDNSRule: option.RawDefaultDNSRule{
-				ClashMode: "global",
-			},
-			DNSRuleAction: option.DNSRuleAction{
-				Action: C.RuleActionTypeRoute,
-				RouteOptions: option.DNSRouteActionOptions{
-					Server: "alidns",
-				},
-			},
-		},
-	},
-}
-
-// Create a netip.Addr variable to take its address (cannot take address of temporary value)
-var (
-	loopback     = netip.MustParseAddr("127.0.0.1")
-	loopbackAddr = badoption.Addr(loopback)
+// Well-known outbound tags shared by the generated outbounds, rules and DNS servers.
+const (
+	directOutboundTag = "direct-out"
+	autoOutboundTag   = "auto-out"
+	proxyOutboundTag  = "proxy"
 )
 
-var inbounds = []option.Inbound{
-	{
-		Type: "tun",
-		Tag:  "tun-in",
-		Options: option.TunInboundOptions{
-			AutoRoute: true,
-			Address: badoption.Listable[netip.Prefix]{
-				netip.MustParsePrefix("172.19.0.1/30"),
-				netip.MustParsePrefix("2001:0470:f9da:fdfa::1/64"),
-			},
-			MTU:         9000,
-			StrictRoute: true, // 强制严格路由规则，可能导致部分流量无法访问，建议开启后测试可用性
-		},
-	},
-	{
-		Type: "socks",
-		Tag:  "socks-in",
-		Options: option.SocksInboundOptions{
-			ListenOptions: option.ListenOptions{
-				Listen:     &loopbackAddr,
-				ListenPort: 2333,
-			},
-		},
-	},
-	{
-		Type: "mixed",
-		Tag:  "mixed-in",
-		Options: option.HTTPMixedInboundOptions{
-			ListenOptions: option.ListenOptions{
-				Listen:     &loopbackAddr,
-				ListenPort: 2334,
-			},
-		},
-	},
-}
+// clash_mode values switched by clash API dashboards; "rule" needs no rule of its own.
+const (
+	clashModeDirect = "direct"
+	clashModeGlobal = "global"
+)
 
 var ruleSet = []option.RuleSet{
 	{
@@ -206,7 +34,7 @@ var ruleSet = []option.RuleSet{
 		Format: C.RuleSetFormatBinary,
 		RemoteOptions: option.RemoteRuleSet{
 			URL:            "https://jsd.onmicrosoft.cn/gh/SagerNet/sing-geosite@rule-set/geosite-cn.srs",
-			DownloadDetour: "direct-out",
+			DownloadDetour: directOutboundTag,
 		},
 	},
 	{
@@ -215,7 +43,7 @@ var ruleSet = []option.RuleSet{
 		Format: C.RuleSetFormatBinary,
 		RemoteOptions: option.RemoteRuleSet{
 			URL:            "https://jsd.onmicrosoft.cn/gh/SagerNet/sing-geoip@rule-set/geoip-cn.srs",
-			DownloadDetour: "direct-out",
+			DownloadDetour: directOutboundTag,
 		},
 	},
 	{
@@ -224,11 +52,16 @@ var ruleSet = []option.RuleSet{
 		Format: C.RuleSetFormatBinary,
 		RemoteOptions: option.RemoteRuleSet{
 			URL:            "https://jsd.onmicrosoft.cn/gh/SagerNet/sing-geosite@rule-set/geosite-adblock.srs",
-			DownloadDetour: "direct-out",
+			DownloadDetour: directOutboundTag,
 		},
 	},
 }
 
+// RemoteRuleSets lists every remote rule set a generated profile may reference.
+func RemoteRuleSets() []option.RuleSet {
+	return append(slices.Clone(ruleSet), servicePackRuleSets()...)
+}
+
 var rules = []option.Rule{
 	// 2) adblock 路由层直接拒绝，优先级最高
 	{
@@ -243,51 +76,185 @@ var rules = []option.Rule{
 			},
 		},
 	},
-	// 内网直连 + 国内直连
+	// clash_mode=direct -> 全部直连
+	{
+		Type: C.RuleTypeDefault,
+		DefaultOptions: option.DefaultRule{
+			RawDefaultRule: option.RawDefaultRule{
+				ClashMode: clashModeDirect,
+			},
+			RuleAction: option.RuleAction{
+				Action: C.RuleActionTypeRoute,
+				RouteOptions: option.RouteActionOptions{
+					Outbound: directOutboundTag,
+				},
+			},
+		},
+	},
+	// clash_mode=global -> 全部走 proxy 选择器
+	{
+		Type: C.RuleTypeDefault,
+		DefaultOptions: option.DefaultRule{
+			RawDefaultRule: option.RawDefaultRule{
+				ClashMode: clashModeGlobal,
+			},
+			RuleAction: option.RuleAction{
+				Action: C.RuleActionTypeRoute,
+				RouteOptions: option.RouteActionOptions{
+					Outbound: proxyOutboundTag,
+				},
+			},
+		},
+	},
+}
+
+// directRules send private and mainland China traffic direct. They are left
+// out when upstream routing is preserved, which carries its own equivalents.
+var directRules = []option.Rule{
+	// 内网直连
 	{
 		Type: C.RuleTypeDefault,
 		DefaultOptions: option.DefaultRule{
 			RawDefaultRule: option.RawDefaultRule{
-				ClashMode:   C.RuleActionTypeDirect,
 				IPIsPrivate: true,
-				RuleSet:     []string{"geosite-cn", "geoip-cn"},
 			},
 			RuleAction: option.RuleAction{
 				Action: C.RuleActionTypeRoute,
 				RouteOptions: option.RouteActionOptions{
-					Outbound: "direct-out",
+					Outbound: directOutboundTag,
 				},
 			},
 		},
 	},
-	// 全局兜底 -> auto-out
+	// 国内直连，其余流量落到 Final
 	{
 		Type: C.RuleTypeDefault,
 		DefaultOptions: option.DefaultRule{
 			RawDefaultRule: option.RawDefaultRule{
-				ClashMode: "global",
+				RuleSet: []string{"geosite-cn", "geoip-cn"},
 			},
 			RuleAction: option.RuleAction{
 				Action: C.RuleActionTypeRoute,
 				RouteOptions: option.RouteActionOptions{
-					Outbound: "auto-out",
+					Outbound: directOutboundTag,
 				},
 			},
 		},
 	},
 }
 
-func defaultOptionsTags[T upstream.ProxyOutbound](ots []T) []option.Outbound {
+// routeActionRules builds the leading rule actions for the TUN inbound: sniff
+// first so domain rules also match raw IP connections, then hijack DNS queries
+// into the DNS module, and finally an optional resolve for IP based rules.
+func routeActionRules(cfg RouteConfig, tun bool) ([]option.Rule, error) {
+	var actions []option.Rule
+
+	if cfg.Sniff.Enabled && tun {
+		actions = append(actions, option.Rule{
+			Type: C.RuleTypeDefault,
+			DefaultOptions: option.DefaultRule{
+				RawDefaultRule: option.RawDefaultRule{
+					Inbound: []string{tunInboundTag},
+				},
+				RuleAction: option.RuleAction{
+					Action: C.RuleActionTypeSniff,
+					SniffOptions: option.RouteActionSniff{
+						Sniffer: cfg.Sniff.Sniffers,
+						Timeout: badoption.Duration(cfg.Sniff.Timeout),
+					},
+				},
+			},
+		})
+	}
+
+	// other inbounds are proxies of their own, their DNS traffic goes out as is
+	if cfg.HijackDNS && tun {
+		actions = append(actions, option.Rule{
+			Type: C.RuleTypeLogical,
+			LogicalOptions: option.LogicalRule{
+				RawLogicalRule: option.RawLogicalRule{
+					Mode: C.LogicalTypeOr,
+					Rules: []option.Rule{
+						{
+							Type: C.RuleTypeDefault,
+							DefaultOptions: option.DefaultRule{
+								RawDefaultRule: option.RawDefaultRule{Inbound: []string{tunInboundTag}, Protocol: []string{C.ProtocolDNS}},
+							},
+						},
+						{
+							Type: C.RuleTypeDefault,
+							DefaultOptions: option.DefaultRule{
+								RawDefaultRule: option.RawDefaultRule{Inbound: []string{tunInboundTag}, Port: []uint16{53}},
+							},
+						},
+					},
+				},
+				RuleAction: option.RuleAction{
+					Action: C.RuleActionTypeHijackDNS,
+				},
+			},
+		})
+	}
+
+	if cfg.Resolve.Enabled && tun {
+		strategy, err := parseDomainStrategy(cfg.Resolve.Strategy)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, option.Rule{
+			Type: C.RuleTypeDefault,
+			DefaultOptions: option.DefaultRule{
+				RawDefaultRule: option.RawDefaultRule{
+					Inbound: []string{tunInboundTag},
+				},
+				RuleAction: option.RuleAction{
+					Action: C.RuleActionTypeResolve,
+					ResolveOptions: option.RouteActionResolve{
+						Server:   cfg.Resolve.Server,
+						Strategy: strategy,
+					},
+				},
+			},
+		})
+	}
+
+	return actions, nil
+}
+
+// parseDomainStrategy converts a config value such as "prefer_ipv4" into option.DomainStrategy.
+func parseDomainStrategy(s string) (option.DomainStrategy, error) {
+	var strategy option.DomainStrategy
+	if s == "" {
+		return strategy, nil
+	}
+	if err := strategy.UnmarshalJSON([]byte(strconv.Quote(s))); err != nil {
+		return strategy, fmt.Errorf("invalid domain strategy %q: %w", s, err)
+	}
+	return strategy, nil
+}
+
+func defaultOptionsTags[T upstream.ProxyOutbound](ots []T, cfg RouteConfig, upstreamGroups []upstream.ProxyGroup) []option.Outbound {
 	var otd []option.Outbound
 
 	otd = append(otd, []option.Outbound{
 		{
-			Tag:     "direct-out",
+			Tag:     directOutboundTag,
 			Type:    C.TypeDirect,
 			Options: option.DirectOutboundOptions{},
 		},
 	}...)
 
+	// groups collects the tags offered by the top-level proxy selector, in order.
+	var groups []string
+
+	// taken holds the tags in use; a group named like a node or an earlier group is left out
+	taken := map[string]bool{directOutboundTag: true, proxyOutboundTag: true}
+	for _, ot := range ots {
+		if to, err := ot.ToOutbound(); err == nil && to.Tag != "" {
+			taken[to.Tag] = true
+		}
+	}
+
 	selectors, _ := GetSelectors()
 	for _, sel := range selectors {
 		switch sel.Name {
@@ -306,8 +273,16 @@ func defaultOptionsTags[T upstream.ProxyOutbound](ots []T) []option.Outbound {
 					}
 				}
 			}
+			if len(autoOutbounds) == 0 {
+				continue
+			}
+			if taken[autoOutboundTag] {
+				log.Printf("singbox: skip selector %q: tag %q is taken", sel.Name, autoOutboundTag)
+				continue
+			}
+			taken[autoOutboundTag] = true
 			otd = append(otd, option.Outbound{
-				Tag:  "auto-out",
+				Tag:  autoOutboundTag,
 				Type: "urltest",
 				Options: option.URLTestOutboundOptions{
 					URL:       "https://www.google.com/generate_204",
@@ -316,102 +291,189 @@ func defaultOptionsTags[T upstream.ProxyOutbound](ots []T) []option.Outbound {
 					Outbounds: autoOutbounds,
 				},
 			})
-		case "ai-proxy":
-			if len(sel.Keywords) == 0 {
+			groups = append([]string{autoOutboundTag}, groups...)
+		default:
+			// any other entry becomes a named group (e.g. per region) offered by the proxy selector
+			if sel.Name == "" || sel.Name == proxyOutboundTag || len(sel.Keywords) == 0 {
 				continue
 			}
-			var aiOutbounds []string
+			var members []string
 			for _, ot := range ots {
 				if proxy.AnyContained(ot.Name(), sel.Keywords) {
 					if to, err := ot.ToOutbound(); err == nil {
-						aiOutbounds = append(aiOutbounds, to.Tag)
+						members = append(members, to.Tag)
 					}
 				}
 			}
-			if len(aiOutbounds) > 0 {
-				otd = append(otd, option.Outbound{
-					Tag:  "ai-proxy",
-					Type: C.TypeSelector,
-					Options: option.SelectorOutboundOptions{
-						Outbounds: aiOutbounds,
-					},
-				})
+			if len(members) == 0 {
+				continue
+			}
+			if taken[sel.Name] {
+				log.Printf("singbox: skip selector %q: tag is taken", sel.Name)
+				continue
+			}
+			taken[sel.Name] = true
+			group := option.Outbound{
+				Tag:  sel.Name,
+				Type: C.TypeSelector,
+				Options: option.SelectorOutboundOptions{
+					Outbounds: members,
+				},
+			}
+			if sel.Type == C.TypeURLTest {
+				group.Type = C.TypeURLTest
+				group.Options = option.URLTestOutboundOptions{
+					URL:       "https://www.google.com/generate_204",
+					Interval:  badoption.Duration(300 * time.Second),
+					Tolerance: 50,
+					Outbounds: members,
+				}
 			}
+			otd = append(otd, group)
+			groups = append(groups, sel.Name)
+		}
+	}
+
+	if regionCfg, err := GetRegionConfig(); err == nil && regionCfg.Enabled {
+		regionOts, tag := regionOutbounds(ots, regionCfg, taken)
+		if tag != "" {
+			otd = append(otd, regionOts...)
+			groups = append(groups, tag)
 		}
 	}
 
+	// imported upstream groups are offered after our own configured ones
+	if len(upstreamGroups) > 0 {
+		for _, g := range upstreamGroupOutbounds(upstreamGroups, taken) {
+			otd = append(otd, g)
+			groups = append(groups, g.Tag)
+		}
+	}
+
+	otd = append(otd, proxySelector(ots, groups, cfg.Proxy))
+
 	return otd
 }
 
-func OutboundToProfile[T upstream.ProxyOutbound](ots []T) (option.Options, error) {
+// proxySelector builds the user-facing "proxy" selector used by the global
+// clash mode and, by default, as the route final outbound.
+func proxySelector[T upstream.ProxyOutbound](ots []T, groups []string, cfg ProxySelectorConfig) option.Outbound {
+	members := append(append([]string{}, groups...), directOutboundTag)
+	if cfg.IncludeNodes || len(groups) == 0 {
+		seen := make(map[string]bool)
+		for _, ot := range ots {
+			to, err := ot.ToOutbound()
+			if err != nil || to.Tag == "" || seen[to.Tag] {
+				continue
+			}
+			seen[to.Tag] = true
+			members = append(members, to.Tag)
+		}
+	}
+
+	// fall back to the first entry that actually proxies, so an unset default never means direct
+	def := cfg.Default
+	if def == "" || !slices.Contains(members, def) {
+		def = members[0]
+		if len(members) > 1 && def == directOutboundTag {
+			def = members[1]
+		}
+	}
+
+	return option.Outbound{
+		Tag:  proxyOutboundTag,
+		Type: C.TypeSelector,
+		Options: option.SelectorOutboundOptions{
+			Outbounds:                 members,
+			Default:                   def,
+			InterruptExistConnections: cfg.InterruptExistConnections,
+		},
+	}
+}
+
+// ProfileOptions carries per-request adjustments layered over the config.
+type ProfileOptions struct {
+	// Token is the subscription token the profile is rendered for, empty for anonymous requests.
+	Token string
+	// BaseURL is the adapter's public URL, used to point rule sets at its mirror.
+	BaseURL string
+	// Inbounds are partial `inbounds` documents (token settings, query params)
+	// applied in order on top of the configured inbounds.
+	Inbounds []map[string]any
+	// Routings are the upstream routings preserved via `preserve_routing`.
+	Routings []upstream.Routing
+	// Groups are the upstream proxy groups imported via `import_groups`.
+	Groups []upstream.ProxyGroup
+	// Usage is the traffic and expiry of the providers, shown as `info_nodes`.
+	Usage []Usage
+	// Managed are the managed rule sets, see ruleset.ManagedRuleSets; left
+	// empty for anonymous requests.
+	Managed []ManagedRuleSet
+}
+
+func OutboundToProfile[T upstream.ProxyOutbound](ots []T, po ProfileOptions) (option.Options, error) {
 	var opts option.Options
 
-	outbounds := defaultOptionsTags(ots)
+	routeCfg, err := GetRouteConfig()
+	if err != nil {
+		return opts, err
+	}
+
+	outbounds := defaultOptionsTags(ots, routeCfg, po.Groups)
 	for _, ot := range ots {
 		if to, err := ot.ToOutbound(); err == nil {
 			outbounds = append(outbounds, to)
 		}
 	}
+	if infoCfg, err := GetInfoNodesConfig(); err == nil && infoCfg.Enabled && len(po.Usage) > 0 {
+		outbounds = append(outbounds, infoOutbounds(po.Usage, infoCfg, outbounds)...)
+	}
+	inboundCfg, err := GetInboundConfig(po.Inbounds...)
+	if err != nil {
+		return opts, err
+	}
+	inbounds, err := buildInbounds(inboundCfg)
+	if err != nil {
+		return opts, err
+	}
+	tun := hasTunInbound(inbounds)
 
-	cRule := rules
-	cRuleSet := ruleSet
-	cDNSRules := dnsRules
-	// 3) 仅当存在 ai-proxy 出站时，才追加 AI 相关路由与规则集
-	if hasAIProxySelector(outbounds) {
-		cRule = append(cRule, option.Rule{
-			Type: C.RuleTypeDefault,
-			DefaultOptions: option.DefaultRule{
-				RawDefaultRule: option.RawDefaultRule{
-					DomainSuffix: []string{"openai.com", "oaistatic.com", "oaiusercontent.com"},
-					RuleSet:      []string{"openai", "gemini"},
-					PackageName:  []string{"com.openai.chatgpt", "com.google.android.apps.bard", "com.google.bard"},
-				},
-				RuleAction: option.RuleAction{
-					Action: C.RuleActionTypeRoute,
-					RouteOptions: option.RouteActionOptions{
-						Outbound: "ai-proxy",
-					},
-				},
-			},
-		})
-		cRuleSet = append(cRuleSet, []option.RuleSet{
-			{
-				Type:   C.RuleSetTypeRemote,
-				Tag:    "openai",
-				Format: C.RuleSetFormatBinary,
-				RemoteOptions: option.RemoteRuleSet{
-					URL:            "https://jsd.onmicrosoft.cn/gh/SagerNet/sing-geosite@rule-set/geosite-openai.srs",
-					DownloadDetour: "direct-out",
-				},
-			},
-			{
-				Type:   C.RuleSetTypeRemote,
-				Tag:    "gemini",
-				Format: C.RuleSetFormatBinary,
-				RemoteOptions: option.RemoteRuleSet{
-					URL:            "https://jsd.onmicrosoft.cn/gh/SagerNet/sing-geosite@rule-set/geosite-google-gemini.srs",
-					DownloadDetour: "direct-out",
-				},
-			},
-		}...)
-
-		cDNSRules = append(cDNSRules, []option.DNSRule{
-			// AI 站点优先走 cloudflare-doh
-			{
-				Type: C.RuleTypeDefault,
-				DefaultOptions: option.DefaultDNSRule{
-					RawDefaultDNSRule: option.RawDefaultDNSRule{
-						RuleSet: []string{"openai", "gemini"},
-					},
-					DNSRuleAction: option.DNSRuleAction{
-						Action: C.RuleActionTypeRoute,
-						RouteOptions: option.DNSRouteActionOptions{
-							Server: "cloudflare-doh",
-						},
-					},
-				},
-			},
-		}...)
+	cRule, err := routeActionRules(routeCfg, tun)
+	if err != nil {
+		return opts, err
+	}
+	// managed rule sets (intranet, must-direct lists) take precedence over the built-in rules
+	managedSets, managedRules := managedProfileEntries(po.Managed, outbounds, po.BaseURL, po.Token)
+	cRule = append(cRule, managedRules...)
+	cRule = append(cRule, rules...)
+	cRuleSet := slices.Clone(ruleSet)
+
+	// service packs (AI, streaming, ...) whose target group has members
+	packs, err := GetServicePacks()
+	if err != nil {
+		return opts, err
+	}
+	packRules, packSets, cDNSRules := servicePackEntries(packs, outbounds)
+	cRule = append(cRule, packRules...)
+	cRuleSet = append(cRuleSet, packSets...)
+	upstreamRules, upstreamSets, upstreamFinal := upstreamRoutingEntries(po.Routings, outbounds, append(slices.Clone(cRuleSet), managedSets...))
+	if len(upstreamRules) > 0 {
+		cRule = append(cRule, upstreamRules...)
+	} else {
+		cRule = append(cRule, directRules...)
+	}
+	dnsCfg, err := GetDNSConfig()
+	if err != nil {
+		return opts, err
+	}
+	dnsOpts, err := buildDNSOptions(dnsCfg, cDNSRules, tun)
+	if err != nil {
+		return opts, err
+	}
+
+	expCfg, err := GetExperimentalConfig()
+	if err != nil {
+		return opts, err
 	}
 
 	opts = option.Options{
@@ -419,30 +481,44 @@ func OutboundToProfile[T upstream.ProxyOutbound](ots []T) (option.Options, error
 			Level:     "info",
 			Timestamp: true,
 		},
-		DNS: &option.DNSOptions{
-			RawDNSOptions: option.RawDNSOptions{
-				Servers: dnsServers,
-				Rules:   cDNSRules,
-				Final:   "alidns",
-			},
-		},
+		DNS:      dnsOpts,
 		Inbounds: inbounds,
 		Route: &option.RouteOptions{
 			AutoDetectInterface: true,
 			// 4) 使用 cRuleSet（包含动态追加的规则集）
-			RuleSet: cRuleSet,
+			// upstream sets stay on their own URLs, the mirror only carries the built-in ones
+			RuleSet: slices.Concat(mirrorRuleSets(cRuleSet, po.BaseURL), managedSets, upstreamSets),
 			Rules:   cRule,
+			Final:   routeFinal(routeCfg, outbounds, upstreamFinal),
 		},
-		Outbounds: outbounds,
+		Outbounds:    outbounds,
+		Experimental: buildExperimental(expCfg, po.Token, dnsCfg.FakeIP.Enabled && tun),
 	}
 
 	return opts, nil
 }
 
-// hasAIProxySelector checks if the outbounds contain an outbound with tag "ai-proxy"
-func hasAIProxySelector(ots []option.Outbound) bool {
-	for _, ot := range ots {
-		if ot.Tag == "ai-proxy" {
+// routeFinal returns the upstream MATCH policy preserved by preserve_routing,
+// then the configured final outbound when it exists in the generated
+// outbounds, then the proxy selector.
+func routeFinal(cfg RouteConfig, ots []option.Outbound, upstreamFinal string) string {
+	if upstreamFinal != "" {
+		return upstreamFinal
+	}
+	if cfg.Final != "" {
+		for _, ot := range ots {
+			if ot.Tag == cfg.Final {
+				return cfg.Final
+			}
+		}
+	}
+	return proxyOutboundTag
+}
+
+// hasTunInbound reports whether the profile captures traffic through a TUN inbound.
+func hasTunInbound(ibs []option.Inbound) bool {
+	for _, ib := range ibs {
+		if ib.Type == C.TypeTun {
 			return true
 		}
 	}
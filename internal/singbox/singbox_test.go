@@ -0,0 +1,67 @@
+package singbox
+
+import (
+	"slices"
+	"testing"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+)
+
+func TestRouteFinal(t *testing.T) {
+	ots := []option.Outbound{{Tag: directOutboundTag}, {Tag: "streaming"}, {Tag: proxyOutboundTag}}
+	tests := []struct {
+		final, upstream, want string
+	}{
+		{"", "", proxyOutboundTag},
+		{"streaming", "", "streaming"},
+		{"missing", "", proxyOutboundTag},
+		{"", directOutboundTag, directOutboundTag},
+		{"streaming", directOutboundTag, directOutboundTag},
+	}
+	for _, tt := range tests {
+		if got := routeFinal(RouteConfig{Final: tt.final}, ots, tt.upstream); got != tt.want {
+			t.Errorf("routeFinal(final %q, upstream %q) = %q, want %q", tt.final, tt.upstream, got, tt.want)
+		}
+	}
+}
+
+func TestRouteActionRules(t *testing.T) {
+	cfg := RouteConfig{
+		Sniff:     SniffConfig{Enabled: true},
+		HijackDNS: true,
+		Resolve:   ResolveConfig{Enabled: true, Strategy: "prefer_ipv4"},
+	}
+
+	rules, err := routeActionRules(cfg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 0 {
+		t.Errorf("without tun: %+v", rules)
+	}
+
+	rules, err = routeActionRules(cfg, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 3 {
+		t.Fatalf("with tun: %d rules", len(rules))
+	}
+	if rules[0].DefaultOptions.Action != C.RuleActionTypeSniff || rules[2].DefaultOptions.Action != C.RuleActionTypeResolve {
+		t.Errorf("actions %s, %s", rules[0].DefaultOptions.Action, rules[2].DefaultOptions.Action)
+	}
+	hijack := rules[1].LogicalOptions
+	if hijack.Action != C.RuleActionTypeHijackDNS || len(hijack.Rules) != 2 {
+		t.Fatalf("hijack rule %+v", hijack)
+	}
+	for _, r := range append(hijack.Rules, rules[0], rules[2]) {
+		if !slices.Equal(r.DefaultOptions.Inbound, []string{tunInboundTag}) {
+			t.Errorf("rule not restricted to %s: %+v", tunInboundTag, r.DefaultOptions.RawDefaultRule)
+		}
+	}
+
+	if _, err := routeActionRules(RouteConfig{Resolve: ResolveConfig{Enabled: true, Strategy: "bogus"}}, true); err == nil {
+		t.Error("bogus strategy accepted")
+	}
+}
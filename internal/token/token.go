@@ -9,6 +9,16 @@ import (
 type Token struct {
 	Token    string   `yaml:"token"`
 	Keywords []string `yaml:"keywords"`
+	// ExcludeKeywords drops nodes whose name contains any of them, applied after Keywords.
+	ExcludeKeywords []string `yaml:"exclude_keywords" mapstructure:"exclude_keywords"`
+	// Upstreams limits the nodes to these upstreams, by name or url; empty allows all.
+	Upstreams []string `yaml:"upstreams" mapstructure:"upstreams"`
+	// Protocols limits the nodes to these sing-box outbound types (shadowsocks, trojan, ...); empty allows all.
+	Protocols []string `yaml:"protocols" mapstructure:"protocols"`
+	// Overrides names the `overrides` documents patched onto this token's profiles, in order.
+	Overrides []string `yaml:"overrides" mapstructure:"overrides"`
+	// Inbounds overrides the `inbounds` config for profiles served to this token.
+	Inbounds map[string]any `yaml:"inbounds" mapstructure:"inbounds"`
 }
 
 func GetToken(tks string) (Token, error) {
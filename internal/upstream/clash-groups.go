@@ -0,0 +1,248 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	C "github.com/sagernet/sing-box/constant"
+	"go.yaml.in/yaml/v2"
+	"resty.dev/v3"
+)
+
+// ClashVergeProxyGroup is an entry of the Clash `proxy-groups` section.
+type ClashVergeProxyGroup struct {
+	Name              string   `yaml:"name"`
+	Type              string   `yaml:"type"` // select / url-test / fallback / load-balance / relay
+	Proxies           []string `yaml:"proxies"`
+	Use               []string `yaml:"use"`
+	Filter            string   `yaml:"filter"`
+	ExcludeFilter     string   `yaml:"exclude-filter"`
+	IncludeAll        bool     `yaml:"include-all"`
+	IncludeAllProxies bool     `yaml:"include-all-proxies"`
+	URL               string   `yaml:"url"`
+	Interval          int      `yaml:"interval"` // seconds
+	Tolerance         int      `yaml:"tolerance"`
+}
+
+// ClashVergeProxyProvider is an entry of the Clash `proxy-providers` section.
+type ClashVergeProxyProvider struct {
+	Type          string `yaml:"type"` // http / file
+	URL           string `yaml:"url"`
+	Path          string `yaml:"path"`
+	Filter        string `yaml:"filter"`
+	ExcludeFilter string `yaml:"exclude-filter"`
+}
+
+// loadProxyProviders downloads the profile's proxy providers, appends their
+// proxies to the profile and records which names each provider contributed.
+// Providers that fail to load are skipped with an error entry.
+func (p *ClashVergeProfile) loadProxyProviders(ctx context.Context, client *resty.Client, userAgent string) []string {
+	var failed []string
+	p.providerNodes = make(map[string][]string, len(p.ProxyProviders))
+	for name, provider := range p.ProxyProviders {
+		proxies, err := provider.load(ctx, client, userAgent, p.localDir)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("proxy-provider %s: %v", name, err))
+			continue
+		}
+		names := make([]string, 0, len(proxies))
+		for _, px := range proxies {
+			names = append(names, px.NameRaw)
+		}
+		names, err = filterNames(names, provider.Filter, provider.ExcludeFilter)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("proxy-provider %s: %v", name, err))
+			continue
+		}
+		keep := make(map[string]bool, len(names))
+		for _, n := range names {
+			keep[n] = true
+		}
+		for _, px := range proxies {
+			if keep[px.NameRaw] {
+				p.Proxies = append(p.Proxies, px)
+			}
+		}
+		p.providerNodes[name] = names
+	}
+	return failed
+}
+
+// load reads the provider's proxies; file providers are read below localDir.
+func (pp ClashVergeProxyProvider) load(ctx context.Context, client *resty.Client, userAgent, localDir string) ([]ClashVergeProxy, error) {
+	var in []byte
+	switch strings.ToLower(pp.Type) {
+	case "http":
+		resp, err := client.R().SetContext(ctx).SetHeader("User-Agent", userAgent).Get(pp.URL)
+		if err != nil {
+			return nil, err
+		}
+		if resp.IsError() {
+			return nil, fmt.Errorf("fetch %s: %s", pp.URL, resp.Status())
+		}
+		in = resp.Bytes()
+	case "file":
+		path, err := providerPath(localDir, pp.Path)
+		if err != nil {
+			return nil, err
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		in = b
+	default:
+		return nil, fmt.Errorf("unsupported provider type %q", pp.Type)
+	}
+
+	var doc struct {
+		Proxies []ClashVergeProxy `yaml:"proxies"`
+	}
+	if err := yaml.Unmarshal(in, &doc); err != nil {
+		return nil, fmt.Errorf("unmarshal provider failed: %w", err)
+	}
+	return doc.Proxies, nil
+}
+
+// ProxyGroups converts the profile's `proxy-groups`. sing-box has no fallback
+// or load-balance outbound, so both are downgraded to urltest (lowest latency
+// wins); relay groups cannot be expressed and are reported as unsupported,
+// as are members naming REJECT or PASS.
+func (p ClashVergeProfile) ProxyGroups() ([]ProxyGroup, []string) {
+	var groups []ProxyGroup
+	var unsupported []string
+
+	all := make([]string, 0, len(p.Proxies))
+	for _, px := range p.Proxies {
+		all = append(all, px.NameRaw)
+	}
+
+	for _, g := range p.Groups {
+		group := ProxyGroup{Tag: g.Name}
+		switch strings.ToLower(g.Type) {
+		case "select":
+			group.Type = C.TypeSelector
+		case "url-test", "fallback", "load-balance":
+			group.Type = C.TypeURLTest
+			group.URL = g.URL
+			if g.Interval > 0 {
+				group.Interval = time.Duration(g.Interval) * time.Second
+			}
+			if g.Tolerance > 0 && g.Tolerance <= 0xffff {
+				group.Tolerance = uint16(g.Tolerance)
+			}
+		default:
+			unsupported = append(unsupported, fmt.Sprintf("proxy-group %s: type %q", g.Name, g.Type))
+			continue
+		}
+
+		for _, member := range g.Proxies {
+			switch strings.ToUpper(member) {
+			case PolicyDirect:
+				group.Outbounds = append(group.Outbounds, DirectOutboundTag)
+			case "REJECT", "REJECT-DROP", "PASS", "COMPATIBLE":
+				unsupported = append(unsupported, fmt.Sprintf("proxy-group %s: member %s", g.Name, member))
+			default:
+				group.Outbounds = append(group.Outbounds, member)
+			}
+		}
+
+		// filter / exclude-filter apply to provider and include-all nodes, not to listed proxies
+		var pooled []string
+		if g.IncludeAll || g.IncludeAllProxies {
+			pooled = append(pooled, all...)
+		} else {
+			for _, use := range g.Use {
+				nodes, ok := p.providerNodes[use]
+				if !ok {
+					unsupported = append(unsupported, fmt.Sprintf("proxy-group %s: provider %s", g.Name, use))
+					continue
+				}
+				pooled = append(pooled, nodes...)
+			}
+		}
+		pooled, err := filterNames(pooled, g.Filter, g.ExcludeFilter)
+		if err != nil {
+			unsupported = append(unsupported, fmt.Sprintf("proxy-group %s: %v", g.Name, err))
+			continue
+		}
+		group.Outbounds = appendUnique(group.Outbounds, pooled...)
+
+		if len(group.Outbounds) == 0 {
+			unsupported = append(unsupported, fmt.Sprintf("proxy-group %s: no members", g.Name))
+			continue
+		}
+		groups = append(groups, group)
+	}
+	return groups, unsupported
+}
+
+// filterNames keeps the names matching filter and not matching exclude. Like
+// mihomo, either may hold several patterns separated by a backtick.
+func filterNames(names []string, filter, exclude string) ([]string, error) {
+	include, err := compilePatterns(filter)
+	if err != nil {
+		return nil, err
+	}
+	excluded, err := compilePatterns(exclude)
+	if err != nil {
+		return nil, err
+	}
+	if len(include) == 0 && len(excluded) == 0 {
+		return names, nil
+	}
+
+	var out []string
+	for _, name := range names {
+		if len(include) > 0 && !anyMatch(include, name) {
+			continue
+		}
+		if anyMatch(excluded, name) {
+			continue
+		}
+		out = append(out, name)
+	}
+	return out, nil
+}
+
+func compilePatterns(s string) ([]*regexp.Regexp, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var res []*regexp.Regexp
+	for _, pattern := range strings.Split(s, "`") {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter %q: %w", pattern, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func anyMatch(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func appendUnique(list []string, items ...string) []string {
+	seen := make(map[string]bool, len(list))
+	for _, s := range list {
+		seen[s] = true
+	}
+	for _, s := range items {
+		if !seen[s] {
+			seen[s] = true
+			list = append(list, s)
+		}
+	}
+	return list
+}
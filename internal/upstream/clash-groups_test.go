@@ -0,0 +1,122 @@
+package upstream
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	C "github.com/sagernet/sing-box/constant"
+	"go.yaml.in/yaml/v2"
+	"resty.dev/v3"
+)
+
+func TestProxyGroups(t *testing.T) {
+	in := `
+proxies:
+  - {name: HK 01, type: ss, server: a, port: 1}
+  - {name: HK 02, type: ss, server: b, port: 1}
+  - {name: US 01, type: ss, server: c, port: 1}
+proxy-groups:
+  - {name: Proxy, type: select, proxies: [Auto, DIRECT, REJECT, US 01]}
+  - {name: Auto, type: url-test, include-all: true, filter: HK, url: http://cp.test, interval: 300, tolerance: 50}
+  - {name: Fallback, type: fallback, include-all-proxies: true, exclude-filter: "HK 01` + "`" + `US"}
+  - {name: Chain, type: relay, proxies: [HK 01, US 01]}
+  - {name: Empty, type: select, use: [nowhere]}
+`
+	var p ClashVergeProfile
+	if err := yaml.Unmarshal([]byte(in), &p); err != nil {
+		t.Fatal(err)
+	}
+	groups, unsupported := p.ProxyGroups()
+
+	want := []ProxyGroup{
+		{Tag: "Proxy", Type: C.TypeSelector, Outbounds: []string{"Auto", DirectOutboundTag, "US 01"}},
+		{Tag: "Auto", Type: C.TypeURLTest, Outbounds: []string{"HK 01", "HK 02"}, URL: "http://cp.test", Interval: 300 * time.Second, Tolerance: 50},
+		{Tag: "Fallback", Type: C.TypeURLTest, Outbounds: []string{"HK 02"}},
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("got %d groups, want %d: %+v", len(groups), len(want), groups)
+	}
+	for i, g := range groups {
+		w := want[i]
+		if g.Tag != w.Tag || g.Type != w.Type || !slices.Equal(g.Outbounds, w.Outbounds) ||
+			g.URL != w.URL || g.Interval != w.Interval || g.Tolerance != w.Tolerance {
+			t.Errorf("group %d = %+v, want %+v", i, g, w)
+		}
+	}
+	// REJECT member, relay type, unknown provider, and the group left empty by it
+	if len(unsupported) != 4 {
+		t.Errorf("unsupported = %q", unsupported)
+	}
+}
+
+func TestFilterNames(t *testing.T) {
+	names := []string{"HK 01", "HK 02", "JP 01", "US 01"}
+	tests := []struct {
+		filter, exclude string
+		want            []string
+	}{
+		{"", "", names},
+		{"HK", "", []string{"HK 01", "HK 02"}},
+		{"HK`JP", "02", []string{"HK 01", "JP 01"}},
+		{"", "(?i)us", []string{"HK 01", "HK 02", "JP 01"}},
+	}
+	for _, tt := range tests {
+		got, err := filterNames(names, tt.filter, tt.exclude)
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("filterNames(%q, %q) = %q, %v; want %q", tt.filter, tt.exclude, got, err, tt.want)
+		}
+	}
+	if _, err := filterNames(names, "(", ""); err == nil {
+		t.Error("invalid filter accepted")
+	}
+}
+
+func TestProxyProvidersOnlyWhenEnabled(t *testing.T) {
+	dir := t.TempDir()
+	profile := `
+proxies:
+  - {name: inline, type: ss, server: a, port: 1, cipher: aes-128-gcm, password: x}
+proxy-providers:
+  local: {type: file, path: provider.yaml}
+  escape: {type: file, path: ../provider.yaml}
+`
+	provider := `
+proxies:
+  - {name: provided, type: ss, server: b, port: 1, cipher: aes-128-gcm, password: x}
+`
+	for name, content := range map[string]string{"profile.yaml": profile, "provider.yaml": provider} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	url := "file://" + filepath.Join(dir, "profile.yaml")
+
+	for _, enabled := range []bool{false, true} {
+		sub, err := ClashVergeSubscriber{ProxyProviders: enabled}.Fetch(context.Background(), resty.New(), url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, ot := range sub.Outbounds {
+			names = append(names, ot.Name())
+		}
+		want := []string{"inline"}
+		if enabled {
+			want = append(want, "provided")
+		}
+		if !slices.Equal(names, want) {
+			t.Errorf("ProxyProviders=%v: nodes = %q, want %q", enabled, names, want)
+		}
+	}
+}
+
+func TestFileProxyProviderRejectedInRemoteProfiles(t *testing.T) {
+	pp := ClashVergeProxyProvider{Type: "file", Path: "/etc/hostname"}
+	if _, err := pp.load(context.Background(), nil, "", ""); err == nil {
+		t.Error("remote profile: file provider was read")
+	}
+}
@@ -0,0 +1,364 @@
+package upstream
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"go.yaml.in/yaml/v2"
+	"resty.dev/v3"
+)
+
+// ClashVergeRuleProvider is an entry of the Clash `rule-providers` section.
+type ClashVergeRuleProvider struct {
+	Type     string   `yaml:"type"`     // http / file / inline
+	Behavior string   `yaml:"behavior"` // domain / ipcidr / classical
+	Format   string   `yaml:"format"`   // yaml / text / mrs
+	URL      string   `yaml:"url"`
+	Path     string   `yaml:"path"`
+	Payload  []string `yaml:"payload"`
+}
+
+// RuleProviderTagPrefix namespaces converted rule providers among the profile's rule sets.
+const RuleProviderTagPrefix = "clash-"
+
+// clashMatch is the sing-box form of a single Clash rule condition.
+type clashMatch struct {
+	Domain        []string
+	DomainSuffix  []string
+	DomainKeyword []string
+	DomainRegex   []string
+	IPCIDR        []string
+	SourceIPCIDR  []string
+	IPIsPrivate   bool
+	Port          []uint16
+	SourcePort    []uint16
+	ProcessName   []string
+	RuleSet       []string
+	GeoSite       string
+	GeoIP         string
+}
+
+// parseClashMatch translates a Clash rule type and value; ok is false for
+// rule types sing-box cannot express.
+func parseClashMatch(kind, value string) (m clashMatch, ok bool) {
+	switch strings.ToUpper(kind) {
+	case "DOMAIN":
+		m.Domain = []string{value}
+	case "DOMAIN-SUFFIX":
+		m.DomainSuffix = []string{value}
+	case "DOMAIN-KEYWORD":
+		m.DomainKeyword = []string{value}
+	case "DOMAIN-REGEX":
+		m.DomainRegex = []string{value}
+	case "IP-CIDR", "IP-CIDR6":
+		m.IPCIDR = []string{value}
+	case "SRC-IP-CIDR":
+		m.SourceIPCIDR = []string{value}
+	case "DST-PORT", "SRC-PORT":
+		port, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return m, false
+		}
+		if strings.EqualFold(kind, "DST-PORT") {
+			m.Port = []uint16{uint16(port)}
+		} else {
+			m.SourcePort = []uint16{uint16(port)}
+		}
+	case "PROCESS-NAME":
+		m.ProcessName = []string{value}
+	case "GEOSITE":
+		m.GeoSite = strings.ToLower(value)
+		m.RuleSet = []string{"geosite-" + m.GeoSite}
+	case "GEOIP":
+		if strings.EqualFold(value, "LAN") {
+			m.IPIsPrivate = true
+			break
+		}
+		m.GeoIP = strings.ToLower(value)
+		m.RuleSet = []string{"geoip-" + m.GeoIP}
+	case "RULE-SET":
+		m.RuleSet = []string{RuleProviderTagPrefix + value}
+	default:
+		return m, false
+	}
+	return m, true
+}
+
+func (m clashMatch) rawRule() option.RawDefaultRule {
+	return option.RawDefaultRule{
+		Domain:        m.Domain,
+		DomainSuffix:  m.DomainSuffix,
+		DomainKeyword: m.DomainKeyword,
+		DomainRegex:   m.DomainRegex,
+		IPCIDR:        m.IPCIDR,
+		SourceIPCIDR:  m.SourceIPCIDR,
+		IPIsPrivate:   m.IPIsPrivate,
+		Port:          m.Port,
+		SourcePort:    m.SourcePort,
+		ProcessName:   m.ProcessName,
+		RuleSet:       m.RuleSet,
+	}
+}
+
+// policyAction maps a Clash policy onto a sing-box route action.
+func policyAction(policy string) option.RuleAction {
+	switch strings.ToUpper(policy) {
+	case PolicyDirect:
+		return option.RuleAction{
+			Action:       C.RuleActionTypeRoute,
+			RouteOptions: option.RouteActionOptions{Outbound: DirectOutboundTag},
+		}
+	case "REJECT", "REJECT-TINYGIF":
+		return option.RuleAction{Action: C.RuleActionTypeReject}
+	case "REJECT-DROP":
+		return option.RuleAction{
+			Action:        C.RuleActionTypeReject,
+			RejectOptions: option.RejectActionOptions{Method: C.RuleActionRejectMethodDrop},
+		}
+	default:
+		return option.RuleAction{
+			Action:       C.RuleActionTypeRoute,
+			RouteOptions: option.RouteActionOptions{Outbound: policy},
+		}
+	}
+}
+
+// Routing translates the profile's `rules` and `rule-providers` into sing-box
+// rules and inline rule sets, downloading http providers with client.
+func (p ClashVergeProfile) Routing(ctx context.Context, client *resty.Client) *Routing {
+	routing := &Routing{}
+	geoSites := make(map[string]bool)
+	geoIPs := make(map[string]bool)
+	usedProviders := make(map[string]bool)
+
+	for _, line := range p.Rules {
+		fields := splitClashRule(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if strings.EqualFold(fields[0], "MATCH") || strings.EqualFold(fields[0], "FINAL") {
+			if len(fields) >= 2 && routing.Final == "" {
+				routing.Final = fields[1]
+			}
+			continue
+		}
+		if len(fields) < 3 {
+			routing.Unsupported = append(routing.Unsupported, line)
+			continue
+		}
+		m, ok := parseClashMatch(fields[0], fields[1])
+		if !ok {
+			routing.Unsupported = append(routing.Unsupported, line)
+			continue
+		}
+		if strings.EqualFold(fields[0], "RULE-SET") {
+			if _, exists := p.RuleProviders[fields[1]]; !exists {
+				routing.Unsupported = append(routing.Unsupported, line)
+				continue
+			}
+			usedProviders[fields[1]] = true
+		}
+		if m.GeoSite != "" && !geoSites[m.GeoSite] {
+			geoSites[m.GeoSite] = true
+			routing.GeoSites = append(routing.GeoSites, m.GeoSite)
+		}
+		if m.GeoIP != "" && !geoIPs[m.GeoIP] {
+			geoIPs[m.GeoIP] = true
+			routing.GeoIPs = append(routing.GeoIPs, m.GeoIP)
+		}
+		routing.Rules = append(routing.Rules, option.Rule{
+			Type: C.RuleTypeDefault,
+			DefaultOptions: option.DefaultRule{
+				RawDefaultRule: m.rawRule(),
+				RuleAction:     policyAction(fields[2]),
+			},
+		})
+	}
+
+	failed := make(map[string]bool)
+	for name, provider := range p.RuleProviders {
+		if !usedProviders[name] {
+			continue
+		}
+		rs, unsupported, err := provider.toRuleSet(ctx, client, p.localDir, RuleProviderTagPrefix+name)
+		routing.Unsupported = append(routing.Unsupported, unsupported...)
+		if err != nil {
+			routing.Unsupported = append(routing.Unsupported, fmt.Sprintf("rule-provider %s: %v", name, err))
+			failed[RuleProviderTagPrefix+name] = true
+			continue
+		}
+		routing.RuleSets = append(routing.RuleSets, rs)
+	}
+
+	// drop rules whose provider could not be converted, they would not load
+	if len(failed) > 0 {
+		kept := routing.Rules[:0]
+		for _, r := range routing.Rules {
+			if len(r.DefaultOptions.RuleSet) == 1 && failed[r.DefaultOptions.RuleSet[0]] {
+				continue
+			}
+			kept = append(kept, r)
+		}
+		routing.Rules = kept
+	}
+
+	return routing
+}
+
+// toRuleSet converts the provider payload into an inline rule set; file
+// providers are read below localDir.
+func (rp ClashVergeRuleProvider) toRuleSet(ctx context.Context, client *resty.Client, localDir, tag string) (option.RuleSet, []string, error) {
+	if strings.EqualFold(rp.Format, "mrs") {
+		return option.RuleSet{}, nil, fmt.Errorf("mrs format is not supported")
+	}
+
+	payload := rp.Payload
+	if len(payload) == 0 {
+		content, err := rp.load(ctx, client, localDir)
+		if err != nil {
+			return option.RuleSet{}, nil, err
+		}
+		payload, err = parseProviderPayload(content, rp.Format)
+		if err != nil {
+			return option.RuleSet{}, nil, err
+		}
+	}
+
+	var unsupported []string
+	var headless []option.HeadlessRule
+	switch strings.ToLower(rp.Behavior) {
+	case "domain":
+		var rule option.DefaultHeadlessRule
+		for _, entry := range payload {
+			switch {
+			case strings.HasPrefix(entry, "+."):
+				rule.DomainSuffix = append(rule.DomainSuffix, strings.TrimPrefix(entry, "+."))
+			case strings.HasPrefix(entry, "*."):
+				rule.DomainRegex = append(rule.DomainRegex, `^[^.]+\.`+regexp.QuoteMeta(strings.TrimPrefix(entry, "*."))+`$`)
+			case strings.HasPrefix(entry, "."):
+				rule.DomainSuffix = append(rule.DomainSuffix, entry)
+			default:
+				rule.Domain = append(rule.Domain, entry)
+			}
+		}
+		headless = append(headless, option.HeadlessRule{Type: C.RuleTypeDefault, DefaultOptions: rule})
+	case "ipcidr":
+		headless = append(headless, option.HeadlessRule{
+			Type:           C.RuleTypeDefault,
+			DefaultOptions: option.DefaultHeadlessRule{IPCIDR: payload},
+		})
+	case "classical":
+		// domain and IP conditions share one OR group in sing-box, so they merge
+		// into one rule; ports and processes need their own rules to stay OR'ed.
+		var merged option.DefaultHeadlessRule
+		for _, entry := range payload {
+			fields := splitClashRule(entry)
+			if len(fields) < 2 {
+				unsupported = append(unsupported, entry)
+				continue
+			}
+			m, ok := parseClashMatch(fields[0], fields[1])
+			if !ok || len(m.RuleSet) > 0 || m.IPIsPrivate {
+				unsupported = append(unsupported, tag+": "+entry)
+				continue
+			}
+			merged.Domain = append(merged.Domain, m.Domain...)
+			merged.DomainSuffix = append(merged.DomainSuffix, m.DomainSuffix...)
+			merged.DomainKeyword = append(merged.DomainKeyword, m.DomainKeyword...)
+			merged.DomainRegex = append(merged.DomainRegex, m.DomainRegex...)
+			merged.IPCIDR = append(merged.IPCIDR, m.IPCIDR...)
+			if len(m.SourceIPCIDR)+len(m.Port)+len(m.SourcePort)+len(m.ProcessName) > 0 {
+				headless = append(headless, option.HeadlessRule{
+					Type: C.RuleTypeDefault,
+					DefaultOptions: option.DefaultHeadlessRule{
+						SourceIPCIDR: m.SourceIPCIDR,
+						Port:         m.Port,
+						SourcePort:   m.SourcePort,
+						ProcessName:  m.ProcessName,
+					},
+				})
+			}
+		}
+		if merged.IsValid() {
+			headless = append([]option.HeadlessRule{{Type: C.RuleTypeDefault, DefaultOptions: merged}}, headless...)
+		}
+	default:
+		return option.RuleSet{}, nil, fmt.Errorf("unsupported behavior %q", rp.Behavior)
+	}
+
+	if len(headless) == 0 || !headless[0].IsValid() {
+		return option.RuleSet{}, unsupported, fmt.Errorf("empty payload")
+	}
+	return option.RuleSet{
+		Type:          C.RuleSetTypeInline,
+		Tag:           tag,
+		InlineOptions: option.PlainRuleSet{Rules: headless},
+	}, unsupported, nil
+}
+
+func (rp ClashVergeRuleProvider) load(ctx context.Context, client *resty.Client, localDir string) ([]byte, error) {
+	switch strings.ToLower(rp.Type) {
+	case "http":
+		resp, err := client.R().SetContext(ctx).Get(rp.URL)
+		if err != nil {
+			return nil, err
+		}
+		if resp.IsError() {
+			return nil, fmt.Errorf("fetch %s: %s", rp.URL, resp.Status())
+		}
+		return resp.Bytes(), nil
+	case "file":
+		path, err := providerPath(localDir, rp.Path)
+		if err != nil {
+			return nil, err
+		}
+		return os.ReadFile(path)
+	default:
+		return nil, fmt.Errorf("unsupported provider type %q", rp.Type)
+	}
+}
+
+// parseProviderPayload reads a provider file in yaml (`payload:` list) or text (one entry per line) format.
+func parseProviderPayload(content []byte, format string) ([]string, error) {
+	if strings.EqualFold(format, "text") {
+		var payload []string
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			payload = append(payload, line)
+		}
+		return payload, scanner.Err()
+	}
+
+	var doc struct {
+		Payload []string `yaml:"payload"`
+	}
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("unmarshal provider failed: %w", err)
+	}
+	return doc.Payload, nil
+}
+
+// splitClashRule splits "TYPE,VALUE,POLICY[,no-resolve]" into trimmed fields.
+func splitClashRule(line string) []string {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+	fields := strings.Split(line, ",")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	return fields
+}
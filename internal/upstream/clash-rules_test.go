@@ -0,0 +1,204 @@
+package upstream
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	C "github.com/sagernet/sing-box/constant"
+	"go.yaml.in/yaml/v2"
+)
+
+func TestParseClashMatch(t *testing.T) {
+	tests := []struct {
+		kind, value string
+		want        clashMatch
+		ok          bool
+	}{
+		{"DOMAIN", "a.com", clashMatch{Domain: []string{"a.com"}}, true},
+		{"domain-suffix", "a.com", clashMatch{DomainSuffix: []string{"a.com"}}, true},
+		{"DOMAIN-KEYWORD", "goo", clashMatch{DomainKeyword: []string{"goo"}}, true},
+		{"IP-CIDR6", "::1/128", clashMatch{IPCIDR: []string{"::1/128"}}, true},
+		{"SRC-IP-CIDR", "10.0.0.0/8", clashMatch{SourceIPCIDR: []string{"10.0.0.0/8"}}, true},
+		{"DST-PORT", "443", clashMatch{Port: []uint16{443}}, true},
+		{"SRC-PORT", "53", clashMatch{SourcePort: []uint16{53}}, true},
+		{"DST-PORT", "http", clashMatch{}, false},
+		{"GEOSITE", "Google", clashMatch{GeoSite: "google", RuleSet: []string{"geosite-google"}}, true},
+		{"GEOIP", "CN", clashMatch{GeoIP: "cn", RuleSet: []string{"geoip-cn"}}, true},
+		{"GEOIP", "lan", clashMatch{IPIsPrivate: true}, true},
+		{"RULE-SET", "ads", clashMatch{RuleSet: []string{"clash-ads"}}, true},
+		{"IN-PORT", "7890", clashMatch{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseClashMatch(tt.kind, tt.value)
+		if ok != tt.ok || (ok && !reflect.DeepEqual(got, tt.want)) {
+			t.Errorf("parseClashMatch(%q, %q) = %+v, %v; want %+v, %v", tt.kind, tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRouting(t *testing.T) {
+	in := `
+rules:
+  - DOMAIN-SUFFIX,google.com,Proxy
+  - GEOSITE,cn,DIRECT
+  - GEOIP,CN,DIRECT,no-resolve
+  - RULE-SET,ads,REJECT
+  - RULE-SET,missing,Proxy
+  - IN-PORT,7890,Proxy
+  - MATCH,Final
+rule-providers:
+  ads:
+    type: inline
+    behavior: domain
+    payload: [+.ads.com, "*.track.com", exact.com]
+  unused:
+    type: http
+    behavior: domain
+    url: http://127.0.0.1:1/never
+`
+	var p ClashVergeProfile
+	if err := yaml.Unmarshal([]byte(in), &p); err != nil {
+		t.Fatal(err)
+	}
+	r := p.Routing(context.Background(), nil)
+
+	if r.Final != "Final" {
+		t.Errorf("Final = %q", r.Final)
+	}
+	if len(r.Rules) != 4 {
+		t.Fatalf("got %d rules, want 4", len(r.Rules))
+	}
+	actions := []string{"Proxy", DirectOutboundTag, DirectOutboundTag, ""}
+	for i, want := range actions {
+		got := r.Rules[i].DefaultOptions.RuleAction
+		if want == "" {
+			if got.Action != C.RuleActionTypeReject {
+				t.Errorf("rule %d action = %q, want reject", i, got.Action)
+			}
+			continue
+		}
+		if got.RouteOptions.Outbound != want {
+			t.Errorf("rule %d outbound = %q, want %q", i, got.RouteOptions.Outbound, want)
+		}
+	}
+	if !reflect.DeepEqual(r.GeoSites, []string{"cn"}) || !reflect.DeepEqual(r.GeoIPs, []string{"cn"}) {
+		t.Errorf("GeoSites = %v, GeoIPs = %v", r.GeoSites, r.GeoIPs)
+	}
+	if len(r.Unsupported) != 2 {
+		t.Errorf("Unsupported = %q, want the missing provider and IN-PORT", r.Unsupported)
+	}
+
+	if len(r.RuleSets) != 1 || r.RuleSets[0].Tag != "clash-ads" {
+		t.Fatalf("RuleSets = %+v", r.RuleSets)
+	}
+	rule := r.RuleSets[0].InlineOptions.Rules[0].DefaultOptions
+	if !slices.Equal(rule.DomainSuffix, []string{"ads.com"}) ||
+		!slices.Equal(rule.DomainRegex, []string{`^[^.]+\.track\.com$`}) ||
+		!slices.Equal(rule.Domain, []string{"exact.com"}) {
+		t.Errorf("ads rule set = %+v", rule)
+	}
+}
+
+func TestRoutingDropsRulesOfFailedProviders(t *testing.T) {
+	p := ClashVergeProfile{
+		Rules: []string{"RULE-SET,bin,Proxy", "DOMAIN,a.com,Proxy"},
+		RuleProviders: map[string]ClashVergeRuleProvider{
+			"bin": {Type: "http", Behavior: "domain", Format: "mrs"},
+		},
+	}
+	r := p.Routing(context.Background(), nil)
+	if len(r.Rules) != 1 || len(r.RuleSets) != 0 {
+		t.Errorf("rules = %d, rule sets = %d; want only the DOMAIN rule", len(r.Rules), len(r.RuleSets))
+	}
+}
+
+func TestClassicalProvider(t *testing.T) {
+	rp := ClashVergeRuleProvider{
+		Type:     "inline",
+		Behavior: "classical",
+		Payload:  []string{"DOMAIN,a.com", "IP-CIDR,1.1.1.0/24", "DST-PORT,22", "GEOIP,CN", "bogus"},
+	}
+	rs, unsupported, err := rp.toRuleSet(context.Background(), nil, "", "clash-c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := rs.InlineOptions.Rules
+	if len(rules) != 2 {
+		t.Fatalf("got %d rules, want merged domain/ip plus the port rule", len(rules))
+	}
+	if !slices.Equal(rules[0].DefaultOptions.Domain, []string{"a.com"}) ||
+		!slices.Equal(rules[0].DefaultOptions.IPCIDR, []string{"1.1.1.0/24"}) ||
+		!slices.Equal(rules[1].DefaultOptions.Port, []uint16{22}) {
+		t.Errorf("rules = %+v", rules)
+	}
+	if len(unsupported) != 2 {
+		t.Errorf("unsupported = %q, want GEOIP and bogus", unsupported)
+	}
+}
+
+func TestParseProviderPayload(t *testing.T) {
+	tests := []struct {
+		format, content string
+		want            []string
+	}{
+		{"text", "a.com\n# comment\n\n  b.com  \n", []string{"a.com", "b.com"}},
+		{"yaml", "payload:\n  - a.com\n  - b.com\n", []string{"a.com", "b.com"}},
+		{"", "payload: ['+.c.com']", []string{"+.c.com"}},
+	}
+	for _, tt := range tests {
+		got, err := parseProviderPayload([]byte(tt.content), tt.format)
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("parseProviderPayload(%q) = %q, %v; want %q", tt.format, got, err, tt.want)
+		}
+	}
+}
+
+func TestProviderPath(t *testing.T) {
+	tests := []struct {
+		dir, path string
+		want      string
+		err       string
+	}{
+		{"", "rules.txt", "", "remote profiles"},
+		{"/etc/app", "rules/a.txt", "/etc/app/rules/a.txt", ""},
+		{"/etc/app", "../passwd", "", "outside"},
+		{"/etc/app", "/etc/passwd", "", "outside"},
+		{"/etc/app", "a/../../b", "", "outside"},
+	}
+	for _, tt := range tests {
+		got, err := providerPath(tt.dir, tt.path)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("providerPath(%q, %q) error = %v, want %q", tt.dir, tt.path, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("providerPath(%q, %q) = %q, %v; want %q", tt.dir, tt.path, got, err, tt.want)
+		}
+	}
+}
+
+func TestFileProviderOnlyInLocalProfiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "local.txt"), []byte("a.com\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rp := ClashVergeRuleProvider{Type: "file", Behavior: "domain", Format: "text", Path: "local.txt"}
+
+	if _, _, err := rp.toRuleSet(context.Background(), nil, "", "clash-f"); err == nil {
+		t.Error("remote profile: file provider was read")
+	}
+	rs, _, err := rp.toRuleSet(context.Background(), nil, dir, "clash-f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rs.InlineOptions.Rules[0].DefaultOptions.Domain; !slices.Equal(got, []string{"a.com"}) {
+		t.Errorf("Domain = %q", got)
+	}
+}
@@ -3,7 +3,9 @@ package upstream
 import (
 	"context"
 	"fmt"
+	"log"
 	"os"
+	"path/filepath"
 	"strings"
 
 	C "github.com/sagernet/sing-box/constant"
@@ -12,7 +14,11 @@ import (
 	"resty.dev/v3"
 )
 
-type ClashVergeSubscriber struct{}
+type ClashVergeSubscriber struct {
+	// ProxyProviders loads the profile's `proxy-providers` and adds their
+	// nodes; only needed when the upstream's groups are imported.
+	ProxyProviders bool
+}
 
 func (c ClashVergeSubscriber) Name() string {
 	return "Clash Verge"
@@ -31,20 +37,33 @@ func (c ClashVergeSubscriber) Profile(ctx context.Context, client *resty.Client,
 }
 
 func (c ClashVergeSubscriber) Outboards(ctx context.Context, client *resty.Client, url string) ([]ProxyOutbound, error) {
+	sub, err := c.Fetch(ctx, client, url)
+	if err != nil {
+		return nil, err
+	}
+	return sub.Outbounds, nil
+}
+
+func (c ClashVergeSubscriber) Fetch(ctx context.Context, client *resty.Client, url string) (*Subscription, error) {
 	var in []byte
+	var header string
+	var localDir string
 
 	if strings.HasPrefix(url, "file://") {
-		p, err := os.ReadFile(strings.TrimPrefix(url, "file://"))
+		path := strings.TrimPrefix(url, "file://")
+		p, err := os.ReadFile(path)
 		if err != nil {
 			return nil, err
 		}
 		in = p
+		localDir = filepath.Dir(path)
 	} else {
 		resp, err := client.R().SetContext(ctx).SetHeader("User-Agent", c.UserAgent()).Get(url)
 		if err != nil {
 			return nil, err
 		}
 		in = resp.Bytes()
+		header = resp.Header().Get(UserinfoHeader)
 	}
 
 	if len(in) == 0 {
@@ -57,6 +76,13 @@ func (c ClashVergeSubscriber) Outboards(ctx context.Context, client *resty.Clien
 	if err := yaml.Unmarshal(in, &profile); err != nil {
 		return nil, fmt.Errorf("unmarshal profile failed: %w", err)
 	}
+	profile.localDir = localDir
+
+	if c.ProxyProviders {
+		for _, msg := range profile.loadProxyProviders(ctx, client, c.UserAgent()) {
+			log.Printf("upstream: %s: %s", url, msg)
+		}
+	}
 
 	if len(profile.Proxies) == 0 {
 		return nil, fmt.Errorf("no proxies found in profile")
@@ -68,7 +94,11 @@ func (c ClashVergeSubscriber) Outboards(ctx context.Context, client *resty.Clien
 		cp := p
 		result = append(result, cp)
 	}
-	return result, nil
+	names := make([]string, 0, len(profile.Proxies))
+	for _, p := range profile.Proxies {
+		names = append(names, p.NameRaw)
+	}
+	return &Subscription{Outbounds: result, Clash: &profile, Userinfo: subscriptionUserinfo(header, in, names)}, nil
 }
 
 // mapToPluginOpts converts a map to a semicolon-separated string for plugin options.
@@ -105,7 +135,30 @@ func mapToPluginOpts(m map[string]any) string {
 }
 
 type ClashVergeProfile struct {
-	Proxies []ClashVergeProxy `yaml:"proxies"`
+	Proxies        []ClashVergeProxy                  `yaml:"proxies"`
+	ProxyProviders map[string]ClashVergeProxyProvider `yaml:"proxy-providers"`
+	Groups         []ClashVergeProxyGroup             `yaml:"proxy-groups"`
+	Rules          []string                           `yaml:"rules"`
+	RuleProviders  map[string]ClashVergeRuleProvider  `yaml:"rule-providers"`
+
+	// providerNodes records the proxy names each loaded proxy provider contributed.
+	providerNodes map[string][]string
+	// localDir is the directory of a profile read from a file:// upstream, the
+	// only place `file` providers may be read from; empty for remote profiles.
+	localDir string
+}
+
+// providerPath resolves the path of a `file` provider below the profile's
+// directory. Remote profiles may not use them: their paths would let the
+// subscription read any file of the host.
+func providerPath(localDir, path string) (string, error) {
+	if localDir == "" {
+		return "", fmt.Errorf("file providers are not allowed in remote profiles")
+	}
+	if !filepath.IsLocal(path) {
+		return "", fmt.Errorf("provider path %q is outside the profile directory", path)
+	}
+	return filepath.Join(localDir, path), nil
 }
 
 type ClashVergeProxy struct {
@@ -0,0 +1,15 @@
+package upstream
+
+import "time"
+
+// ProxyGroup is a node group defined by an upstream profile, already mapped
+// onto a sing-box group type.
+type ProxyGroup struct {
+	Tag  string
+	Type string // C.TypeSelector or C.TypeURLTest
+	// Outbounds are node tags, other group tags or DirectOutboundTag, in order.
+	Outbounds []string
+	URL       string
+	Interval  time.Duration
+	Tolerance uint16
+}
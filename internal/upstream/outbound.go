@@ -12,9 +12,43 @@ type UpstreamSubscriber interface {
 	UserAgent() string
 	Profile(ctx context.Context, client *resty.Client, url string) (string, error)
 	Outboards(ctx context.Context, client *resty.Client, url string) ([]ProxyOutbound, error)
+	Fetch(ctx context.Context, client *resty.Client, url string) (*Subscription, error)
+}
+
+// Subscription is the result of one upstream fetch: the nodes plus the parsed
+// profile, kept so callers can preserve the upstream's groups and routing.
+type Subscription struct {
+	Outbounds []ProxyOutbound
+	Clash     *ClashVergeProfile
+	SingBox   *SingBoxProfile
+	// Userinfo is the traffic and expiry the provider reports, nil when it does not.
+	Userinfo *Userinfo
 }
 
 type ProxyOutbound interface {
 	ToOutbound() (option.Outbound, error)
 	Name() string
 }
+
+// Rename returns ot under a different name; its outbound tag follows the name.
+func Rename(ot ProxyOutbound, name string) ProxyOutbound {
+	if r, ok := ot.(renamed); ok {
+		ot = r.ProxyOutbound
+	}
+	return renamed{ProxyOutbound: ot, name: name}
+}
+
+type renamed struct {
+	ProxyOutbound
+	name string
+}
+
+func (r renamed) Name() string {
+	return r.name
+}
+
+func (r renamed) ToOutbound() (option.Outbound, error) {
+	out, err := r.ProxyOutbound.ToOutbound()
+	out.Tag = r.name
+	return out, err
+}
@@ -0,0 +1,25 @@
+package upstream
+
+import "github.com/sagernet/sing-box/option"
+
+// Clash built-in policies and the sing-box outbound tags they map to.
+const (
+	DirectOutboundTag = "direct-out"
+	PolicyDirect      = "DIRECT"
+)
+
+// Routing is the routing section preserved from an upstream profile. Route
+// actions keep the upstream's policy names; the profile generator maps names
+// that do not exist in the generated outbounds onto its proxy selector.
+type Routing struct {
+	Rules    []option.Rule
+	RuleSets []option.RuleSet
+	// GeoSites and GeoIPs name the geosite-<name> / geoip-<name> rule sets the
+	// rules reference, which the generator declares as remote rule sets.
+	GeoSites []string
+	GeoIPs   []string
+	// Final is the MATCH policy, empty when the upstream has none.
+	Final string
+	// Unsupported lists the entries that could not be translated.
+	Unsupported []string
+}
@@ -30,7 +30,16 @@ func (c SingBoxSubscriber) Profile(ctx context.Context, client *resty.Client, ur
 }
 
 func (c SingBoxSubscriber) Outboards(ctx context.Context, client *resty.Client, url string) ([]ProxyOutbound, error) {
+	sub, err := c.Fetch(ctx, client, url)
+	if err != nil {
+		return nil, err
+	}
+	return sub.Outbounds, nil
+}
+
+func (c SingBoxSubscriber) Fetch(ctx context.Context, client *resty.Client, url string) (*Subscription, error) {
 	var in []byte
+	var header string
 
 	if strings.HasPrefix(url, "file://") {
 		p, err := os.ReadFile(strings.TrimPrefix(url, "file://"))
@@ -44,6 +53,7 @@ func (c SingBoxSubscriber) Outboards(ctx context.Context, client *resty.Client,
 			return nil, err
 		}
 		in = resp.Bytes()
+		header = resp.Header().Get(UserinfoHeader)
 	}
 
 	if len(in) == 0 {
@@ -68,11 +78,19 @@ func (c SingBoxSubscriber) Outboards(ctx context.Context, client *resty.Client,
 		}
 		result = append(result, p)
 	}
-	return result, nil
+	profile.Raw = in
+	names := make([]string, 0, len(profile.Outbounds))
+	for _, p := range profile.Outbounds {
+		names = append(names, p.Tag)
+	}
+	return &Subscription{Outbounds: result, SingBox: &profile, Userinfo: subscriptionUserinfo(header, in, names)}, nil
 }
 
 type SingBoxProfile struct {
 	Outbounds []SingBoxOutbound `json:"outbounds"`
+
+	// Raw is the profile as fetched, kept for pass-through mode.
+	Raw []byte `json:"-"`
 }
 
 type SingBoxOutbound struct {
@@ -0,0 +1,143 @@
+package upstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UserinfoHeader is the response header providers report traffic and expiry in.
+const UserinfoHeader = "Subscription-Userinfo"
+
+// Userinfo is the traffic (bytes) and expiry (unix seconds, 0 = never) a
+// provider reports for a subscription.
+type Userinfo struct {
+	Upload   int64 `json:"upload"`
+	Download int64 `json:"download"`
+	Total    int64 `json:"total"`
+	Expire   int64 `json:"expire"`
+}
+
+// ParseUserinfo reads the "upload=1; download=2; total=3; expire=4" header form.
+func ParseUserinfo(s string) (*Userinfo, bool) {
+	var u Userinfo
+	found := false
+	for _, kv := range strings.Split(s, ";") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+		// some providers send floats or an empty expire
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			continue
+		}
+		n := int64(f)
+		switch strings.ToLower(strings.TrimSpace(k)) {
+		case "upload":
+			u.Upload = n
+		case "download":
+			u.Download = n
+		case "total":
+			u.Total = n
+		case "expire":
+			u.Expire = n
+		default:
+			continue
+		}
+		found = true
+	}
+	return &u, found
+}
+
+// String returns the header form.
+func (u Userinfo) String() string {
+	s := fmt.Sprintf("upload=%d; download=%d; total=%d", u.Upload, u.Download, u.Total)
+	if u.Expire > 0 {
+		s += fmt.Sprintf("; expire=%d", u.Expire)
+	}
+	return s
+}
+
+// Add sums the traffic of two subscriptions; the earlier expiry wins.
+func (u Userinfo) Add(o Userinfo) Userinfo {
+	u.Upload += o.Upload
+	u.Download += o.Download
+	u.Total += o.Total
+	if u.Expire == 0 || (o.Expire > 0 && o.Expire < u.Expire) {
+		u.Expire = o.Expire
+	}
+	return u
+}
+
+// bodyUserinfo reads the SIP008 bytes_used / bytes_remaining fields.
+func bodyUserinfo(in []byte) *Userinfo {
+	var sip008 struct {
+		BytesUsed      *int64 `json:"bytes_used"`
+		BytesRemaining *int64 `json:"bytes_remaining"`
+	}
+	if json.Unmarshal(in, &sip008) != nil || sip008.BytesUsed == nil && sip008.BytesRemaining == nil {
+		return nil
+	}
+	var u Userinfo
+	if sip008.BytesUsed != nil {
+		u.Download = *sip008.BytesUsed
+	}
+	if sip008.BytesRemaining != nil {
+		u.Total = u.Download + *sip008.BytesRemaining
+	}
+	return &u
+}
+
+var (
+	remainingPattern = regexp.MustCompile(`(?i)(?:剩余流量|流量剩余|remaining|traffic left)\s*[:：]?\s*([\d.]+)\s*([KMGTP]?)i?B?`)
+	expirePattern    = regexp.MustCompile(`(?i)(?:到期|过期|expire[sd]?)\D*(\d{4})[-/.](\d{1,2})[-/.](\d{1,2})`)
+)
+
+// nameUserinfo reads the informational pseudo nodes providers without the
+// header put in base64 and Clash subscriptions ("剩余流量：12.5 GB", "套餐到期：2025-01-31").
+func nameUserinfo(names []string) *Userinfo {
+	var u Userinfo
+	found := false
+	for _, name := range names {
+		if m := remainingPattern.FindStringSubmatch(name); m != nil {
+			f, err := strconv.ParseFloat(m[1], 64)
+			if err != nil {
+				continue
+			}
+			exp := strings.Index("KMGTP", strings.ToUpper(m[2])) + 1
+			if m[2] == "" {
+				exp = 0
+			}
+			u.Total = int64(f * math.Pow(1024, float64(exp)))
+			found = true
+		}
+		if m := expirePattern.FindStringSubmatch(name); m != nil {
+			y, _ := strconv.Atoi(m[1])
+			mo, _ := strconv.Atoi(m[2])
+			d, _ := strconv.Atoi(m[3])
+			u.Expire = time.Date(y, time.Month(mo), d, 0, 0, 0, 0, time.Local).Unix()
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+	return &u
+}
+
+// subscriptionUserinfo prefers the header, then the SIP008 fields, then the
+// informational node names; nil when the provider reports nothing.
+func subscriptionUserinfo(header string, in []byte, names []string) *Userinfo {
+	if u, ok := ParseUserinfo(header); ok {
+		return u
+	}
+	if u := bodyUserinfo(in); u != nil {
+		return u
+	}
+	return nameUserinfo(names)
+}
@@ -0,0 +1,118 @@
+package upstream
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseUserinfo(t *testing.T) {
+	tests := []struct {
+		header string
+		want   Userinfo
+		ok     bool
+	}{
+		{"upload=1; download=2; total=3; expire=4", Userinfo{1, 2, 3, 4}, true},
+		{"Upload=1;Download=2;Total=3", Userinfo{1, 2, 3, 0}, true},
+		{"upload=1.5e3; download=2; total=1073741824.0; expire=", Userinfo{1500, 2, 1 << 30, 0}, true},
+		{"total=10; foo=bar; broken", Userinfo{Total: 10}, true},
+		{"foo=1", Userinfo{}, false},
+		{"", Userinfo{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseUserinfo(tt.header)
+		if ok != tt.ok || *got != tt.want {
+			t.Errorf("ParseUserinfo(%q) = %+v, %v; want %+v, %v", tt.header, *got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestUserinfoString(t *testing.T) {
+	if got := (Userinfo{1, 2, 3, 0}).String(); got != "upload=1; download=2; total=3" {
+		t.Errorf("String() = %q", got)
+	}
+	u := Userinfo{1, 2, 3, 4}
+	back, ok := ParseUserinfo(u.String())
+	if !ok || *back != u {
+		t.Errorf("round trip of %+v = %+v", u, back)
+	}
+}
+
+func TestUserinfoAdd(t *testing.T) {
+	tests := []struct {
+		a, b, want Userinfo
+	}{
+		{Userinfo{1, 2, 10, 0}, Userinfo{3, 4, 20, 0}, Userinfo{4, 6, 30, 0}},
+		{Userinfo{Expire: 200}, Userinfo{Expire: 100}, Userinfo{Expire: 100}},
+		{Userinfo{Expire: 100}, Userinfo{Expire: 200}, Userinfo{Expire: 100}},
+		{Userinfo{}, Userinfo{Expire: 100}, Userinfo{Expire: 100}}, // 0 = never, the other one expires first
+		{Userinfo{Expire: 100}, Userinfo{}, Userinfo{Expire: 100}},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Add(tt.b); got != tt.want {
+			t.Errorf("%+v.Add(%+v) = %+v, want %+v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestBodyUserinfo(t *testing.T) {
+	tests := []struct {
+		body string
+		want *Userinfo
+	}{
+		{`{"version":1,"servers":[],"bytes_used":100,"bytes_remaining":900}`, &Userinfo{Download: 100, Total: 1000}},
+		{`{"bytes_used":100}`, &Userinfo{Download: 100}},
+		{`{"bytes_remaining":900}`, &Userinfo{Total: 900}},
+		{`{"version":1,"servers":[]}`, nil},
+		{`proxies: []`, nil},
+	}
+	for _, tt := range tests {
+		got := bodyUserinfo([]byte(tt.body))
+		if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+			t.Errorf("bodyUserinfo(%s) = %+v, want %+v", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestNameUserinfo(t *testing.T) {
+	expire := time.Date(2025, 1, 31, 0, 0, 0, 0, time.Local).Unix()
+	tests := []struct {
+		names []string
+		want  *Userinfo
+	}{
+		{[]string{"剩余流量：12.5 GB", "套餐到期：2025-01-31", "HK 01"}, &Userinfo{Total: 12.5 * (1 << 30), Expire: expire}},
+		{[]string{"Traffic left: 512MB"}, &Userinfo{Total: 512 << 20}},
+		{[]string{"Remaining 1.5TiB"}, &Userinfo{Total: 1.5 * (1 << 40)}},
+		{[]string{"Expires 2025/1/31"}, &Userinfo{Expire: expire}},
+		{[]string{"流量剩余 100"}, &Userinfo{Total: 100}},
+		{[]string{"HK 01", "JP 02"}, nil},
+	}
+	for _, tt := range tests {
+		got := nameUserinfo(tt.names)
+		if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+			t.Errorf("nameUserinfo(%q) = %+v, want %+v", tt.names, got, tt.want)
+		}
+	}
+}
+
+func TestSubscriptionUserinfo(t *testing.T) {
+	body := []byte(`{"bytes_used":1,"bytes_remaining":1}`)
+	names := []string{"剩余流量：1 GB"}
+	tests := []struct {
+		name   string
+		header string
+		body   []byte
+		names  []string
+		want   *Userinfo
+	}{
+		{"header first", "upload=0; download=5; total=10", body, names, &Userinfo{Download: 5, Total: 10}},
+		{"then the body", "", body, names, &Userinfo{Download: 1, Total: 2}},
+		{"then node names", "", nil, names, &Userinfo{Total: 1 << 30}},
+		{"nothing", "", nil, []string{"HK 01"}, nil},
+	}
+	for _, tt := range tests {
+		got := subscriptionUserinfo(tt.header, tt.body, tt.names)
+		if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+			t.Errorf("%s: %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package dao
+
+import "context"
+
+// ManagedRuleSet 托管规则集，Content 为 sing-box 源格式 JSON（{"version":2,"rules":[...]}）
+type ManagedRuleSet struct {
+	ID       uint   `gorm:"primaryKey"`
+	Tag      string `gorm:"size:64;not null;unique"`
+	Mode     string `gorm:"size:16"` // remote / inline
+	Outbound string `gorm:"size:255"`
+	Content  string `gorm:"type:text;not null"`
+	Enabled  bool   `gorm:"not null;default:true"`
+}
+
+// ListManagedRuleSets returns the enabled managed rule sets, or nil when no database is configured.
+func ListManagedRuleSets(ctx context.Context) ([]ManagedRuleSet, error) {
+	if db == nil {
+		return nil, nil
+	}
+	var sets []ManagedRuleSet
+	err := GetContextDB(ctx).Where("enabled = ?", true).Order("id").Find(&sets).Error
+	return sets, err
+}